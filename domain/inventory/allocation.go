@@ -0,0 +1,108 @@
+package inventory
+
+// WarehouseSelector decides which warehouse should fulfil a requested quantity.
+// Implementations receive every stock record for the product and return the
+// chosen record, or nil when no warehouse can fulfil the quantity.
+type WarehouseSelector interface {
+	Select(candidates []*Inventory, quantity int, province string) *Inventory
+}
+
+// DefaultWarehouseSelector always prefers a single configured warehouse
+type DefaultWarehouseSelector struct {
+	WarehouseID uint
+	Fallback    WarehouseSelector
+}
+
+// Select returns the default warehouse if it can fulfil the quantity, otherwise defers to the fallback
+func (s DefaultWarehouseSelector) Select(candidates []*Inventory, quantity int, province string) *Inventory {
+	for _, inv := range candidates {
+		if inv.WarehouseID == s.WarehouseID && inv.CanFulfill(quantity) {
+			return inv
+		}
+	}
+
+	if s.Fallback != nil {
+		return s.Fallback.Select(candidates, quantity, province)
+	}
+
+	return nil
+}
+
+// MostStockSelector prefers the warehouse with the most available stock
+type MostStockSelector struct{}
+
+// Select returns the record with the highest available quantity that can fulfil the quantity
+func (s MostStockSelector) Select(candidates []*Inventory, quantity int, province string) *Inventory {
+	var selected *Inventory
+	for _, inv := range candidates {
+		if !inv.CanFulfill(quantity) {
+			continue
+		}
+
+		if selected == nil || inv.GetSellableQuantity() > selected.GetSellableQuantity() {
+			selected = inv
+		}
+	}
+
+	return selected
+}
+
+// PriorityWarehouseSelector prefers the warehouse with the lowest fulfilment priority value
+type PriorityWarehouseSelector struct{}
+
+// Select returns the highest-priority warehouse that can fulfil the quantity.
+// Candidates must have their Warehouse loaded for the priority to be compared.
+func (s PriorityWarehouseSelector) Select(candidates []*Inventory, quantity int, province string) *Inventory {
+	var selected *Inventory
+	for _, inv := range candidates {
+		if inv.Warehouse == nil || !inv.CanFulfill(quantity) {
+			continue
+		}
+
+		if selected == nil || inv.Warehouse.Priority < selected.Warehouse.Priority {
+			selected = inv
+		}
+	}
+
+	return selected
+}
+
+// NearestWarehouseSelector prefers a warehouse located in the shipping province,
+// then one whose service area covers it
+type NearestWarehouseSelector struct {
+	Fallback WarehouseSelector
+}
+
+// Select returns the closest warehouse that can fulfil the quantity, otherwise defers to the fallback.
+// Candidates must have their Warehouse loaded for the province to be compared.
+func (s NearestWarehouseSelector) Select(candidates []*Inventory, quantity int, province string) *Inventory {
+	if province != "" {
+		local := []*Inventory{}
+		serving := []*Inventory{}
+		for _, inv := range candidates {
+			if inv.Warehouse == nil {
+				continue
+			}
+
+			if inv.Warehouse.Province == province {
+				local = append(local, inv)
+			} else if inv.Warehouse.Serves(province) {
+				serving = append(serving, inv)
+			}
+		}
+
+		if selected := (PriorityWarehouseSelector{}).Select(local, quantity, province); selected != nil {
+			return selected
+		}
+
+		if selected := (PriorityWarehouseSelector{}).Select(serving, quantity, province); selected != nil {
+			return selected
+		}
+	}
+
+	if s.Fallback != nil {
+		return s.Fallback.Select(candidates, quantity, province)
+	}
+
+	return (MostStockSelector{}).Select(candidates, quantity, province)
+}
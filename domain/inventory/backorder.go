@@ -0,0 +1,95 @@
+package inventory
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common"
+)
+
+// BackorderStatus represents the status of a backorder
+type BackorderStatus string
+
+const (
+	BackorderStatusOpen      BackorderStatus = "open"
+	BackorderStatusAllocated BackorderStatus = "allocated"
+	BackorderStatusCancelled BackorderStatus = "cancelled"
+)
+
+// Backorder is an order item waiting for stock that was not on hand when it was ordered.
+// Open backorders are queued by CreatedAt and reserved oldest first as stock arrives.
+type Backorder struct {
+	common.Entity
+	BackorderID uint            `json:"backorder_id"`
+	OrderID     uint            `json:"order_id"`
+	OrderItemID uint            `json:"order_item_id"`
+	ProductID   uint            `json:"product_id"`
+	VariantID   *uint           `json:"variant_id,omitempty"`
+	Quantity    int             `json:"quantity"`
+	IsPreOrder  bool            `json:"is_pre_order"`
+	Status      BackorderStatus `json:"status"`
+	WarehouseID *uint           `json:"warehouse_id,omitempty"` // Set once stock has been reserved
+	CreatedAt   time.Time       `json:"created_at"`
+	AllocatedAt *time.Time      `json:"allocated_at,omitempty"`
+}
+
+// NewBackorder creates an open backorder for an order item
+func NewBackorder(orderID, orderItemID, productID uint, variantID *uint, quantity int, isPreOrder bool) (*Backorder, error) {
+	if orderID == 0 || orderItemID == 0 || productID == 0 {
+		return nil, errors.New("order, order item and product are required")
+	}
+
+	if quantity <= 0 {
+		return nil, errors.New("quantity must be greater than zero")
+	}
+
+	return &Backorder{
+		OrderID:     orderID,
+		OrderItemID: orderItemID,
+		ProductID:   productID,
+		VariantID:   variantID,
+		Quantity:    quantity,
+		IsPreOrder:  isPreOrder,
+		Status:      BackorderStatusOpen,
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+// IsOpen checks if the backorder is still waiting for stock
+func (b *Backorder) IsOpen() bool {
+	return b.Status == BackorderStatusOpen
+}
+
+// Allocate records that stock has been reserved for the backorder in a warehouse
+func (b *Backorder) Allocate(warehouseID uint) error {
+	if !b.IsOpen() {
+		return errors.New("only open backorders can be allocated")
+	}
+
+	now := time.Now()
+	b.Status = BackorderStatusAllocated
+	b.WarehouseID = &warehouseID
+	b.AllocatedAt = &now
+	return nil
+}
+
+// Cancel withdraws an open backorder from the queue
+func (b *Backorder) Cancel() error {
+	if !b.IsOpen() {
+		return errors.New("only open backorders can be cancelled")
+	}
+
+	b.Status = BackorderStatusCancelled
+	return nil
+}
+
+// OpenBackorderQuantity sums the quantity still waiting for stock
+func OpenBackorderQuantity(backorders []*Backorder) int {
+	total := 0
+	for _, b := range backorders {
+		if b.IsOpen() {
+			total += b.Quantity
+		}
+	}
+	return total
+}
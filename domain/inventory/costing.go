@@ -0,0 +1,205 @@
+package inventory
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common"
+	"github.com/hydr0g3nz/ecom_mid/domain/common/vo"
+)
+
+// CostingMethod represents how the cost of stock leaving inventory is measured
+type CostingMethod string
+
+const (
+	CostingMethodFIFO            CostingMethod = "fifo"
+	CostingMethodWeightedAverage CostingMethod = "weighted_average"
+)
+
+// CostingSettings is the store's costing configuration
+type CostingSettings struct {
+	common.Entity
+	Method    CostingMethod `json:"method"`
+	UpdatedBy uint          `json:"updated_by"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// IsValid checks if the method is one the store can cost stock with
+func (m CostingMethod) IsValid() bool {
+	return m == CostingMethodFIFO || m == CostingMethodWeightedAverage
+}
+
+// CostLayer represents a quantity of stock received at a single unit cost
+type CostLayer struct {
+	common.Entity
+	CostLayerID       uint          `json:"cost_layer_id"`
+	ProductID         uint          `json:"product_id"`
+	VariantID         *uint         `json:"variant_id,omitempty"`
+	WarehouseID       uint          `json:"warehouse_id"`
+	Quantity          int           `json:"quantity"`
+	RemainingQuantity int           `json:"remaining_quantity"`
+	UnitCost          vo.Money      `json:"unit_cost"`
+	ReferenceType     ReferenceType `json:"reference_type"`
+	ReferenceID       uint          `json:"reference_id"`
+	ReceivedAt        time.Time     `json:"received_at"`
+}
+
+// CostLayerConsumption records stock leaving inventory and the cost it was charged at
+type CostLayerConsumption struct {
+	common.Entity
+	ConsumptionID uint          `json:"consumption_id"`
+	CostLayerID   *uint         `json:"cost_layer_id,omitempty"`
+	ProductID     uint          `json:"product_id"`
+	VariantID     *uint         `json:"variant_id,omitempty"`
+	WarehouseID   uint          `json:"warehouse_id"`
+	Quantity      int           `json:"quantity"`
+	UnitCost      vo.Money      `json:"unit_cost"`
+	TotalCost     vo.Money      `json:"total_cost"`
+	ReferenceType ReferenceType `json:"reference_type"`
+	ReferenceID   uint          `json:"reference_id"`
+	ConsumedAt    time.Time     `json:"consumed_at"`
+}
+
+// NewCostLayer creates a new cost layer for received stock
+func NewCostLayer(
+	productID uint,
+	variantID *uint,
+	warehouseID uint,
+	quantity int,
+	unitCost vo.Money,
+	referenceType ReferenceType,
+	referenceID uint,
+) (*CostLayer, error) {
+	if quantity <= 0 {
+		return nil, errors.New("quantity must be greater than zero")
+	}
+
+	if unitCost.IsNegative() {
+		return nil, errors.New("unit cost cannot be negative")
+	}
+
+	return &CostLayer{
+		ProductID:         productID,
+		VariantID:         variantID,
+		WarehouseID:       warehouseID,
+		Quantity:          quantity,
+		RemainingQuantity: quantity,
+		UnitCost:          unitCost,
+		ReferenceType:     referenceType,
+		ReferenceID:       referenceID,
+		ReceivedAt:        time.Now(),
+	}, nil
+}
+
+// AverageUnitCost returns the weighted average unit cost of the remaining quantity in a set of layers
+func AverageUnitCost(layers []*CostLayer, currency string) (vo.Money, error) {
+	quantity := 0
+	value := 0.0
+	for _, layer := range layers {
+		if layer.RemainingQuantity <= 0 {
+			continue
+		}
+
+		if layer.UnitCost.Currency != currency {
+			return vo.Money{}, errors.New("cost layers have different currencies")
+		}
+
+		quantity += layer.RemainingQuantity
+		value += layer.UnitCost.Amount * float64(layer.RemainingQuantity)
+	}
+
+	if quantity == 0 {
+		return vo.NewMoney(0, currency)
+	}
+
+	// Not rounded to cents: the average is a unit cost, and rounding it would drift the
+	// value of every unit drawn at it
+	return vo.Money{Amount: value / float64(quantity), Currency: currency}, nil
+}
+
+// ConsumeCostLayers draws quantity from layers oldest first and returns the consumptions.
+// Under FIFO each consumption is charged at its layer's cost; under weighted average all are
+// charged at the average cost of the remaining layers. Quantity not covered by any layer is
+// charged at fallbackCost.
+func ConsumeCostLayers(layers []*CostLayer, quantity int, method CostingMethod, fallbackCost vo.Money) ([]CostLayerConsumption, error) {
+	if quantity <= 0 {
+		return nil, errors.New("quantity must be greater than zero")
+	}
+
+	averageCost, err := AverageUnitCost(layers, fallbackCost.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	consumptions := []CostLayerConsumption{}
+	remaining := quantity
+	for _, layer := range layers {
+		if remaining == 0 {
+			break
+		}
+
+		if layer.RemainingQuantity <= 0 {
+			continue
+		}
+
+		taken := layer.RemainingQuantity
+		if taken > remaining {
+			taken = remaining
+		}
+
+		unitCost := layer.UnitCost
+		if method == CostingMethodWeightedAverage {
+			unitCost = averageCost
+		}
+
+		consumption, err := newConsumption(&layer.CostLayerID, taken, unitCost)
+		if err != nil {
+			return nil, err
+		}
+
+		layer.RemainingQuantity -= taken
+		remaining -= taken
+		consumptions = append(consumptions, consumption)
+	}
+
+	// Stock that predates cost tracking has no layer to draw from
+	if remaining > 0 {
+		consumption, err := newConsumption(nil, remaining, fallbackCost)
+		if err != nil {
+			return nil, err
+		}
+		consumptions = append(consumptions, consumption)
+	}
+
+	return consumptions, nil
+}
+
+// TotalConsumedCost sums the cost of a set of consumptions
+func TotalConsumedCost(consumptions []CostLayerConsumption, currency string) (vo.Money, error) {
+	total, _ := vo.NewMoney(0, currency)
+	for _, consumption := range consumptions {
+		newTotal, err := total.Add(consumption.TotalCost)
+		if err != nil {
+			return vo.Money{}, err
+		}
+		total = newTotal
+	}
+
+	return total, nil
+}
+
+// newConsumption builds a consumption of quantity units at unitCost
+func newConsumption(costLayerID *uint, quantity int, unitCost vo.Money) (CostLayerConsumption, error) {
+	totalCost, err := unitCost.Multiply(float64(quantity))
+	if err != nil {
+		return CostLayerConsumption{}, err
+	}
+
+	return CostLayerConsumption{
+		CostLayerID: costLayerID,
+		Quantity:    quantity,
+		UnitCost:    unitCost,
+		TotalCost:   totalCost,
+		ConsumedAt:  time.Now(),
+	}, nil
+}
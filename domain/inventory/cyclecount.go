@@ -0,0 +1,208 @@
+package inventory
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common"
+)
+
+// PermissionApproveAdjustment is required to approve stock adjustments held for review
+const PermissionApproveAdjustment = "approve_stock_adjustment"
+
+// CycleCountStatus represents the status of a count session
+type CycleCountStatus string
+
+const (
+	CycleCountStatusCounting        CycleCountStatus = "counting"
+	CycleCountStatusPendingApproval CycleCountStatus = "pending_approval"
+	CycleCountStatusCompleted       CycleCountStatus = "completed"
+	CycleCountStatusCancelled       CycleCountStatus = "cancelled"
+)
+
+// CycleCountLineStatus represents the status of a single counted item
+type CycleCountLineStatus string
+
+const (
+	CountLineStatusCounted  CycleCountLineStatus = "counted"
+	CountLineStatusHeld     CycleCountLineStatus = "held"
+	CountLineStatusApproved CycleCountLineStatus = "approved"
+	CountLineStatusRejected CycleCountLineStatus = "rejected"
+	CountLineStatusPosted   CycleCountLineStatus = "posted"
+)
+
+// CycleCount represents a stock count session for a warehouse
+type CycleCount struct {
+	common.Entity
+	CountID     uint             `json:"count_id"`
+	WarehouseID uint             `json:"warehouse_id"`
+	Status      CycleCountStatus `json:"status"`
+	Notes       string           `json:"notes"`
+	StaffID     uint             `json:"staff_id"`
+	ApprovedBy  *uint            `json:"approved_by,omitempty"`
+	StartedAt   time.Time        `json:"started_at"`
+	CompletedAt *time.Time       `json:"completed_at,omitempty"`
+	Warehouse   *Warehouse       `json:"warehouse,omitempty"`
+	Lines       []CycleCountLine `json:"lines,omitempty"`
+}
+
+// CycleCountLine represents the counted quantity of one product in a count session
+type CycleCountLine struct {
+	common.Entity
+	CountLineID     uint                 `json:"count_line_id"`
+	CountID         uint                 `json:"count_id"`
+	ProductID       uint                 `json:"product_id"`
+	VariantID       *uint                `json:"variant_id,omitempty"`
+	SystemQuantity  int                  `json:"system_quantity"`
+	CountedQuantity int                  `json:"counted_quantity"`
+	Status          CycleCountLineStatus `json:"status"`
+}
+
+// NewCycleCount starts a new count session for a warehouse
+func NewCycleCount(warehouseID, staffID uint, notes string) (*CycleCount, error) {
+	if warehouseID == 0 {
+		return nil, errors.New("warehouse ID is required")
+	}
+
+	return &CycleCount{
+		WarehouseID: warehouseID,
+		Status:      CycleCountStatusCounting,
+		Notes:       notes,
+		StaffID:     staffID,
+		StartedAt:   time.Now(),
+		Lines:       []CycleCountLine{},
+	}, nil
+}
+
+// Variance returns the difference between the counted and system quantity
+func (l *CycleCountLine) Variance() int {
+	return l.CountedQuantity - l.SystemQuantity
+}
+
+// IsReadyToPost checks if the line's adjustment can be posted to inventory
+func (l *CycleCountLine) IsReadyToPost() bool {
+	return l.Status == CountLineStatusCounted || l.Status == CountLineStatusApproved
+}
+
+// RecordCount records the counted quantity of a product, replacing any earlier count for it
+func (c *CycleCount) RecordCount(productID uint, variantID *uint, systemQuantity, countedQuantity int) error {
+	if c.Status != CycleCountStatusCounting {
+		return errors.New("can only record counts in an open count session")
+	}
+
+	if countedQuantity < 0 {
+		return errors.New("counted quantity cannot be negative")
+	}
+
+	for i, line := range c.Lines {
+		if line.ProductID == productID && SameVariant(line.VariantID, variantID) {
+			c.Lines[i].SystemQuantity = systemQuantity
+			c.Lines[i].CountedQuantity = countedQuantity
+			return nil
+		}
+	}
+
+	c.Lines = append(c.Lines, CycleCountLine{
+		CountID:         c.CountID,
+		ProductID:       productID,
+		VariantID:       variantID,
+		SystemQuantity:  systemQuantity,
+		CountedQuantity: countedQuantity,
+		Status:          CountLineStatusCounted,
+	})
+	return nil
+}
+
+// Submit closes counting and holds every line whose variance exceeds the threshold
+func (c *CycleCount) Submit(threshold int) error {
+	if c.Status != CycleCountStatusCounting {
+		return errors.New("only open count sessions can be submitted")
+	}
+
+	if len(c.Lines) == 0 {
+		return errors.New("cannot submit an empty count session")
+	}
+
+	held := false
+	for i, line := range c.Lines {
+		variance := line.Variance()
+		if variance < 0 {
+			variance = -variance
+		}
+
+		if variance > threshold {
+			c.Lines[i].Status = CountLineStatusHeld
+			held = true
+		}
+	}
+
+	if held {
+		c.Status = CycleCountStatusPendingApproval
+	}
+	return nil
+}
+
+// Approve releases all held lines for posting
+func (c *CycleCount) Approve(staffID uint) error {
+	if c.Status != CycleCountStatusPendingApproval {
+		return errors.New("only count sessions pending approval can be approved")
+	}
+
+	for i, line := range c.Lines {
+		if line.Status == CountLineStatusHeld {
+			c.Lines[i].Status = CountLineStatusApproved
+		}
+	}
+
+	c.ApprovedBy = &staffID
+	return nil
+}
+
+// RejectLine discards a held line so no adjustment is posted for it
+func (c *CycleCount) RejectLine(lineID uint) error {
+	if c.Status != CycleCountStatusPendingApproval {
+		return errors.New("only count sessions pending approval can have lines rejected")
+	}
+
+	for i, line := range c.Lines {
+		if line.CountLineID == lineID {
+			if line.Status != CountLineStatusHeld {
+				return errors.New("only held lines can be rejected")
+			}
+
+			c.Lines[i].Status = CountLineStatusRejected
+			return nil
+		}
+	}
+
+	return errors.New("line not found in count session")
+}
+
+// MarkLinePosted records that a line's adjustment has been written to inventory
+func (c *CycleCount) MarkLinePosted(index int) {
+	c.Lines[index].Status = CountLineStatusPosted
+}
+
+// Complete finishes the session once no lines remain held
+func (c *CycleCount) Complete() error {
+	for _, line := range c.Lines {
+		if line.Status == CountLineStatusHeld {
+			return errors.New("count session still has lines awaiting approval")
+		}
+	}
+
+	now := time.Now()
+	c.Status = CycleCountStatusCompleted
+	c.CompletedAt = &now
+	return nil
+}
+
+// Cancel abandons a count session that has not been completed
+func (c *CycleCount) Cancel() error {
+	if c.Status == CycleCountStatusCompleted {
+		return errors.New("completed count sessions cannot be cancelled")
+	}
+
+	c.Status = CycleCountStatusCancelled
+	return nil
+}
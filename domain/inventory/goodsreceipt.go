@@ -0,0 +1,38 @@
+package inventory
+
+import (
+	"time"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common"
+	"github.com/hydr0g3nz/ecom_mid/domain/common/vo"
+)
+
+// GoodsReceipt represents one delivery received against a purchase order
+type GoodsReceipt struct {
+	common.Entity
+	ReceiptID     uint               `json:"receipt_id"`
+	POID          uint               `json:"po_id"`
+	WarehouseID   uint               `json:"warehouse_id"`
+	ReceivedDate  time.Time          `json:"received_date"`
+	StaffID       uint               `json:"staff_id"`
+	Notes         string             `json:"notes"`
+	PurchaseOrder *PurchaseOrder     `json:"purchase_order,omitempty"`
+	Warehouse     *Warehouse         `json:"warehouse,omitempty"`
+	Items         []GoodsReceiptItem `json:"items,omitempty"`
+}
+
+// GoodsReceiptItem represents the quantity of one purchase order line in a delivery
+type GoodsReceiptItem struct {
+	common.Entity
+	ReceiptItemID uint       `json:"receipt_item_id"`
+	ReceiptID     uint       `json:"receipt_id"`
+	POItemID      uint       `json:"po_item_id"`
+	ProductID     uint       `json:"product_id"`
+	VariantID     *uint      `json:"variant_id,omitempty"`
+	Quantity      int        `json:"quantity"`
+	UnitCost      vo.Money   `json:"unit_cost"`
+	LotNumber     string     `json:"lot_number,omitempty"`
+	ExpiryDate    *time.Time `json:"expiry_date,omitempty"`
+	SerialNumbers []string   `json:"serial_numbers,omitempty"`
+	LocationID    *uint      `json:"location_id,omitempty"` // Bin the line is put away into
+}
@@ -2,6 +2,7 @@ package inventory
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/hydr0g3nz/ecom_mid/domain/common"
@@ -15,9 +16,40 @@ type Inventory struct {
 	VariantID        *uint     `json:"variant_id,omitempty"`
 	WarehouseID      uint      `json:"warehouse_id"`
 	Quantity         int       `json:"quantity"`
-	ReservedQuantity int       `json:"reserved_quantity"`
+	ReservedQuantity int       `json:"reserved_quantity"` // Total of the active reservations against this stock
+	Version          int       `json:"version"`           // Bumped on every save; a save from a stale copy is rejected
 	UpdatedAt        time.Time `json:"updated_at"`
 	Warehouse        *Warehouse `json:"warehouse,omitempty"`
+	Lots             []InventoryLot `json:"lots,omitempty"`
+}
+
+// ErrConcurrentUpdate is returned when an inventory record was changed by another request
+// after it was loaded, so the change must be made again against the fresh record
+var ErrConcurrentUpdate = errors.New("inventory was updated by another request")
+
+// InsufficientStockError reports a request for more stock than a warehouse can give
+type InsufficientStockError struct {
+	ProductID   uint  `json:"product_id"`
+	VariantID   *uint `json:"variant_id,omitempty"`
+	WarehouseID uint  `json:"warehouse_id"`
+	Requested   int   `json:"requested"`
+	Available   int   `json:"available"`
+}
+
+// Error implements the error interface
+func (e *InsufficientStockError) Error() string {
+	return fmt.Sprintf("insufficient stock: requested %d, available %d", e.Requested, e.Available)
+}
+
+// insufficientStock builds the error for a request the record cannot cover
+func (i *Inventory) insufficientStock(requested, available int) error {
+	return &InsufficientStockError{
+		ProductID:   i.ProductID,
+		VariantID:   i.VariantID,
+		WarehouseID: i.WarehouseID,
+		Requested:   requested,
+		Available:   max(available, 0),
+	}
 }
 
 // GetAvailableQuantity returns the available quantity (total - reserved)
@@ -25,14 +57,14 @@ func (i *Inventory) GetAvailableQuantity() int {
 	return i.Quantity - i.ReservedQuantity
 }
 
-// IsInStock checks if there is available stock
+// IsInStock checks if there is sellable stock
 func (i *Inventory) IsInStock() bool {
-	return i.GetAvailableQuantity() > 0
+	return i.GetSellableQuantity() > 0
 }
 
-// CanFulfill checks if there is enough available stock to fulfill a quantity
+// CanFulfill checks if there is enough sellable stock to fulfill a quantity
 func (i *Inventory) CanFulfill(quantity int) bool {
-	return i.GetAvailableQuantity() >= quantity
+	return i.GetSellableQuantity() >= quantity
 }
 
 // AddStock adds stock to the inventory
@@ -53,7 +85,7 @@ func (i *Inventory) RemoveStock(quantity int) error {
 	}
 	
 	if i.Quantity < quantity {
-		return errors.New("insufficient stock")
+		return i.insufficientStock(quantity, i.Quantity)
 	}
 	
 	i.Quantity -= quantity
@@ -67,8 +99,9 @@ func (i *Inventory) ReserveStock(quantity int) error {
 		return errors.New("quantity must be greater than zero")
 	}
 	
-	if i.GetAvailableQuantity() < quantity {
-		return errors.New("insufficient available stock")
+	// Expired lots are blocked from sale
+	if i.GetSellableQuantity() < quantity {
+		return i.insufficientStock(quantity, i.GetSellableQuantity())
 	}
 	
 	i.ReservedQuantity += quantity
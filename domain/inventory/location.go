@@ -0,0 +1,164 @@
+package inventory
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common"
+)
+
+// LocationType represents a level in a warehouse's location hierarchy
+type LocationType string
+
+const (
+	LocationTypeZone  LocationType = "zone"
+	LocationTypeAisle LocationType = "aisle"
+	LocationTypeShelf LocationType = "shelf"
+	LocationTypeBin   LocationType = "bin"
+)
+
+// locationParents lists the type each location type must sit under
+var locationParents = map[LocationType]LocationType{
+	LocationTypeAisle: LocationTypeZone,
+	LocationTypeShelf: LocationTypeAisle,
+	LocationTypeBin:   LocationTypeShelf,
+}
+
+// Location represents a zone, aisle, shelf or bin inside a warehouse
+type Location struct {
+	common.Entity
+	LocationID   uint         `json:"location_id"`
+	WarehouseID  uint         `json:"warehouse_id"`
+	ParentID     *uint        `json:"parent_id,omitempty"`
+	Type         LocationType `json:"type"`
+	Code         string       `json:"code"`
+	Path         string       `json:"path"` // Codes from zone to this location, e.g. "A/03/2/B"
+	IsActive     bool         `json:"is_active"`
+	IsQuarantine bool         `json:"is_quarantine"` // Bin for returned stock held out of sellable inventory
+}
+
+// BinStock represents the quantity of a product held in a bin
+type BinStock struct {
+	common.Entity
+	BinStockID uint      `json:"bin_stock_id"`
+	LocationID uint      `json:"location_id"`
+	ProductID  uint      `json:"product_id"`
+	VariantID  *uint     `json:"variant_id,omitempty"`
+	Quantity   int       `json:"quantity"`
+	Location   *Location `json:"location,omitempty"`
+}
+
+// PickList lists where to collect an order's items in one warehouse, in walking order
+type PickList struct {
+	OrderID     uint       `json:"order_id"`
+	WarehouseID uint       `json:"warehouse_id"`
+	Lines       []PickLine `json:"lines"`
+}
+
+// PickLine is a quantity of one order item to pick from a bin
+type PickLine struct {
+	OrderItemID uint   `json:"order_item_id"`
+	ProductID   uint   `json:"product_id"`
+	VariantID   *uint  `json:"variant_id,omitempty"`
+	LocationID  *uint  `json:"location_id,omitempty"` // Nil when no bin holds the stock
+	Path        string `json:"path"`
+	Quantity    int    `json:"quantity"`
+}
+
+// NewLocation creates a location under parent, which must be the level above it.
+// Zones sit directly under the warehouse and take a nil parent.
+func NewLocation(warehouseID uint, parent *Location, locationType LocationType, code string) (*Location, error) {
+	if code == "" {
+		return nil, errors.New("location code cannot be empty")
+	}
+
+	if strings.Contains(code, "/") {
+		return nil, errors.New("location code cannot contain '/'")
+	}
+
+	location := &Location{
+		WarehouseID: warehouseID,
+		Type:        locationType,
+		Code:        code,
+		Path:        code,
+		IsActive:    true,
+	}
+
+	if locationType == LocationTypeZone {
+		if parent != nil {
+			return nil, errors.New("zones cannot have a parent location")
+		}
+		return location, nil
+	}
+
+	parentType, ok := locationParents[locationType]
+	if !ok {
+		return nil, errors.New("invalid location type")
+	}
+
+	if parent == nil || parent.Type != parentType {
+		return nil, errors.New("a " + string(locationType) + " must be placed in a " + string(parentType))
+	}
+
+	if parent.WarehouseID != warehouseID {
+		return nil, errors.New("parent location is in a different warehouse")
+	}
+
+	location.ParentID = &parent.LocationID
+	location.Path = parent.Path + "/" + code
+	return location, nil
+}
+
+// IsBin checks if the location can hold stock
+func (l *Location) IsBin() bool {
+	return l.Type == LocationTypeBin
+}
+
+// SetQuarantine marks a bin as holding quarantined stock, or clears the mark
+func (l *Location) SetQuarantine(quarantine bool) error {
+	if !l.IsBin() {
+		return errors.New("only bins can hold quarantined stock")
+	}
+
+	l.IsQuarantine = quarantine
+	return nil
+}
+
+// AddStock adds quantity to the bin
+func (b *BinStock) AddStock(quantity int) error {
+	if quantity <= 0 {
+		return errors.New("quantity must be greater than zero")
+	}
+
+	b.Quantity += quantity
+	return nil
+}
+
+// RemoveStock takes quantity out of the bin
+func (b *BinStock) RemoveStock(quantity int) error {
+	if quantity <= 0 {
+		return errors.New("quantity must be greater than zero")
+	}
+
+	if b.Quantity < quantity {
+		return errors.New("insufficient stock in bin")
+	}
+
+	b.Quantity -= quantity
+	return nil
+}
+
+// SortByPath orders the pick lines by bin path so the picker walks the warehouse once.
+// Lines without a bin go last.
+func (p *PickList) SortByPath() {
+	sort.SliceStable(p.Lines, func(i, j int) bool {
+		if p.Lines[i].LocationID == nil {
+			return false
+		}
+		if p.Lines[j].LocationID == nil {
+			return true
+		}
+		return p.Lines[i].Path < p.Lines[j].Path
+	})
+}
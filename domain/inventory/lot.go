@@ -0,0 +1,306 @@
+package inventory
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common"
+)
+
+// InventoryLot represents the quantity of one production lot held in an inventory record
+type InventoryLot struct {
+	common.Entity
+	LotID            uint       `json:"lot_id"`
+	InventoryID      uint       `json:"inventory_id"`
+	LotNumber        string     `json:"lot_number"`
+	ExpiryDate       *time.Time `json:"expiry_date,omitempty"`
+	Quantity         int        `json:"quantity"`
+	ReservedQuantity int        `json:"reserved_quantity"`
+	ReceivedAt       time.Time  `json:"received_at"`
+}
+
+// LotQuantity is a quantity received into or drawn from a single lot
+type LotQuantity struct {
+	LotNumber  string     `json:"lot_number"`
+	ExpiryDate *time.Time `json:"expiry_date,omitempty"`
+	Quantity   int        `json:"quantity"`
+}
+
+// GetAvailableQuantity returns the lot's unreserved quantity
+func (l *InventoryLot) GetAvailableQuantity() int {
+	return l.Quantity - l.ReservedQuantity
+}
+
+// IsExpired checks if the lot's expiry date has passed at asOf
+func (l *InventoryLot) IsExpired(asOf time.Time) bool {
+	return l.ExpiryDate != nil && !l.ExpiryDate.After(asOf)
+}
+
+// ExpiresWithin checks if the lot expires before asOf plus the given duration
+func (l *InventoryLot) ExpiresWithin(asOf time.Time, d time.Duration) bool {
+	return l.ExpiryDate != nil && l.ExpiryDate.Before(asOf.Add(d))
+}
+
+// IsLotTracked checks if the inventory holds stock by lot
+func (i *Inventory) IsLotTracked() bool {
+	return len(i.Lots) > 0
+}
+
+// AddLotStock adds stock received under a lot number, merging into an existing lot of the same number
+func (i *Inventory) AddLotStock(lotNumber string, expiryDate *time.Time, quantity int) error {
+	if lotNumber == "" {
+		return errors.New("lot number is required")
+	}
+
+	lot := i.findLot(lotNumber)
+	if lot != nil && !sameExpiry(lot.ExpiryDate, expiryDate) {
+		return errors.New("lot already exists with a different expiry date")
+	}
+
+	err := i.AddStock(quantity)
+	if err != nil {
+		return err
+	}
+
+	if lot != nil {
+		lot.Quantity += quantity
+		return nil
+	}
+
+	i.Lots = append(i.Lots, InventoryLot{
+		InventoryID: i.InventoryID,
+		LotNumber:   lotNumber,
+		ExpiryDate:  expiryDate,
+		Quantity:    quantity,
+		ReceivedAt:  time.Now(),
+	})
+	return nil
+}
+
+// ExpiredQuantity returns the unreserved quantity held in lots that have expired at asOf
+func (i *Inventory) ExpiredQuantity(asOf time.Time) int {
+	expired := 0
+	for _, lot := range i.Lots {
+		if lot.IsExpired(asOf) {
+			expired += lot.GetAvailableQuantity()
+		}
+	}
+	return expired
+}
+
+// GetSellableQuantity returns the available quantity that may be sold, excluding expired lots
+func (i *Inventory) GetSellableQuantity() int {
+	return i.GetAvailableQuantity() - i.ExpiredQuantity(time.Now())
+}
+
+// ReserveLots reserves stock like ReserveStock and allocates it to unexpired lots,
+// first-expiring first. Quantity the lots cannot cover comes from stock held outside lots.
+func (i *Inventory) ReserveLots(quantity int, asOf time.Time) ([]LotQuantity, error) {
+	err := i.ReserveStock(quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	taken := []LotQuantity{}
+	remaining := quantity
+	for _, lot := range i.lotsByExpiry() {
+		if remaining == 0 {
+			break
+		}
+
+		if lot.IsExpired(asOf) || lot.GetAvailableQuantity() <= 0 {
+			continue
+		}
+
+		n := min(lot.GetAvailableQuantity(), remaining)
+		lot.ReservedQuantity += n
+		remaining -= n
+		taken = append(taken, LotQuantity{LotNumber: lot.LotNumber, ExpiryDate: lot.ExpiryDate, Quantity: n})
+	}
+
+	return taken, nil
+}
+
+// ReleaseLots releases reserved stock like ReleaseReservedStock, returning the given lot quantities to available
+func (i *Inventory) ReleaseLots(quantity int, lots []LotQuantity) error {
+	err := i.checkReservedLots(quantity, lots)
+	if err != nil {
+		return err
+	}
+
+	err = i.ReleaseReservedStock(quantity)
+	if err != nil {
+		return err
+	}
+
+	for _, taken := range lots {
+		i.findLot(taken.LotNumber).ReservedQuantity -= taken.Quantity
+	}
+	return nil
+}
+
+// CommitLots commits reserved stock like CommitReservedStock, deducting the given lot quantities
+func (i *Inventory) CommitLots(quantity int, lots []LotQuantity) error {
+	err := i.checkReservedLots(quantity, lots)
+	if err != nil {
+		return err
+	}
+
+	err = i.CommitReservedStock(quantity)
+	if err != nil {
+		return err
+	}
+
+	for _, taken := range lots {
+		lot := i.findLot(taken.LotNumber)
+		lot.Quantity -= taken.Quantity
+		lot.ReservedQuantity -= taken.Quantity
+	}
+	i.removeEmptyLots()
+	return nil
+}
+
+// UncommitLots reverses CommitLots, putting committed stock back on hand under reservation
+// and into the lots it was taken from
+func (i *Inventory) UncommitLots(quantity int, lots []LotQuantity) error {
+	err := i.AddStock(quantity)
+	if err != nil {
+		return err
+	}
+	i.ReservedQuantity += quantity
+
+	for _, taken := range lots {
+		lot := i.findLot(taken.LotNumber)
+		if lot == nil {
+			i.Lots = append(i.Lots, InventoryLot{
+				InventoryID: i.InventoryID,
+				LotNumber:   taken.LotNumber,
+				ExpiryDate:  taken.ExpiryDate,
+				ReceivedAt:  time.Now(),
+			})
+			lot = &i.Lots[len(i.Lots)-1]
+		}
+		lot.Quantity += taken.Quantity
+		lot.ReservedQuantity += taken.Quantity
+	}
+	return nil
+}
+
+// RemoveLots removes stock like RemoveStock, drawing unreserved lot stock first-expiring
+// first so that expired stock is the first to be written off or moved out
+func (i *Inventory) RemoveLots(quantity int) ([]LotQuantity, error) {
+	err := i.RemoveStock(quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	taken := []LotQuantity{}
+	remaining := quantity
+	for _, lot := range i.lotsByExpiry() {
+		if remaining == 0 {
+			break
+		}
+
+		if lot.GetAvailableQuantity() <= 0 {
+			continue
+		}
+
+		n := min(lot.GetAvailableQuantity(), remaining)
+		lot.Quantity -= n
+		remaining -= n
+		taken = append(taken, LotQuantity{LotNumber: lot.LotNumber, ExpiryDate: lot.ExpiryDate, Quantity: n})
+	}
+	i.removeEmptyLots()
+	return taken, nil
+}
+
+// SelectReservedLots picks up to quantity from lots previously reserved, first-expiring first
+func (i *Inventory) SelectReservedLots(reserved []LotQuantity, quantity int) []LotQuantity {
+	outstanding := map[string]int{}
+	for _, lot := range reserved {
+		outstanding[lot.LotNumber] += lot.Quantity
+	}
+
+	taken := []LotQuantity{}
+	remaining := quantity
+	for _, lot := range i.lotsByExpiry() {
+		if remaining == 0 {
+			break
+		}
+
+		n := min(outstanding[lot.LotNumber], lot.ReservedQuantity, remaining)
+		if n <= 0 {
+			continue
+		}
+
+		remaining -= n
+		taken = append(taken, LotQuantity{LotNumber: lot.LotNumber, ExpiryDate: lot.ExpiryDate, Quantity: n})
+	}
+	return taken
+}
+
+// checkReservedLots verifies the lots hold the reservations about to be released or committed
+func (i *Inventory) checkReservedLots(quantity int, lots []LotQuantity) error {
+	total := 0
+	for _, taken := range lots {
+		lot := i.findLot(taken.LotNumber)
+		if lot == nil || lot.ReservedQuantity < taken.Quantity {
+			return errors.New("lot does not hold the reserved quantity")
+		}
+		total += taken.Quantity
+	}
+
+	if total > quantity {
+		return errors.New("lot quantities exceed the quantity requested")
+	}
+	return nil
+}
+
+// lotsByExpiry returns pointers to the lots ordered by expiry date, lots without one last
+func (i *Inventory) lotsByExpiry() []*InventoryLot {
+	lots := make([]*InventoryLot, len(i.Lots))
+	for idx := range i.Lots {
+		lots[idx] = &i.Lots[idx]
+	}
+
+	sort.SliceStable(lots, func(a, b int) bool {
+		if lots[a].ExpiryDate == nil {
+			return false
+		}
+		if lots[b].ExpiryDate == nil {
+			return true
+		}
+		return lots[a].ExpiryDate.Before(*lots[b].ExpiryDate)
+	})
+	return lots
+}
+
+// findLot returns a pointer to the lot with the given number
+func (i *Inventory) findLot(lotNumber string) *InventoryLot {
+	for idx := range i.Lots {
+		if i.Lots[idx].LotNumber == lotNumber {
+			return &i.Lots[idx]
+		}
+	}
+	return nil
+}
+
+// removeEmptyLots drops lots that have been fully depleted
+func (i *Inventory) removeEmptyLots() {
+	lots := i.Lots[:0]
+	for _, lot := range i.Lots {
+		if lot.Quantity > 0 {
+			lots = append(lots, lot)
+		}
+	}
+	i.Lots = lots
+}
+
+// sameExpiry compares two optional expiry dates
+func sameExpiry(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Equal(*b)
+}
@@ -2,48 +2,106 @@ package inventory
 
 import (
 	"errors"
+	"math"
 	"time"
 
 	"github.com/hydr0g3nz/ecom_mid/domain/common"
 	"github.com/hydr0g3nz/ecom_mid/domain/common/vo"
 )
 
+// PermissionApprovePurchaseOrder is required to approve purchase orders above the approval limit
+const PermissionApprovePurchaseOrder = "approve_purchase_order"
+
 // PurchaseOrderStatus represents the status of a purchase order
 type PurchaseOrderStatus string
 
 const (
-	POStatusDraft     PurchaseOrderStatus = "draft"
-	POStatusPending   PurchaseOrderStatus = "pending"
-	POStatusConfirmed PurchaseOrderStatus = "confirmed"
-	POStatusReceived  PurchaseOrderStatus = "received"
-	POStatusCancelled PurchaseOrderStatus = "cancelled"
+	POStatusDraft             PurchaseOrderStatus = "draft"
+	POStatusPending           PurchaseOrderStatus = "pending"
+	POStatusConfirmed         PurchaseOrderStatus = "confirmed"
+	POStatusPartiallyReceived PurchaseOrderStatus = "partially_received"
+	POStatusReceived          PurchaseOrderStatus = "received"
+	POStatusCancelled         PurchaseOrderStatus = "cancelled"
 )
 
 // PurchaseOrder represents an order to a supplier for products
 type PurchaseOrder struct {
 	common.Entity
-	POID           uint                `json:"po_id"`
-	SupplierID     uint                `json:"supplier_id"`
-	OrderDate      time.Time           `json:"order_date"`
-	ExpectedDate   *time.Time          `json:"expected_date,omitempty"`
-	Status         PurchaseOrderStatus `json:"status"`
-	Notes          string              `json:"notes"`
-	TotalAmount    vo.Money            `json:"total_amount"`
-	StaffID        uint                `json:"staff_id"`
-	Supplier       *Supplier           `json:"supplier,omitempty"`
-	Items          []PurchaseOrderItem `json:"items,omitempty"`
+	POID          uint                         `json:"po_id"`
+	SupplierID    uint                         `json:"supplier_id"`
+	OrderDate     time.Time                    `json:"order_date"`
+	ExpectedDate  *time.Time                   `json:"expected_date,omitempty"`
+	Status        PurchaseOrderStatus          `json:"status"`
+	Notes         string                       `json:"notes"`
+	TotalAmount   vo.Money                     `json:"total_amount"`
+	StaffID       uint                         `json:"staff_id"`
+	ApprovedBy    *uint                        `json:"approved_by,omitempty"`
+	ApprovedAt    *time.Time                   `json:"approved_at,omitempty"`
+	DropshipOrderID *uint                      `json:"dropship_order_id,omitempty"` // Customer order the supplier ships this PO to
+	ShipTo        *vo.Address                  `json:"ship_to,omitempty"`
+	TrackingNumber string                      `json:"tracking_number,omitempty"`
+	Carrier       string                       `json:"carrier,omitempty"`
+	Supplier      *Supplier                    `json:"supplier,omitempty"`
+	Items         []PurchaseOrderItem          `json:"items,omitempty"`
+	StatusHistory []PurchaseOrderStatusHistory `json:"status_history,omitempty"`
 }
 
 // PurchaseOrderItem represents a line item in a purchase order
 type PurchaseOrderItem struct {
 	common.Entity
-	POItemID   uint     `json:"po_item_id"`
-	POID       uint     `json:"po_id"`
-	ProductID  uint     `json:"product_id"`
-	VariantID  *uint    `json:"variant_id,omitempty"`
-	Quantity   int      `json:"quantity"`
-	UnitCost   vo.Money `json:"unit_cost"`
-	TotalCost  vo.Money `json:"total_cost"`
+	POItemID         uint     `json:"po_item_id"`
+	POID             uint     `json:"po_id"`
+	ProductID        uint     `json:"product_id"`
+	VariantID        *uint    `json:"variant_id,omitempty"`
+	Quantity         int      `json:"quantity"`
+	ReceivedQuantity int      `json:"received_quantity"`
+	UnitCost         vo.Money `json:"unit_cost"`
+	TotalCost        vo.Money `json:"total_cost"`
+}
+
+// PurchaseOrderStatusHistory represents a change in purchase order status
+type PurchaseOrderStatusHistory struct {
+	common.Entity
+	HistoryID uint                `json:"history_id"`
+	POID      uint                `json:"po_id"`
+	Status    PurchaseOrderStatus `json:"status"`
+	Comment   string              `json:"comment"`
+	StaffID   *uint               `json:"staff_id,omitempty"`
+	CreatedAt time.Time           `json:"created_at"`
+}
+
+// RemainingQuantity returns the quantity still to be delivered
+func (item *PurchaseOrderItem) RemainingQuantity() int {
+	if item.ReceivedQuantity >= item.Quantity {
+		return 0
+	}
+	return item.Quantity - item.ReceivedQuantity
+}
+
+// NewPurchaseOrder creates a new draft purchase order with validation
+func NewPurchaseOrder(supplierID uint, staffID uint, expectedDate *time.Time, notes string) (*PurchaseOrder, error) {
+	if supplierID == 0 {
+		return nil, errors.New("supplier ID is required")
+	}
+	
+	totalAmount, _ := vo.NewMoney(0, "THB")
+	
+	po := &PurchaseOrder{
+		SupplierID:    supplierID,
+		OrderDate:     time.Now(),
+		ExpectedDate:  expectedDate,
+		Status:        POStatusDraft,
+		Notes:         notes,
+		TotalAmount:   totalAmount,
+		StaffID:       staffID,
+		Items:         []PurchaseOrderItem{},
+		StatusHistory: []PurchaseOrderStatusHistory{},
+	}
+	
+	// Add initial status history
+	po.AddStatusHistory(POStatusDraft, "Purchase order created", &staffID)
+	
+	return po, nil
 }
 
 // AddItem adds a product to the purchase order
@@ -169,8 +227,26 @@ func (po *PurchaseOrder) recalculateTotal() error {
 	return nil
 }
 
-// ConfirmOrder changes the status to confirmed
-func (po *PurchaseOrder) ConfirmOrder() error {
+// Submit sends a draft purchase order for approval
+func (po *PurchaseOrder) Submit(staffID uint, comment string) error {
+	if po.Status != POStatusDraft {
+		return errors.New("only draft purchase orders can be submitted")
+	}
+	
+	if len(po.Items) == 0 {
+		return errors.New("cannot submit empty purchase order")
+	}
+	
+	return po.changeStatus(POStatusPending, comment, staffID)
+}
+
+// RequiresApproval checks if the order total is above the amount any staff member may confirm
+func (po *PurchaseOrder) RequiresApproval(limit float64) bool {
+	return po.TotalAmount.Amount > limit
+}
+
+// ConfirmOrder changes the status to confirmed, recording who approved it
+func (po *PurchaseOrder) ConfirmOrder(staffID uint, comment string) error {
 	if po.Status != POStatusPending {
 		return errors.New("only pending purchase orders can be confirmed")
 	}
@@ -179,26 +255,154 @@ func (po *PurchaseOrder) ConfirmOrder() error {
 		return errors.New("cannot confirm empty purchase order")
 	}
 	
-	po.Status = POStatusConfirmed
-	return nil
+	now := time.Now()
+	po.ApprovedBy = &staffID
+	po.ApprovedAt = &now
+	
+	return po.changeStatus(POStatusConfirmed, comment, staffID)
 }
 
-// ReceiveOrder changes the status to received
-func (po *PurchaseOrder) ReceiveOrder() error {
+// ReturnToDraft sends a pending purchase order back to its author for changes
+func (po *PurchaseOrder) ReturnToDraft(staffID uint, comment string) error {
+	if po.Status != POStatusPending {
+		return errors.New("only pending purchase orders can be returned to draft")
+	}
+	
+	return po.changeStatus(POStatusDraft, comment, staffID)
+}
+
+// ReceiveOrder changes the status to received, closing any short-shipped lines
+func (po *PurchaseOrder) ReceiveOrder(staffID uint, comment string) error {
+	if po.Status != POStatusConfirmed && po.Status != POStatusPartiallyReceived {
+		return errors.New("only confirmed purchase orders can be received")
+	}
+	
+	return po.changeStatus(POStatusReceived, comment, staffID)
+}
+
+// IsDropship checks if the supplier ships the order straight to a customer
+func (po *PurchaseOrder) IsDropship() bool {
+	return po.DropshipOrderID != nil
+}
+
+// RecordSupplierShipment records the supplier's tracking details for a dropship order.
+// The first shipment closes the order as received, since the goods never reach us;
+// later calls only correct the tracking details.
+func (po *PurchaseOrder) RecordSupplierShipment(trackingNumber, carrier string, staffID uint) error {
+	if !po.IsDropship() {
+		return errors.New("only dropship purchase orders are shipped by the supplier")
+	}
+	
+	if trackingNumber == "" {
+		return errors.New("tracking number is required")
+	}
+	
+	po.TrackingNumber = trackingNumber
+	po.Carrier = carrier
+	
+	if po.Status == POStatusReceived {
+		return nil
+	}
+	
 	if po.Status != POStatusConfirmed {
+		return errors.New("dropship purchase order must be approved before the supplier ships it")
+	}
+	
+	for i := range po.Items {
+		po.Items[i].ReceivedQuantity = po.Items[i].Quantity
+	}
+	
+	return po.changeStatus(POStatusReceived, "Shipped by supplier to customer", staffID)
+}
+
+// ReceiveItems records delivered quantities against the order's lines.
+// Each line may be over-received by at most tolerance (a fraction of the ordered quantity).
+func (po *PurchaseOrder) ReceiveItems(items []GoodsReceiptItem, tolerance float64, staffID uint) error {
+	if po.Status != POStatusConfirmed && po.Status != POStatusPartiallyReceived {
 		return errors.New("only confirmed purchase orders can be received")
 	}
 	
-	po.Status = POStatusReceived
+	if po.IsDropship() {
+		return errors.New("dropship purchase orders are delivered to the customer, not received")
+	}
+	
+	if len(items) == 0 {
+		return errors.New("receipt must contain at least one item")
+	}
+	
+	// Validate every line before applying any of them
+	received := map[uint]int{}
+	for _, receiptItem := range items {
+		if receiptItem.Quantity <= 0 {
+			return errors.New("received quantity must be greater than zero")
+		}
+		
+		poItem := po.findItem(receiptItem.POItemID)
+		if poItem == nil {
+			return errors.New("item not found in purchase order")
+		}
+		
+		received[receiptItem.POItemID] += receiptItem.Quantity
+		allowed := int(math.Floor(float64(poItem.Quantity) * (1 + tolerance)))
+		if poItem.ReceivedQuantity+received[receiptItem.POItemID] > allowed {
+			return errors.New("received quantity exceeds the over-receipt tolerance")
+		}
+	}
+	
+	for i := range items {
+		poItem := po.findItem(items[i].POItemID)
+		poItem.ReceivedQuantity += items[i].Quantity
+		
+		// Copy the product and cost onto the receipt line so it stands on its own
+		items[i].ProductID = poItem.ProductID
+		items[i].VariantID = poItem.VariantID
+		items[i].UnitCost = poItem.UnitCost
+	}
+	
+	for _, item := range po.Items {
+		if item.RemainingQuantity() > 0 {
+			return po.changeStatus(POStatusPartiallyReceived, "Goods partially received", staffID)
+		}
+	}
+	
+	return po.changeStatus(POStatusReceived, "All goods received", staffID)
+}
+
+// findItem returns a pointer to the line with the given ID
+func (po *PurchaseOrder) findItem(itemID uint) *PurchaseOrderItem {
+	for i := range po.Items {
+		if po.Items[i].POItemID == itemID {
+			return &po.Items[i]
+		}
+	}
 	return nil
 }
 
 // CancelOrder changes the status to cancelled
-func (po *PurchaseOrder) CancelOrder() error {
-	if po.Status == POStatusReceived {
+func (po *PurchaseOrder) CancelOrder(staffID uint, reason string) error {
+	if po.Status == POStatusReceived || po.Status == POStatusPartiallyReceived {
 		return errors.New("received purchase orders cannot be cancelled")
 	}
 	
-	po.Status = POStatusCancelled
+	return po.changeStatus(POStatusCancelled, reason, staffID)
+}
+
+// changeStatus updates the status and adds to history
+func (po *PurchaseOrder) changeStatus(status PurchaseOrderStatus, comment string, staffID uint) error {
+	po.Status = status
+	return po.AddStatusHistory(status, comment, &staffID)
+}
+
+// AddStatusHistory adds a status change to history
+func (po *PurchaseOrder) AddStatusHistory(status PurchaseOrderStatus, comment string, staffID *uint) error {
+	history := PurchaseOrderStatusHistory{
+		POID:      po.POID,
+		Status:    status,
+		Comment:   comment,
+		StaffID:   staffID,
+		CreatedAt: time.Now(),
+	}
+	
+	po.StatusHistory = append(po.StatusHistory, history)
 	return nil
 }
@@ -0,0 +1,83 @@
+package inventory
+
+import (
+	"errors"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common"
+)
+
+// ReorderRule defines when and how much of a product to replenish in a warehouse
+type ReorderRule struct {
+	common.Entity
+	ReorderRuleID       uint      `json:"reorder_rule_id"`
+	ProductID           uint      `json:"product_id"`
+	VariantID           *uint     `json:"variant_id,omitempty"`
+	WarehouseID         uint      `json:"warehouse_id"`
+	ReorderPoint        int       `json:"reorder_point"`
+	ReorderQuantity     int       `json:"reorder_quantity"`
+	SafetyStock         int       `json:"safety_stock"`
+	PreferredSupplierID *uint     `json:"preferred_supplier_id,omitempty"`
+	PreferredSupplier   *Supplier `json:"preferred_supplier,omitempty"`
+}
+
+// NewReorderRule creates a new reorder rule with validation
+func NewReorderRule(
+	productID uint,
+	variantID *uint,
+	warehouseID uint,
+	reorderPoint int,
+	reorderQuantity int,
+	safetyStock int,
+	preferredSupplierID *uint,
+) (*ReorderRule, error) {
+	rule := &ReorderRule{
+		ProductID:           productID,
+		VariantID:           variantID,
+		WarehouseID:         warehouseID,
+		PreferredSupplierID: preferredSupplierID,
+	}
+
+	err := rule.UpdateLevels(reorderPoint, reorderQuantity, safetyStock)
+	if err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+// UpdateLevels changes the reorder point, reorder quantity and safety stock
+func (r *ReorderRule) UpdateLevels(reorderPoint, reorderQuantity, safetyStock int) error {
+	if reorderPoint < 0 || safetyStock < 0 {
+		return errors.New("reorder point and safety stock cannot be negative")
+	}
+
+	if reorderQuantity <= 0 {
+		return errors.New("reorder quantity must be greater than zero")
+	}
+
+	r.ReorderPoint = reorderPoint
+	r.ReorderQuantity = reorderQuantity
+	r.SafetyStock = safetyStock
+	return nil
+}
+
+// NeedsReorder checks if the stock position has fallen below the reorder point
+func (r *ReorderRule) NeedsReorder(position int) bool {
+	return position < r.ReorderPoint
+}
+
+// OrderQuantity returns how much to order for a stock position.
+// It orders at least the reorder quantity, and more if needed to get back above
+// the reorder point plus safety stock.
+func (r *ReorderRule) OrderQuantity(position int) int {
+	if !r.NeedsReorder(position) {
+		return 0
+	}
+
+	shortfall := r.ReorderPoint + r.SafetyStock - position
+	if shortfall > r.ReorderQuantity {
+		return shortfall
+	}
+
+	return r.ReorderQuantity
+}
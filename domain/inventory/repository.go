@@ -1,16 +1,26 @@
 package inventory
 
+import (
+	"time"
+)
+
 // WarehouseRepository defines the interface for warehouse operations
 type WarehouseRepository interface {
 	FindByID(id uint) (*Warehouse, error)
 	FindByName(name string) (*Warehouse, error)
 	FindAll() ([]*Warehouse, error)
+	FindActive() ([]*Warehouse, error)
+	FindByServiceArea(province string) ([]*Warehouse, error)
 	Create(warehouse *Warehouse) error
 	Update(warehouse *Warehouse) error
 	Delete(id uint) error
 }
 
-// InventoryRepository defines the interface for inventory operations
+// InventoryRepository defines the interface for inventory operations.
+// Update must be a conditional write: it saves the record only while the stored Version
+// still matches the one loaded, increments Version, and otherwise returns ErrConcurrentUpdate.
+// Create likewise returns ErrConcurrentUpdate when the product already has a record in the warehouse.
+// Reservations, commits and releases rely on this to never oversell under concurrent checkouts.
 type InventoryRepository interface {
 	FindByID(id uint) (*Inventory, error)
 	FindByProductAndWarehouse(productID, warehouseID uint, variantID *uint) (*Inventory, error)
@@ -27,16 +37,139 @@ type InventoryRepository interface {
 	CommitReservedStock(productID, warehouseID uint, variantID *uint, quantity int, orderID uint, staffID uint) error
 }
 
+// StockRepositories are the repositories a StockUnitOfWork binds to one transaction
+type StockRepositories struct {
+	Inventories  InventoryRepository
+	Reservations ReservationRepository
+	Movements    StockMovementRepository
+	CostLayers   CostLayerRepository
+}
+
+// StockUnitOfWork runs changes to inventory records, their reservations, the stock movements
+// recording them and the cost layers valuing them as one transaction. Do hands work repositories
+// bound to the transaction and keeps what they wrote only when work returns nil; an error,
+// including ErrConcurrentUpdate from a conditional write, discards it all.
+// A change to an inventory record is always written together with its reservations,
+// movements and cost layers through it, so none is ever saved without the others.
+type StockUnitOfWork interface {
+	Do(work func(repos StockRepositories) error) error
+}
+
 // StockMovementRepository defines the interface for stock movement operations
 type StockMovementRepository interface {
 	FindByID(id uint) (*StockMovement, error)
 	FindByProduct(productID uint, variantID *uint, page, limit int) ([]*StockMovement, error)
 	FindByWarehouse(warehouseID uint, page, limit int) ([]*StockMovement, error)
 	FindByReference(referenceType string, referenceID uint) ([]*StockMovement, error)
+	FindByLot(lotNumber string) ([]*StockMovement, error)
 	FindByDateRange(startDate, endDate time.Time, page, limit int) ([]*StockMovement, error)
 	Create(movement *StockMovement) error
 }
 
+// StockTransferRepository defines the interface for stock transfer operations
+type StockTransferRepository interface {
+	FindByID(id uint) (*StockTransfer, error)
+	FindByStatus(status StockTransferStatus, page, limit int) ([]*StockTransfer, error)
+	FindInTransit(warehouseID uint) ([]*StockTransfer, error)
+	Create(transfer *StockTransfer) error
+	Update(transfer *StockTransfer) error
+	Delete(id uint) error
+}
+
+// CycleCountRepository defines the interface for count session operations
+type CycleCountRepository interface {
+	FindByID(id uint) (*CycleCount, error)
+	FindByWarehouse(warehouseID uint, page, limit int) ([]*CycleCount, error)
+	FindByStatus(status CycleCountStatus, page, limit int) ([]*CycleCount, error)
+	Create(count *CycleCount) error
+	Update(count *CycleCount) error
+}
+
+// ReorderRuleRepository defines the interface for reorder rule operations
+type ReorderRuleRepository interface {
+	FindByID(id uint) (*ReorderRule, error)
+	FindByProductAndWarehouse(productID, warehouseID uint, variantID *uint) (*ReorderRule, error)
+	FindByWarehouse(warehouseID uint) ([]*ReorderRule, error)
+	FindAll() ([]*ReorderRule, error)
+	Create(rule *ReorderRule) error
+	Update(rule *ReorderRule) error
+	Delete(id uint) error
+}
+
+// GoodsReceiptRepository defines the interface for goods receipt operations
+type GoodsReceiptRepository interface {
+	FindByID(id uint) (*GoodsReceipt, error)
+	FindByPurchaseOrder(poID uint) ([]*GoodsReceipt, error)
+	Create(receipt *GoodsReceipt) error
+}
+
+// CostLayerRepository defines the interface for cost layer operations
+type CostLayerRepository interface {
+	FindOpenLayers(productID, warehouseID uint, variantID *uint) ([]*CostLayer, error)
+	FindByWarehouseAsOf(warehouseID uint, asOf time.Time) ([]*CostLayer, error)
+	Create(layer *CostLayer) error
+	Update(layer *CostLayer) error
+	CreateConsumption(consumption *CostLayerConsumption) error
+	FindConsumptionsByWarehouseAsOf(warehouseID uint, asOf time.Time) ([]*CostLayerConsumption, error)
+	FindConsumptionsByReference(referenceType string, referenceID uint) ([]*CostLayerConsumption, error)
+}
+
+// CostingSettingsRepository defines the interface for the store's costing configuration
+type CostingSettingsRepository interface {
+	Get() (*CostingSettings, error)
+	Save(settings *CostingSettings) error
+}
+
+// SerialNumberRepository defines the interface for serial number operations
+type SerialNumberRepository interface {
+	FindByID(id uint) (*SerialNumber, error)
+	FindBySerialNumber(serialNumber string) (*SerialNumber, error)
+	FindByOrder(orderID uint) ([]*SerialNumber, error)
+	FindInStock(productID, warehouseID uint, variantID *uint) ([]*SerialNumber, error)
+	Create(serial *SerialNumber) error
+	Update(serial *SerialNumber) error
+}
+
+// ReservationRepository defines the interface for stock reservation operations.
+// Update must be a conditional write on the reservation's Version, like InventoryRepository.Update,
+// so two requests settling the same reservation cannot both succeed.
+type ReservationRepository interface {
+	FindByID(id uint) (*Reservation, error)
+	FindByOrder(orderID uint) ([]*Reservation, error)
+	FindActiveByStock(productID, warehouseID uint, variantID *uint) ([]*Reservation, error)
+	FindExpired(asOf time.Time) ([]*Reservation, error)
+	Create(reservation *Reservation) error
+	Update(reservation *Reservation) error
+}
+
+// BackorderRepository defines the interface for backorder operations
+type BackorderRepository interface {
+	FindByID(id uint) (*Backorder, error)
+	FindByOrder(orderID uint) ([]*Backorder, error)
+	FindOpenByProduct(productID uint, variantID *uint) ([]*Backorder, error) // Oldest first
+	Create(backorder *Backorder) error
+	Update(backorder *Backorder) error
+}
+
+// LocationRepository defines the interface for warehouse location operations
+type LocationRepository interface {
+	FindByID(id uint) (*Location, error)
+	FindByWarehouse(warehouseID uint) ([]*Location, error)
+	FindByPath(warehouseID uint, path string) (*Location, error)
+	Create(location *Location) error
+	Update(location *Location) error
+}
+
+// BinStockRepository defines the interface for bin stock operations
+type BinStockRepository interface {
+	FindByLocation(locationID uint) ([]*BinStock, error)
+	FindByLocationAndProduct(locationID, productID uint, variantID *uint) (*BinStock, error)
+	FindByProduct(productID, warehouseID uint, variantID *uint) ([]*BinStock, error)
+	Create(binStock *BinStock) error
+	Update(binStock *BinStock) error
+	Delete(id uint) error
+}
+
 // SupplierRepository defines the interface for supplier operations
 type SupplierRepository interface {
 	FindByID(id uint) (*Supplier, error)
@@ -53,12 +186,15 @@ type PurchaseOrderRepository interface {
 	FindBySupplier(supplierID uint, page, limit int) ([]*PurchaseOrder, error)
 	FindByStatus(status PurchaseOrderStatus, page, limit int) ([]*PurchaseOrder, error)
 	FindByDateRange(startDate, endDate time.Time, page, limit int) ([]*PurchaseOrder, error)
+	FindLatestItem(productID uint, variantID *uint) (*PurchaseOrderItem, error)
+	FindByDropshipOrder(orderID uint) ([]*PurchaseOrder, error)
 	Create(po *PurchaseOrder) error
 	Update(po *PurchaseOrder) error
 	Delete(id uint) error
 	AddItem(item *PurchaseOrderItem) error
 	UpdateItem(item *PurchaseOrderItem) error
 	RemoveItem(itemID uint) error
+	FindStatusHistory(poID uint) ([]*PurchaseOrderStatusHistory, error)
 	ConfirmOrder(poID uint, staffID uint) error
 	ReceiveOrder(poID uint, staffID uint) error
 	CancelOrder(poID uint, staffID uint) error
@@ -0,0 +1,126 @@
+package inventory
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common"
+)
+
+// ReservationStatus represents the status of a stock reservation
+type ReservationStatus string
+
+const (
+	ReservationStatusActive    ReservationStatus = "active"
+	ReservationStatusCommitted ReservationStatus = "committed"
+	ReservationStatusReleased  ReservationStatus = "released"
+)
+
+// Reservation is stock in one warehouse held for an order item.
+// Quantity is what is still held; it falls as the stock is committed or released.
+type Reservation struct {
+	common.Entity
+	ReservationID uint              `json:"reservation_id"`
+	OrderID       uint              `json:"order_id"`
+	OrderItemID   uint              `json:"order_item_id"`
+	ProductID     uint              `json:"product_id"`
+	VariantID     *uint             `json:"variant_id,omitempty"`
+	WarehouseID   uint              `json:"warehouse_id"`
+	Quantity      int               `json:"quantity"`
+	Status        ReservationStatus `json:"status"`
+	ExpiresAt     *time.Time        `json:"expires_at,omitempty"` // Nil once the order is paid for
+	Version       int               `json:"version"`              // Bumped on every save; a save from a stale copy is rejected
+	CreatedAt     time.Time         `json:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+}
+
+// NewReservation creates an active reservation that lapses after ttl; a ttl of zero never lapses
+func NewReservation(orderID, orderItemID, productID uint, variantID *uint, warehouseID uint, quantity int, ttl time.Duration) (*Reservation, error) {
+	if orderID == 0 || productID == 0 || warehouseID == 0 {
+		return nil, errors.New("order, product and warehouse are required")
+	}
+
+	if quantity <= 0 {
+		return nil, errors.New("quantity must be greater than zero")
+	}
+
+	now := time.Now()
+	reservation := &Reservation{
+		OrderID:     orderID,
+		OrderItemID: orderItemID,
+		ProductID:   productID,
+		VariantID:   variantID,
+		WarehouseID: warehouseID,
+		Quantity:    quantity,
+		Status:      ReservationStatusActive,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if ttl > 0 {
+		expiresAt := now.Add(ttl)
+		reservation.ExpiresAt = &expiresAt
+	}
+
+	return reservation, nil
+}
+
+// IsActive checks if the reservation still holds stock
+func (r *Reservation) IsActive() bool {
+	return r.Status == ReservationStatusActive
+}
+
+// IsExpired checks if an active reservation has outlived its time to live
+func (r *Reservation) IsExpired(asOf time.Time) bool {
+	return r.IsActive() && r.ExpiresAt != nil && asOf.After(*r.ExpiresAt)
+}
+
+// Holds checks if the reservation holds stock of an item in a warehouse for an order item
+func (r *Reservation) Holds(orderItemID uint, productID uint, variantID *uint, warehouseID uint) bool {
+	return r.IsActive() && r.OrderItemID == orderItemID && r.ProductID == productID && SameVariant(r.VariantID, variantID) && r.WarehouseID == warehouseID
+}
+
+// Hold keeps the reservation until the order ships, for orders that have been paid for
+func (r *Reservation) Hold() {
+	r.ExpiresAt = nil
+	r.UpdatedAt = time.Now()
+}
+
+// Commit takes quantity of the held stock as shipped
+func (r *Reservation) Commit(quantity int) error {
+	return r.reduce(quantity, ReservationStatusCommitted)
+}
+
+// Release gives quantity of the held stock back
+func (r *Reservation) Release(quantity int) error {
+	return r.reduce(quantity, ReservationStatusReleased)
+}
+
+// reduce lowers the held quantity, closing the reservation with status once nothing is left
+func (r *Reservation) reduce(quantity int, status ReservationStatus) error {
+	if !r.IsActive() {
+		return errors.New("reservation is no longer active")
+	}
+
+	if quantity <= 0 || quantity > r.Quantity {
+		return errors.New("quantity exceeds the reservation")
+	}
+
+	r.Quantity -= quantity
+	if r.Quantity == 0 {
+		r.Status = status
+	}
+	r.UpdatedAt = time.Now()
+	return nil
+}
+
+// ReservedQuantity sums the stock held by active reservations
+func ReservedQuantity(reservations []*Reservation) int {
+	total := 0
+	for _, r := range reservations {
+		if r.IsActive() {
+			total += r.Quantity
+		}
+	}
+	return total
+}
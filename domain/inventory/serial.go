@@ -0,0 +1,213 @@
+package inventory
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common"
+)
+
+// SerialStatus represents where a serialized unit currently is
+type SerialStatus string
+
+const (
+	SerialStatusInStock     SerialStatus = "in_stock"
+	SerialStatusShipped     SerialStatus = "shipped"
+	SerialStatusReturned    SerialStatus = "returned"
+	SerialStatusQuarantined SerialStatus = "quarantined" // Returned but held out of sellable stock
+	SerialStatusInTransit   SerialStatus = "in_transit"  // On a transfer between our warehouses
+)
+
+// SerialEventType represents a step in a serialized unit's history
+type SerialEventType string
+
+const (
+	SerialEventReceived    SerialEventType = "received"
+	SerialEventShipped     SerialEventType = "shipped"
+	SerialEventReturned    SerialEventType = "returned"
+	SerialEventQuarantined SerialEventType = "quarantined"
+	SerialEventDispatched  SerialEventType = "dispatched"  // Left a warehouse on a transfer
+	SerialEventReceivedIn  SerialEventType = "received_in" // Arrived at a warehouse on a transfer
+)
+
+// SerialNumber represents a single serialized unit of a product
+type SerialNumber struct {
+	common.Entity
+	SerialID     uint          `json:"serial_id"`
+	SerialNumber string        `json:"serial_number"`
+	ProductID    uint          `json:"product_id"`
+	VariantID    *uint         `json:"variant_id,omitempty"`
+	WarehouseID  *uint         `json:"warehouse_id,omitempty"` // Nil once the unit has left our warehouses
+	Status       SerialStatus  `json:"status"`
+	POID         *uint         `json:"po_id,omitempty"`
+	OrderID      *uint         `json:"order_id,omitempty"`
+	OrderItemID  *uint         `json:"order_item_id,omitempty"`
+	ShipmentID   *uint         `json:"shipment_id,omitempty"`
+	History      []SerialEvent `json:"history,omitempty"`
+}
+
+// SerialEvent records a change in a serialized unit's location or ownership
+type SerialEvent struct {
+	common.Entity
+	EventID       uint            `json:"event_id"`
+	SerialID      uint            `json:"serial_id"`
+	Type          SerialEventType `json:"type"`
+	WarehouseID   *uint           `json:"warehouse_id,omitempty"`
+	ReferenceType ReferenceType   `json:"reference_type"`
+	ReferenceID   uint            `json:"reference_id"`
+	ShipmentID    *uint           `json:"shipment_id,omitempty"`
+	StaffID       uint            `json:"staff_id"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// NewSerialNumber creates a unit received into a warehouse against a purchase order
+func NewSerialNumber(serialNumber string, productID uint, variantID *uint, warehouseID, poID, staffID uint) (*SerialNumber, error) {
+	if serialNumber == "" {
+		return nil, errors.New("serial number cannot be empty")
+	}
+
+	if productID == 0 || warehouseID == 0 {
+		return nil, errors.New("product and warehouse are required")
+	}
+
+	serial := &SerialNumber{
+		SerialNumber: serialNumber,
+		ProductID:    productID,
+		VariantID:    variantID,
+		WarehouseID:  &warehouseID,
+		Status:       SerialStatusInStock,
+		POID:         &poID,
+		History:      []SerialEvent{},
+	}
+
+	serial.addEvent(SerialEventReceived, ReferenceTypePurchaseOrder, poID, nil, staffID)
+	return serial, nil
+}
+
+// IsInStock checks if the unit is on hand in the given warehouse
+func (s *SerialNumber) IsInStock(warehouseID uint) bool {
+	return s.Status != SerialStatusShipped && s.Status != SerialStatusQuarantined && s.WarehouseID != nil && *s.WarehouseID == warehouseID
+}
+
+// Ship records the unit leaving a warehouse on an order's shipment
+func (s *SerialNumber) Ship(orderID, orderItemID, shipmentID, staffID uint) error {
+	if s.Status == SerialStatusShipped {
+		return errors.New("serial number has already been shipped")
+	}
+
+	s.Status = SerialStatusShipped
+	s.OrderID = &orderID
+	s.OrderItemID = &orderItemID
+	s.ShipmentID = &shipmentID
+	s.addEvent(SerialEventShipped, ReferenceTypeOrder, orderID, &shipmentID, staffID)
+	s.WarehouseID = nil
+	return nil
+}
+
+// Unship puts a unit back in the warehouse it was about to leave when its shipment could
+// not be completed, dropping the shipment from its history
+func (s *SerialNumber) Unship(warehouseID uint) error {
+	if s.Status != SerialStatusShipped {
+		return errors.New("serial number has not been shipped")
+	}
+
+	s.Status = SerialStatusInStock
+	s.WarehouseID = &warehouseID
+	s.OrderID = nil
+	s.OrderItemID = nil
+	s.ShipmentID = nil
+	if last := len(s.History) - 1; last >= 0 && s.History[last].Type == SerialEventShipped {
+		s.History = s.History[:last]
+	}
+	return nil
+}
+
+// IsDispatchedOn checks if the unit left its warehouse on a transfer and has not arrived yet
+func (s *SerialNumber) IsDispatchedOn(transferID uint) bool {
+	if s.Status != SerialStatusInTransit || len(s.History) == 0 {
+		return false
+	}
+
+	last := s.History[len(s.History)-1]
+	return last.Type == SerialEventDispatched && last.ReferenceID == transferID
+}
+
+// Dispatch records the unit leaving a warehouse on a transfer to another of our warehouses
+func (s *SerialNumber) Dispatch(warehouseID, transferID, staffID uint) error {
+	if !s.IsInStock(warehouseID) {
+		return errors.New("serial number is not in stock in the source warehouse")
+	}
+
+	s.addEvent(SerialEventDispatched, ReferenceTypeTransfer, transferID, nil, staffID)
+	s.Status = SerialStatusInTransit
+	s.WarehouseID = nil
+	return nil
+}
+
+// ReceiveTransfer records the unit arriving at a warehouse on a transfer
+func (s *SerialNumber) ReceiveTransfer(warehouseID, transferID, staffID uint) error {
+	if s.Status != SerialStatusInTransit {
+		return errors.New("only serial numbers in transit can be received")
+	}
+
+	s.Status = SerialStatusInStock
+	s.WarehouseID = &warehouseID
+	s.addEvent(SerialEventReceivedIn, ReferenceTypeTransfer, transferID, nil, staffID)
+	return nil
+}
+
+// IsShippedOn checks if the unit is out with the customer on an order item
+func (s *SerialNumber) IsShippedOn(orderID, orderItemID uint) bool {
+	return s.Status == SerialStatusShipped &&
+		s.OrderID != nil && *s.OrderID == orderID &&
+		s.OrderItemID != nil && *s.OrderItemID == orderItemID
+}
+
+// IsReturnedOn checks if the unit came back on a return, whether restocked or quarantined,
+// and has not moved since
+func (s *SerialNumber) IsReturnedOn(returnID uint) bool {
+	if s.Status != SerialStatusReturned && s.Status != SerialStatusQuarantined || len(s.History) == 0 {
+		return false
+	}
+
+	last := s.History[len(s.History)-1]
+	return last.ReferenceType == ReferenceTypeReturn && last.ReferenceID == returnID
+}
+
+// Return records a unit shipped on an order item coming back into a warehouse
+func (s *SerialNumber) Return(orderID, orderItemID, warehouseID, returnID, staffID uint) error {
+	if !s.IsShippedOn(orderID, orderItemID) {
+		return errors.New("serial number was not shipped on the returned item")
+	}
+
+	s.Status = SerialStatusReturned
+	s.WarehouseID = &warehouseID
+	s.addEvent(SerialEventReturned, ReferenceTypeReturn, returnID, nil, staffID)
+	return nil
+}
+
+// Quarantine records a unit shipped on an order item coming back into a warehouse unfit for sale
+func (s *SerialNumber) Quarantine(orderID, orderItemID, warehouseID, returnID, staffID uint) error {
+	if !s.IsShippedOn(orderID, orderItemID) {
+		return errors.New("serial number was not shipped on the returned item")
+	}
+
+	s.Status = SerialStatusQuarantined
+	s.WarehouseID = &warehouseID
+	s.addEvent(SerialEventQuarantined, ReferenceTypeReturn, returnID, nil, staffID)
+	return nil
+}
+
+// addEvent appends a history entry at the unit's current warehouse
+func (s *SerialNumber) addEvent(eventType SerialEventType, referenceType ReferenceType, referenceID uint, shipmentID *uint, staffID uint) {
+	s.History = append(s.History, SerialEvent{
+		SerialID:      s.SerialID,
+		Type:          eventType,
+		WarehouseID:   s.WarehouseID,
+		ReferenceType: referenceType,
+		ReferenceID:   referenceID,
+		ShipmentID:    shipmentID,
+		StaffID:       staffID,
+		CreatedAt:     time.Now(),
+	})
+}
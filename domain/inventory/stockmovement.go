@@ -13,6 +13,8 @@ const (
 	MovementTypeIn       MovementType = "in"
 	MovementTypeOut      MovementType = "out"
 	MovementTypeTransfer MovementType = "transfer"
+	MovementTypeReserve  MovementType = "reserve"
+	MovementTypeRelease  MovementType = "release"
 )
 
 // ReferenceType represents the source of a stock movement
@@ -24,6 +26,7 @@ const (
 	ReferenceTypeAdjustment   ReferenceType = "adjustment"
 	ReferenceTypeReturn       ReferenceType = "return"
 	ReferenceTypeTransfer     ReferenceType = "transfer"
+	ReferenceTypeRelocation   ReferenceType = "relocation"
 )
 
 // StockMovement represents a change in inventory stock
@@ -37,8 +40,31 @@ type StockMovement struct {
 	Type          MovementType  `json:"type"`
 	ReferenceType ReferenceType `json:"reference_type"`
 	ReferenceID   uint         `json:"reference_id"`
+	LotNumber     string       `json:"lot_number,omitempty"`
+	ExpiryDate    *time.Time   `json:"expiry_date,omitempty"` // Expiry of the lot, kept so the lot can be rebuilt elsewhere
+	FromLocationID *uint       `json:"from_location_id,omitempty"`
+	ToLocationID  *uint        `json:"to_location_id,omitempty"`
 	Notes         string       `json:"notes"`
 	CreatedAt     time.Time    `json:"created_at"`
 	StaffID       uint         `json:"staff_id"`
 	Warehouse     *Warehouse   `json:"warehouse,omitempty"`
 }
+
+// AffectsOnHand reports whether the movement changes the on-hand quantity.
+// Reserve and release movements only move stock between available and reserved,
+// and transfer movements only move it between bins in the same warehouse.
+func (m *StockMovement) AffectsOnHand() bool {
+	return m.Type == MovementTypeIn || m.Type == MovementTypeOut
+}
+
+// OnHandDelta returns the signed change the movement made to the on-hand quantity
+func (m *StockMovement) OnHandDelta() int {
+	switch m.Type {
+	case MovementTypeIn:
+		return m.Quantity
+	case MovementTypeOut:
+		return -m.Quantity
+	default:
+		return 0
+	}
+}
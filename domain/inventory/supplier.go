@@ -2,7 +2,6 @@ package inventory
 
 import (
 	"github.com/hydr0g3nz/ecom_mid/domain/common"
-	"github.com/hydr0g3nz/ecom_mid/domain/common/vo"
 )
 
 // SupplierStatus represents the status of a supplier
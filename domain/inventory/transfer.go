@@ -0,0 +1,174 @@
+package inventory
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common"
+	"github.com/hydr0g3nz/ecom_mid/domain/common/vo"
+)
+
+// StockTransferStatus represents the status of a stock transfer
+type StockTransferStatus string
+
+const (
+	TransferStatusDraft      StockTransferStatus = "draft"
+	TransferStatusDispatched StockTransferStatus = "dispatched"
+	TransferStatusReceived   StockTransferStatus = "received"
+	TransferStatusCancelled  StockTransferStatus = "cancelled"
+)
+
+// StockTransfer represents a movement of stock from one warehouse to another
+type StockTransfer struct {
+	common.Entity
+	TransferID             uint                `json:"transfer_id"`
+	SourceWarehouseID      uint                `json:"source_warehouse_id"`
+	DestinationWarehouseID uint                `json:"destination_warehouse_id"`
+	Status                 StockTransferStatus `json:"status"`
+	Notes                  string              `json:"notes"`
+	StaffID                uint                `json:"staff_id"`
+	DispatchedAt           *time.Time          `json:"dispatched_at,omitempty"`
+	ReceivedAt             *time.Time          `json:"received_at,omitempty"`
+	SourceWarehouse        *Warehouse          `json:"source_warehouse,omitempty"`
+	DestinationWarehouse   *Warehouse          `json:"destination_warehouse,omitempty"`
+	Items                  []StockTransferItem `json:"items,omitempty"`
+}
+
+// StockTransferItem represents a line item in a stock transfer
+type StockTransferItem struct {
+	common.Entity
+	TransferItemID uint          `json:"transfer_item_id"`
+	TransferID     uint          `json:"transfer_id"`
+	ProductID      uint          `json:"product_id"`
+	VariantID      *uint         `json:"variant_id,omitempty"`
+	Quantity       int           `json:"quantity"`
+	UnitCost       *vo.Money     `json:"unit_cost,omitempty"`      // Cost carried from the source warehouse, set on dispatch
+	Lots           []LotQuantity `json:"lots,omitempty"`           // Lots drawn from the source warehouse, set on dispatch
+	SerialNumbers  []string      `json:"serial_numbers,omitempty"` // Units sent, for serialized products, set on dispatch
+}
+
+// NewStockTransfer creates a new draft transfer with validation
+func NewStockTransfer(sourceWarehouseID, destinationWarehouseID, staffID uint, notes string) (*StockTransfer, error) {
+	if sourceWarehouseID == 0 || destinationWarehouseID == 0 {
+		return nil, errors.New("source and destination warehouses are required")
+	}
+
+	if sourceWarehouseID == destinationWarehouseID {
+		return nil, errors.New("source and destination warehouses must differ")
+	}
+
+	return &StockTransfer{
+		SourceWarehouseID:      sourceWarehouseID,
+		DestinationWarehouseID: destinationWarehouseID,
+		Status:                 TransferStatusDraft,
+		Notes:                  notes,
+		StaffID:                staffID,
+		Items:                  []StockTransferItem{},
+	}, nil
+}
+
+// AddItem adds a product to the transfer
+func (t *StockTransfer) AddItem(item StockTransferItem) error {
+	if t.Status != TransferStatusDraft {
+		return errors.New("can only add items to a draft transfer")
+	}
+
+	if item.Quantity <= 0 {
+		return errors.New("quantity must be greater than zero")
+	}
+
+	// If same product and variant, just update quantity
+	for i, existingItem := range t.Items {
+		if existingItem.ProductID == item.ProductID && SameVariant(existingItem.VariantID, item.VariantID) {
+			t.Items[i].Quantity += item.Quantity
+			return nil
+		}
+	}
+
+	item.TransferID = t.TransferID
+	t.Items = append(t.Items, item)
+	return nil
+}
+
+// RemoveItem removes an item from the transfer
+func (t *StockTransfer) RemoveItem(itemID uint) error {
+	if t.Status != TransferStatusDraft {
+		return errors.New("can only remove items from a draft transfer")
+	}
+
+	for i, item := range t.Items {
+		if item.TransferItemID == itemID {
+			t.Items = append(t.Items[:i], t.Items[i+1:]...)
+			return nil
+		}
+	}
+
+	return errors.New("item not found in transfer")
+}
+
+// Dispatch marks the transfer as having left the source warehouse
+func (t *StockTransfer) Dispatch() error {
+	if t.Status != TransferStatusDraft {
+		return errors.New("only draft transfers can be dispatched")
+	}
+
+	if len(t.Items) == 0 {
+		return errors.New("cannot dispatch an empty transfer")
+	}
+
+	now := time.Now()
+	t.Status = TransferStatusDispatched
+	t.DispatchedAt = &now
+	return nil
+}
+
+// Receive marks the transfer as having arrived at the destination warehouse
+func (t *StockTransfer) Receive() error {
+	if t.Status != TransferStatusDispatched {
+		return errors.New("only dispatched transfers can be received")
+	}
+
+	now := time.Now()
+	t.Status = TransferStatusReceived
+	t.ReceivedAt = &now
+	return nil
+}
+
+// Cancel cancels a transfer that has not yet been dispatched
+func (t *StockTransfer) Cancel() error {
+	if t.Status != TransferStatusDraft {
+		return errors.New("only draft transfers can be cancelled")
+	}
+
+	t.Status = TransferStatusCancelled
+	return nil
+}
+
+// IsInTransit checks if the transfer has left the source but not yet arrived
+func (t *StockTransfer) IsInTransit() bool {
+	return t.Status == TransferStatusDispatched
+}
+
+// QuantityInTransit returns the quantity of a product currently in transit on this transfer
+func (t *StockTransfer) QuantityInTransit(productID uint, variantID *uint) int {
+	if !t.IsInTransit() {
+		return 0
+	}
+
+	quantity := 0
+	for _, item := range t.Items {
+		if item.ProductID == productID && SameVariant(item.VariantID, variantID) {
+			quantity += item.Quantity
+		}
+	}
+
+	return quantity
+}
+
+// SameVariant checks if two optional variant IDs refer to the same variant
+func SameVariant(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
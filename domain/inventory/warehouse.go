@@ -0,0 +1,147 @@
+package inventory
+
+import (
+	"errors"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common"
+)
+
+// WarehouseStatus represents the status of a warehouse
+type WarehouseStatus string
+
+const (
+	WarehouseStatusActive   WarehouseStatus = "active"
+	WarehouseStatusInactive WarehouseStatus = "inactive"
+)
+
+// Warehouse represents a physical location where stock is held
+type Warehouse struct {
+	common.Entity
+	WarehouseID  uint                   `json:"warehouse_id"`
+	Name         string                 `json:"name"`
+	Address      string                 `json:"address"`
+	Province     string                 `json:"province"`
+	Phone        string                 `json:"phone"`
+	Email        string                 `json:"email"`
+	Status       WarehouseStatus        `json:"status"`
+	Priority     int                    `json:"priority"`
+	PickupOnly   bool                   `json:"pickup_only"`
+	ServesAll    bool                   `json:"serves_all"` // Delivers to every province, whatever its service areas
+	ServiceAreas []WarehouseServiceArea `json:"service_areas,omitempty"`
+}
+
+// WarehouseServiceArea represents a province a warehouse delivers to
+type WarehouseServiceArea struct {
+	common.Entity
+	ServiceAreaID uint   `json:"service_area_id"`
+	WarehouseID   uint   `json:"warehouse_id"`
+	Province      string `json:"province"`
+}
+
+// NewWarehouse creates a new active warehouse with validation
+func NewWarehouse(name, address, province, phone, email string) (*Warehouse, error) {
+	if name == "" {
+		return nil, errors.New("name cannot be empty")
+	}
+
+	if address == "" {
+		return nil, errors.New("address cannot be empty")
+	}
+
+	return &Warehouse{
+		Name:         name,
+		Address:      address,
+		Province:     province,
+		Phone:        phone,
+		Email:        email,
+		Status:       WarehouseStatusActive,
+		ServiceAreas: []WarehouseServiceArea{},
+	}, nil
+}
+
+// IsActive checks if the warehouse is active
+func (w *Warehouse) IsActive() bool {
+	return w.Status == WarehouseStatusActive
+}
+
+// Activate sets the warehouse status to active
+func (w *Warehouse) Activate() {
+	w.Status = WarehouseStatusActive
+}
+
+// Deactivate sets the warehouse status to inactive
+func (w *Warehouse) Deactivate() {
+	w.Status = WarehouseStatusInactive
+}
+
+// SetPriority sets the fulfilment priority (lower values are preferred)
+func (w *Warehouse) SetPriority(priority int) error {
+	if priority < 0 {
+		return errors.New("priority cannot be negative")
+	}
+
+	w.Priority = priority
+	return nil
+}
+
+// CanShip checks if the warehouse can ship orders rather than only serve pickups
+func (w *Warehouse) CanShip() bool {
+	return w.IsActive() && !w.PickupOnly
+}
+
+// AddServiceArea adds a province to the warehouse's delivery area
+func (w *Warehouse) AddServiceArea(province string) error {
+	if province == "" {
+		return errors.New("province cannot be empty")
+	}
+
+	// Check if province is already served
+	for _, area := range w.ServiceAreas {
+		if area.Province == province {
+			return nil
+		}
+	}
+
+	w.ServiceAreas = append(w.ServiceAreas, WarehouseServiceArea{
+		WarehouseID: w.WarehouseID,
+		Province:    province,
+	})
+	return nil
+}
+
+// RemoveServiceArea removes a province from the warehouse's delivery area
+func (w *Warehouse) RemoveServiceArea(province string) {
+	updatedAreas := []WarehouseServiceArea{}
+	for _, area := range w.ServiceAreas {
+		if area.Province != province {
+			updatedAreas = append(updatedAreas, area)
+		}
+	}
+	w.ServiceAreas = updatedAreas
+}
+
+// ServeAllProvinces makes the warehouse deliver nationwide
+func (w *Warehouse) ServeAllProvinces() {
+	w.ServesAll = true
+}
+
+// ServeListedProvinces limits the warehouse to its own province and its service areas
+func (w *Warehouse) ServeListedProvinces() {
+	w.ServesAll = false
+}
+
+// Serves checks if the warehouse delivers to a province. Only warehouses marked as
+// serving every province deliver beyond their own province and service areas.
+func (w *Warehouse) Serves(province string) bool {
+	if w.ServesAll || w.Province == province {
+		return true
+	}
+
+	for _, area := range w.ServiceAreas {
+		if area.Province == province {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,199 @@
+package order
+
+import (
+	"time"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common/vo"
+)
+
+// TransactionType represents the step of a payment a transaction records
+type TransactionType string
+
+const (
+	TransactionTypeAuthorization TransactionType = "authorization"
+	TransactionTypeCapture       TransactionType = "capture"
+	TransactionTypeVoid          TransactionType = "void"
+	TransactionTypeRefund        TransactionType = "refund"
+)
+
+// GatewayResult is a payment gateway's answer to a request
+type GatewayResult struct {
+	Approved             bool   `json:"approved"`
+	Pending              bool   `json:"pending"` // Accepted, with the outcome confirmed later through a webhook
+	GatewayTransactionID string `json:"gateway_transaction_id"`
+	ReferenceNumber      string `json:"reference_number"`
+	Response             string `json:"response"` // Raw response, kept for disputes and support
+}
+
+// PaymentGateway moves money through a payment provider. A declined request is
+// reported through GatewayResult.Approved; an error means the provider could not
+// be reached or did not understand the request. The provider carries out a request
+// once per idempotency key and answers a repeat of the key with its first answer,
+// so a request sent again after a failure never moves money twice.
+type PaymentGateway interface {
+	Authorize(order *Order, amount vo.Money, idempotencyKey string) (GatewayResult, error)
+	Capture(authorizationID string, amount vo.Money, idempotencyKey string) (GatewayResult, error)
+	Void(authorizationID string, idempotencyKey string) (GatewayResult, error)
+	Refund(captureID string, amount vo.Money, idempotencyKey string) (GatewayResult, error)
+}
+
+// NewGatewayTransaction records one step of a payment from the gateway's answer.
+// parent is the transaction the step acts on: the authorization for a capture or
+// void, the capture for a refund. refundID is the Refund a refund step pays back.
+func NewGatewayTransaction(
+	order *Order,
+	paymentMethodID uint,
+	transactionType TransactionType,
+	amount vo.Money,
+	result GatewayResult,
+	parent *Transaction,
+	refundID *uint,
+) *Transaction {
+	transaction := &Transaction{
+		OrderID:              order.OrderID,
+		PaymentMethodID:      paymentMethodID,
+		Type:                 transactionType,
+		TransactionDate:      time.Now(),
+		Amount:               amount,
+		Status:               PaymentStatusFailed,
+		ReferenceNumber:      result.ReferenceNumber,
+		GatewayResponse:      result.Response,
+		GatewayTransactionID: result.GatewayTransactionID,
+		RefundID:             refundID,
+	}
+
+	if parent != nil {
+		parentID := parent.TransactionID
+		transaction.ParentTransactionID = &parentID
+	}
+
+	if result.Pending {
+		transaction.Status = PaymentStatusPending
+	} else if result.Approved {
+		transaction.Status = transactionType.approvedStatus()
+	}
+
+	return transaction
+}
+
+// approvedStatus is the status a step leaves its transaction in when the gateway approves it
+func (t TransactionType) approvedStatus() PaymentStatus {
+	switch t {
+	case TransactionTypeAuthorization:
+		return PaymentStatusAuthorized
+	case TransactionTypeVoid:
+		return PaymentStatusVoided
+	case TransactionTypeRefund:
+		return PaymentStatusRefunded
+	default:
+		return PaymentStatusPaid
+	}
+}
+
+// IsDeclined checks if the gateway turned the step down
+func (t *Transaction) IsDeclined() bool {
+	return t.Status == PaymentStatusFailed
+}
+
+// IsPending checks if the gateway has yet to confirm the step
+func (t *Transaction) IsPending() bool {
+	return t.Status == PaymentStatusPending
+}
+
+// ApplyGatewayStatus moves the transaction to a status the gateway reported after the fact.
+// It reports whether the status changed; a report that would move the transaction backwards,
+// such as a late or repeated one, is ignored.
+func (t *Transaction) ApplyGatewayStatus(status PaymentStatus) bool {
+	if !t.canAdvanceTo(status) {
+		return false
+	}
+
+	t.Status = status
+	return true
+}
+
+// canAdvanceTo checks if the gateway can move the transaction on to a status. A gateway
+// refund only ever goes from pending to refunded or failed; other steps move like payments.
+func (t *Transaction) canAdvanceTo(status PaymentStatus) bool {
+	if t.Type == TransactionTypeRefund {
+		return t.IsPending() && (status == PaymentStatusRefunded || status == PaymentStatusFailed)
+	}
+	return CanAdvancePaymentStatus(t.Status, status)
+}
+
+// OrderPaymentStatus is the payment status the transaction's step gives its order,
+// with false when the step does not decide it
+func (t *Transaction) OrderPaymentStatus() (PaymentStatus, bool) {
+	switch {
+	case t.Type == TransactionTypeRefund:
+		// Refunds move the order through their Refund records
+		return "", false
+	case t.Type == TransactionTypeCapture && t.IsDeclined():
+		// The authorization is still open
+		return "", false
+	case t.IsPending():
+		return "", false
+	}
+	return t.Status, true
+}
+
+// paymentStatusTransitions lists the statuses a payment can move on to from each status.
+// Only money that was taken can be refunded.
+var paymentStatusTransitions = map[PaymentStatus][]PaymentStatus{
+	PaymentStatusPending:           {PaymentStatusAuthorized, PaymentStatusPaid, PaymentStatusVoided, PaymentStatusFailed},
+	PaymentStatusAuthorized:        {PaymentStatusPaid, PaymentStatusVoided, PaymentStatusFailed},
+	PaymentStatusPaid:              {PaymentStatusPartiallyRefunded, PaymentStatusRefunded},
+	PaymentStatusPartiallyRefunded: {PaymentStatusRefunded},
+	PaymentStatusFailed:            {PaymentStatusAuthorized, PaymentStatusPaid}, // A declined order can be paid again
+}
+
+// CanAdvancePaymentStatus checks if a payment can move from one status to another
+func CanAdvancePaymentStatus(from PaymentStatus, to PaymentStatus) bool {
+	for _, next := range paymentStatusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// CompletedCapture returns the capture among an order's transactions the gateway
+// confirmed, or nil
+func CompletedCapture(transactions []*Transaction) *Transaction {
+	for _, transaction := range transactions {
+		if transaction.Type == TransactionTypeCapture && !transaction.IsDeclined() && !transaction.IsPending() {
+			return transaction
+		}
+	}
+	return nil
+}
+
+// PendingPayment returns the authorization or capture among an order's transactions
+// the gateway has yet to confirm, or nil
+func PendingPayment(transactions []*Transaction) *Transaction {
+	for _, transaction := range transactions {
+		if (transaction.Type == TransactionTypeAuthorization || transaction.Type == TransactionTypeCapture) && transaction.IsPending() {
+			return transaction
+		}
+	}
+	return nil
+}
+
+// OpenAuthorization returns the approved authorization among an order's transactions
+// that has been neither captured nor voided, or nil
+func OpenAuthorization(transactions []*Transaction) *Transaction {
+	settled := map[uint]bool{}
+	for _, transaction := range transactions {
+		if transaction.ParentTransactionID != nil && !transaction.IsDeclined() &&
+			(transaction.Type == TransactionTypeCapture || transaction.Type == TransactionTypeVoid) {
+			settled[*transaction.ParentTransactionID] = true
+		}
+	}
+
+	for _, transaction := range transactions {
+		if transaction.Type == TransactionTypeAuthorization && transaction.Status == PaymentStatusAuthorized && !settled[transaction.TransactionID] {
+			return transaction
+		}
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package order
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/hydr0g3nz/ecom_mid/domain/common"
@@ -15,6 +16,7 @@ type OrderStatus string
 const (
 	OrderStatusPending    OrderStatus = "pending"
 	OrderStatusProcessing OrderStatus = "processing"
+	OrderStatusPartiallyShipped OrderStatus = "partially_shipped"
 	OrderStatusShipped    OrderStatus = "shipped"
 	OrderStatusDelivered  OrderStatus = "delivered"
 	OrderStatusCancelled  OrderStatus = "cancelled"
@@ -25,9 +27,12 @@ type PaymentStatus string
 
 const (
 	PaymentStatusPending  PaymentStatus = "pending"
+	PaymentStatusAuthorized PaymentStatus = "authorized" // Held by the gateway, not yet captured
 	PaymentStatusPaid     PaymentStatus = "paid"
 	PaymentStatusFailed   PaymentStatus = "failed"
 	PaymentStatusRefunded PaymentStatus = "refunded"
+	PaymentStatusPartiallyRefunded PaymentStatus = "partially_refunded"
+	PaymentStatusVoided   PaymentStatus = "voided"
 )
 
 // Order represents a customer's order
@@ -67,6 +72,7 @@ type OrderItem struct {
 	OrderID     uint    `json:"order_id"`
 	ProductID   uint    `json:"product_id"`
 	VariantID   *uint   `json:"variant_id,omitempty"`
+	WarehouseID *uint   `json:"warehouse_id,omitempty"` // Holds the reservation for units not yet shipped; shipments may pick from others
 	SKU         string  `json:"sku"`
 	Name        string  `json:"name"`
 	Quantity    int     `json:"quantity"`
@@ -75,6 +81,28 @@ type OrderItem struct {
 	Tax         vo.Money `json:"tax"`
 	Discount    vo.Money `json:"discount"`
 	Total       vo.Money `json:"total"`
+	CostOfGoods *vo.Money `json:"cost_of_goods,omitempty"` // Snapshot taken when the stock is shipped
+	SerialNumbers []string `json:"serial_numbers,omitempty"`
+	IsBackordered bool     `json:"is_backordered"` // Waiting for stock; no warehouse holds a reservation yet
+	ReleaseDate   *time.Time `json:"release_date,omitempty"` // Set on pre-order items, which cannot ship before it
+	ExpectedShipDate *time.Time `json:"expected_ship_date,omitempty"`
+	Components    []OrderItemComponent `json:"components,omitempty"` // Set on bundle items, whose stock is held by the components
+	IsDropship    bool     `json:"is_dropship"`
+	PurchaseOrderID *uint  `json:"purchase_order_id,omitempty"` // Dropship purchase order raised once the order is paid
+}
+
+// OrderItemComponent is the stock behind one component of a bundle order item
+type OrderItemComponent struct {
+	common.Entity
+	OrderItemComponentID uint     `json:"order_item_component_id"`
+	OrderItemID          uint     `json:"order_item_id"`
+	ProductID            uint     `json:"product_id"`
+	VariantID            *uint    `json:"variant_id,omitempty"`
+	WarehouseID          *uint    `json:"warehouse_id,omitempty"`
+	SKU                  string   `json:"sku"`
+	Quantity             int      `json:"quantity"` // Units for the whole line: the quantity per bundle times the bundles ordered
+	Revenue              vo.Money `json:"revenue"`  // Share of the bundle item's total
+	CostOfGoods          *vo.Money `json:"cost_of_goods,omitempty"`
 }
 
 // OrderStatusHistory represents a change in order status
@@ -357,17 +385,213 @@ func (o *Order) UpdatePaymentStatus(status PaymentStatus) {
 	}
 }
 
-// AddShipment adds a shipment to the order
+// AwaitsPayment checks if the order can still be paid for: nothing has been
+// authorized or captured, or the last attempt was declined
+func (o *Order) AwaitsPayment() bool {
+	return o.PaymentStatus == PaymentStatusPending || o.PaymentStatus == PaymentStatusFailed
+}
+
+// AddShipment adds a shipment of some or all of the order's items. The order is shipped
+// once every item is covered and partially shipped until then.
 func (o *Order) AddShipment(shipment Shipment) error {
-	if o.Status != OrderStatusProcessing {
-		return errors.New("can only add shipment to processing orders")
+	if !o.IsShippable() {
+		return errors.New("can only add shipment to processing or partially shipped orders")
+	}
+	
+	err := o.checkShipmentLines(shipment.Lines)
+	if err != nil {
+		return err
+	}
+	
+	shipment.OrderID = o.OrderID
+	o.Shipments = append(o.Shipments, shipment)
+	
+	return o.updateShippingStatus("Order shipped")
+}
+
+// AddSupplierShipment adds a shipment a dropship supplier sent straight to the customer.
+// Without lines it carries everything still unshipped on the purchase order's items.
+func (o *Order) AddSupplierShipment(shipment Shipment) error {
+	if !o.IsShippable() {
+		return errors.New("can only add shipment to processing or partially shipped orders")
+	}
+	
+	if shipment.POID == nil {
+		return errors.New("supplier shipment must reference its purchase order")
+	}
+	
+	if len(shipment.Lines) == 0 {
+		for _, item := range o.Items {
+			if item.PurchaseOrderID == nil || *item.PurchaseOrderID != *shipment.POID {
+				continue
+			}
+			
+			remaining := o.RemainingQuantity(item.OrderItemID)
+			if remaining > 0 {
+				shipment.Lines = append(shipment.Lines, ShipmentLine{OrderItemID: item.OrderItemID, Quantity: remaining})
+			}
+		}
+	}
+	
+	err := o.checkShipmentLines(shipment.Lines)
+	if err != nil {
+		return err
 	}
 	
 	shipment.OrderID = o.OrderID
 	o.Shipments = append(o.Shipments, shipment)
 	
-	// Update order status to shipped
-	return o.UpdateStatus(OrderStatusShipped, "Order shipped", nil)
+	return o.updateShippingStatus("Order shipped by supplier")
+}
+
+// IsShippable checks if the order can take another shipment
+func (o *Order) IsShippable() bool {
+	return o.Status == OrderStatusProcessing || o.Status == OrderStatusPartiallyShipped
+}
+
+// ShippedQuantity returns how many units of an item have left on shipments
+func (o *Order) ShippedQuantity(orderItemID uint) int {
+	total := 0
+	for i := range o.Shipments {
+		total += o.Shipments[i].QuantityOf(orderItemID)
+	}
+	return total
+}
+
+// RemainingQuantity returns how many units of an item are still to ship
+func (o *Order) RemainingQuantity(orderItemID uint) int {
+	for _, item := range o.Items {
+		if item.OrderItemID == orderItemID {
+			return item.Quantity - o.ShippedQuantity(orderItemID)
+		}
+	}
+	return 0
+}
+
+// IsFullyShipped checks if every item has shipped in full
+func (o *Order) IsFullyShipped() bool {
+	for _, item := range o.Items {
+		if o.RemainingQuantity(item.OrderItemID) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// DeliverShipment marks one of the order's shipments delivered. The order is delivered
+// once it has shipped in full and every shipment has arrived.
+func (o *Order) DeliverShipment(shipmentID uint, staffID *uint) (*Shipment, error) {
+	var shipment *Shipment
+	for i := range o.Shipments {
+		if o.Shipments[i].ShipmentID == shipmentID {
+			shipment = &o.Shipments[i]
+			break
+		}
+	}
+	
+	if shipment == nil {
+		return nil, errors.New("shipment not found on this order")
+	}
+	
+	if shipment.Status != ShipmentStatusShipped {
+		return nil, errors.New("can only deliver shipped shipments")
+	}
+	shipment.MarkAsDelivered()
+	
+	if o.Status != OrderStatusShipped {
+		return shipment, nil
+	}
+	
+	for _, other := range o.Shipments {
+		if other.Status != ShipmentStatusDelivered {
+			return shipment, nil
+		}
+	}
+	
+	return shipment, o.UpdateStatus(OrderStatusDelivered, "Order delivered", staffID)
+}
+
+// findItem returns the order item with an ID, or nil
+func (o *Order) findItem(itemID uint) *OrderItem {
+	for i := range o.Items {
+		if o.Items[i].OrderItemID == itemID {
+			return &o.Items[i]
+		}
+	}
+	return nil
+}
+
+// checkShipmentLines verifies that shipment lines name the order's items and
+// do not ship more of any item than is left to ship
+func (o *Order) checkShipmentLines(lines []ShipmentLine) error {
+	if len(lines) == 0 {
+		return errors.New("shipment must carry at least one item")
+	}
+	
+	shipping := map[uint]int{}
+	for _, line := range lines {
+		if line.Quantity <= 0 {
+			return errors.New("shipment line quantity must be greater than zero")
+		}
+		shipping[line.OrderItemID] += line.Quantity
+	}
+	
+	for itemID, quantity := range shipping {
+		item := o.findItem(itemID)
+		if item == nil {
+			return errors.New("shipment line does not belong to this order")
+		}
+		
+		if quantity > o.RemainingQuantity(itemID) {
+			return fmt.Errorf("shipment carries more of %s than is left to ship", item.SKU)
+		}
+	}
+	
+	return nil
+}
+
+// updateShippingStatus moves the order to shipped once every item is covered,
+// or to partially shipped after its first shipment
+func (o *Order) updateShippingStatus(comment string) error {
+	if o.IsFullyShipped() {
+		return o.UpdateStatus(OrderStatusShipped, comment, nil)
+	}
+	
+	if o.Status == OrderStatusProcessing {
+		return o.UpdateStatus(OrderStatusPartiallyShipped, "Order partially shipped", nil)
+	}
+	
+	return nil
+}
+
+// RefreshShippingStatus moves a shippable order on to match the shipments it already has,
+// such as one recorded before the order itself could be saved
+func (o *Order) RefreshShippingStatus(comment string) error {
+	if !o.IsShippable() {
+		return nil
+	}
+	
+	return o.updateShippingStatus(comment)
+}
+
+// FindSupplierShipment returns the shipment recorded for a dropship purchase order
+func (o *Order) FindSupplierShipment(poID uint) *Shipment {
+	for i := range o.Shipments {
+		if o.Shipments[i].POID != nil && *o.Shipments[i].POID == poID {
+			return &o.Shipments[i]
+		}
+	}
+	return nil
+}
+
+// AwaitsPurchaseOrders checks if a dropship item has not been passed on to its supplier yet
+func (o *Order) AwaitsPurchaseOrders() bool {
+	for _, item := range o.Items {
+		if item.IsDropship && item.PurchaseOrderID == nil {
+			return true
+		}
+	}
+	return false
 }
 
 // Cancel cancels the order
@@ -379,12 +603,176 @@ func (o *Order) Cancel(reason string, staffID *uint) error {
 	return o.UpdateStatus(OrderStatusCancelled, reason, staffID)
 }
 
+// AllocateBackorder records that stock for a backordered item has been reserved in a warehouse
+func (o *Order) AllocateBackorder(itemID uint, warehouseID uint) error {
+	for i, item := range o.Items {
+		if item.OrderItemID != itemID {
+			continue
+		}
+		
+		if !item.IsBackordered {
+			return errors.New("item is not backordered")
+		}
+		
+		// The stock is here, so the item ships as soon as it is released
+		shipDate := time.Now()
+		if item.ReleaseDate != nil && item.ReleaseDate.After(shipDate) {
+			shipDate = *item.ReleaseDate
+		}
+		
+		o.Items[i].IsBackordered = false
+		o.Items[i].WarehouseID = &warehouseID
+		o.Items[i].ExpectedShipDate = &shipDate
+		return nil
+	}
+	
+	return errors.New("item not found in order")
+}
+
+// HasBackorderedItems checks if any item is still waiting for stock
+func (o *Order) HasBackorderedItems() bool {
+	for _, item := range o.Items {
+		if item.IsBackordered {
+			return true
+		}
+	}
+	return false
+}
+
+// IsReleased checks if the item can ship: pre-order items wait for their release date
+func (item *OrderItem) IsReleased() bool {
+	return item.ReleaseDate == nil || !time.Now().Before(*item.ReleaseDate)
+}
+
+// IsBundle checks if the item is a bundle whose stock is held by its components
+func (item *OrderItem) IsBundle() bool {
+	return len(item.Components) > 0
+}
+
+// ComponentUnits returns how many units of a component make up quantity of the bundle
+func (item *OrderItem) ComponentUnits(component OrderItemComponent, quantity int) int {
+	return component.Quantity / item.Quantity * quantity
+}
+
+// AllocateRevenue splits the item's total across its components in proportion to
+// weights, usually each component's list value. Any rounding difference lands on
+// the last component so the shares always add up to the total.
+func (item *OrderItem) AllocateRevenue(weights []vo.Money) error {
+	if len(weights) != len(item.Components) {
+		return errors.New("a weight is needed for every component")
+	}
+	
+	totalWeight := 0.0
+	for _, weight := range weights {
+		if weight.IsNegative() {
+			return errors.New("component weights cannot be negative")
+		}
+		totalWeight += weight.Amount
+	}
+	
+	allocated, _ := vo.NewMoney(0, item.Total.Currency)
+	for i := range item.Components {
+		if i == len(item.Components)-1 {
+			share, err := item.Total.Subtract(allocated)
+			if err != nil {
+				return err
+			}
+			item.Components[i].Revenue = share
+			break
+		}
+		
+		// Components with no list value share the revenue evenly
+		ratio := 1 / float64(len(item.Components))
+		if totalWeight > 0 {
+			ratio = weights[i].Amount / totalWeight
+		}
+		
+		share, err := item.Total.Multiply(ratio)
+		if err != nil {
+			return err
+		}
+		item.Components[i].Revenue = share
+		
+		allocated, err = allocated.Add(share)
+		if err != nil {
+			return err
+		}
+	}
+	
+	return nil
+}
+
+// RevenueFor returns the share of the item's total earned by quantity of its units
+func (item *OrderItem) RevenueFor(quantity int) (vo.Money, error) {
+	if quantity == item.Quantity {
+		return item.Total, nil
+	}
+	
+	return item.Total.Multiply(float64(quantity) / float64(item.Quantity))
+}
+
+// ComponentRevenueFor returns the share of a component's revenue earned by quantity of the bundle
+func (item *OrderItem) ComponentRevenueFor(component OrderItemComponent, quantity int) (vo.Money, error) {
+	if quantity == item.Quantity {
+		return component.Revenue, nil
+	}
+	
+	return component.Revenue.Multiply(float64(quantity) / float64(item.Quantity))
+}
+
+// GrossMargin returns the item's revenue less its cost of goods
+func (item *OrderItem) GrossMargin() (vo.Money, error) {
+	if item.CostOfGoods == nil {
+		return vo.Money{}, errors.New("cost of goods has not been recorded for this item")
+	}
+	
+	return item.Total.Subtract(*item.CostOfGoods)
+}
+
+// CostOfGoods returns the total cost of goods of the order's items
+func (o *Order) CostOfGoods() (vo.Money, error) {
+	total, _ := vo.NewMoney(0, "THB")
+	
+	for _, item := range o.Items {
+		// Cost of goods builds up shipment by shipment, so it is complete only once the item has shipped
+		if item.CostOfGoods == nil || o.ShippedQuantity(item.OrderItemID) < item.Quantity {
+			return vo.Money{}, errors.New("cost of goods has not been recorded for every item")
+		}
+		
+		newTotal, err := total.Add(*item.CostOfGoods)
+		if err != nil {
+			return vo.Money{}, err
+		}
+		total = newTotal
+	}
+	
+	return total, nil
+}
+
+// GrossMargin returns the order's merchandise revenue, net of discount, less its cost of goods.
+// Shipping fees and tax are not part of the margin.
+func (o *Order) GrossMargin() (vo.Money, error) {
+	costOfGoods, err := o.CostOfGoods()
+	if err != nil {
+		return vo.Money{}, err
+	}
+	
+	revenue, err := o.Subtotal.Subtract(o.DiscountAmount)
+	if err != nil {
+		return vo.Money{}, err
+	}
+	
+	return revenue.Subtract(costOfGoods)
+}
+
 // isValidStatusTransition checks if a status transition is valid
 func isValidStatusTransition(current, new OrderStatus) bool {
 	switch current {
 	case OrderStatusPending:
 		return new == OrderStatusProcessing || new == OrderStatusCancelled
 	case OrderStatusProcessing:
+		return new == OrderStatusPartiallyShipped || new == OrderStatusShipped || new == OrderStatusCancelled
+	case OrderStatusPartiallyShipped:
 		return new == OrderStatusShipped || new == OrderStatusCancelled
 	case OrderStatusShipped:
 		return new == OrderStatusDelivered || new == OrderStatusCancelled
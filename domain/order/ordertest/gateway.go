@@ -0,0 +1,216 @@
+// Package ordertest provides test doubles for the order domain
+package ordertest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common/vo"
+	"github.com/hydr0g3nz/ecom_mid/domain/order"
+)
+
+// GatewayName is the gateway name payment methods use to pay through Gateway
+const GatewayName = "fake"
+
+// Gateway is a deterministic in-memory order.PaymentGateway for tests. It issues
+// sequential IDs, declines authorizations above DeclineAbove when it is set, and
+// enforces the rules a real provider would: captures within the authorized amount,
+// voids only before capture, refunds within the captured amount and one answer per
+// idempotency key. With Asynchronous set it answers authorizations, captures and refunds
+// as pending, to be confirmed by a webhook built with Webhook.
+type Gateway struct {
+	DeclineAbove *vo.Money
+	Asynchronous bool
+
+	mu             sync.Mutex
+	sequence       int
+	authorizations map[string]*fakePayment
+	captures       map[string]*fakePayment
+	answers        map[string]order.GatewayResult // First answer to each idempotency key
+	requests       int
+}
+
+// fakePayment is the gateway's record of an authorization or capture
+type fakePayment struct {
+	amount    vo.Money
+	settled   vo.Money // Captured from an authorization, or refunded from a capture
+	voided    bool
+	captureID string
+}
+
+// NewGateway creates a Gateway with no payments
+func NewGateway() *Gateway {
+	return &Gateway{
+		authorizations: map[string]*fakePayment{},
+		captures:       map[string]*fakePayment{},
+		answers:        map[string]order.GatewayResult{},
+	}
+}
+
+// Requests counts the requests that moved money or were declined, leaving out
+// repeats answered from an idempotency key
+func (g *Gateway) Requests() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.requests
+}
+
+// Captured returns the amount captured from an authorization
+func (g *Gateway) Captured(authorizationID string) vo.Money {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.authorizations[authorizationID].settled
+}
+
+// Refunded returns the amount refunded from a capture
+func (g *Gateway) Refunded(captureID string) vo.Money {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.captures[captureID].settled
+}
+
+// Authorize holds amount for an order
+func (g *Gateway) Authorize(ord *order.Order, amount vo.Money, idempotencyKey string) (order.GatewayResult, error) {
+	return g.answer(idempotencyKey, func() (order.GatewayResult, error) {
+		if g.DeclineAbove != nil && amount.Amount > g.DeclineAbove.Amount {
+			return g.result(false, "auth", fmt.Sprintf("declined: %.2f is over the limit", amount.Amount)), nil
+		}
+
+		result := g.result(true, "auth", "authorized")
+		result.Pending = g.Asynchronous
+		g.authorizations[result.GatewayTransactionID] = &fakePayment{amount: amount, settled: vo.Money{Currency: amount.Currency}}
+		return result, nil
+	})
+}
+
+// Capture takes amount of an authorization
+func (g *Gateway) Capture(authorizationID string, amount vo.Money, idempotencyKey string) (order.GatewayResult, error) {
+	return g.answer(idempotencyKey, func() (order.GatewayResult, error) {
+		auth, ok := g.authorizations[authorizationID]
+		if !ok {
+			return order.GatewayResult{}, errors.New("unknown authorization")
+		}
+
+		if auth.voided || auth.captureID != "" || amount.Amount > auth.amount.Amount {
+			return g.result(false, "cap", "declined: authorization cannot be captured"), nil
+		}
+
+		result := g.result(true, "cap", "captured")
+		result.Pending = g.Asynchronous
+		auth.settled = amount
+		auth.captureID = result.GatewayTransactionID
+		g.captures[result.GatewayTransactionID] = &fakePayment{amount: amount, settled: vo.Money{Currency: amount.Currency}}
+		return result, nil
+	})
+}
+
+// Void releases an authorization that has not been captured
+func (g *Gateway) Void(authorizationID string, idempotencyKey string) (order.GatewayResult, error) {
+	return g.answer(idempotencyKey, func() (order.GatewayResult, error) {
+		auth, ok := g.authorizations[authorizationID]
+		if !ok {
+			return order.GatewayResult{}, errors.New("unknown authorization")
+		}
+
+		if auth.voided || auth.captureID != "" {
+			return g.result(false, "void", "declined: authorization cannot be voided"), nil
+		}
+
+		auth.voided = true
+		return g.result(true, "void", "voided"), nil
+	})
+}
+
+// Refund pays back amount of a capture
+func (g *Gateway) Refund(captureID string, amount vo.Money, idempotencyKey string) (order.GatewayResult, error) {
+	return g.answer(idempotencyKey, func() (order.GatewayResult, error) {
+		capture, ok := g.captures[captureID]
+		if !ok {
+			return order.GatewayResult{}, errors.New("unknown capture")
+		}
+
+		refunded, err := capture.settled.Add(amount)
+		if err != nil {
+			return order.GatewayResult{}, err
+		}
+
+		if refunded.Amount > capture.amount.Amount {
+			return g.result(false, "ref", "declined: refund exceeds the captured amount"), nil
+		}
+
+		result := g.result(true, "ref", "refunded")
+		result.Pending = g.Asynchronous
+		capture.settled = refunded
+		return result, nil
+	})
+}
+
+// Webhook builds the payload the gateway would send to report a transaction's status.
+// Sign it with order.SignWebhookPayload to deliver it.
+func (g *Gateway) Webhook(gatewayTransactionID string, status order.PaymentStatus) []byte {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.sequence++
+	payload, _ := json.Marshal(order.WebhookNotification{
+		EventID:              fmt.Sprintf("fake_evt_%d", g.sequence),
+		GatewayTransactionID: gatewayTransactionID,
+		Status:               status,
+	})
+	return payload
+}
+
+// ParseWebhook reads a payload built by Webhook
+func (g *Gateway) ParseWebhook(payload []byte) (order.WebhookNotification, error) {
+	var notification order.WebhookNotification
+	err := json.Unmarshal(payload, &notification)
+	if err != nil {
+		return order.WebhookNotification{}, err
+	}
+
+	if notification.EventID == "" {
+		return order.WebhookNotification{}, errors.New("webhook has no event ID")
+	}
+
+	return notification, nil
+}
+
+// answer carries out a request once per idempotency key and answers repeats of the key
+// with the first answer. A request that fails with an error is not remembered.
+func (g *Gateway) answer(idempotencyKey string, request func() (order.GatewayResult, error)) (order.GatewayResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if idempotencyKey == "" {
+		return order.GatewayResult{}, errors.New("idempotency key is required")
+	}
+
+	if result, ok := g.answers[idempotencyKey]; ok {
+		return result, nil
+	}
+
+	result, err := request()
+	if err != nil {
+		return order.GatewayResult{}, err
+	}
+
+	g.requests++
+	g.answers[idempotencyKey] = result
+	return result, nil
+}
+
+// result builds an answer with the next ID in the sequence
+func (g *Gateway) result(approved bool, prefix string, response string) order.GatewayResult {
+	g.sequence++
+	return order.GatewayResult{
+		Approved:             approved,
+		GatewayTransactionID: fmt.Sprintf("fake_%s_%d", prefix, g.sequence),
+		ReferenceNumber:      fmt.Sprintf("FAKE%06d", g.sequence),
+		Response:             response,
+	}
+}
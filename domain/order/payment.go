@@ -1,11 +1,15 @@
 package order
 
 import (
+	"errors"
 	"github.com/hydr0g3nz/ecom_mid/domain/common"
 	"github.com/hydr0g3nz/ecom_mid/domain/common/vo"
 	"time"
 )
 
+// PermissionApproveRefund is required to approve or reject refunds held for approval
+const PermissionApproveRefund = "approve_refund"
+
 // PaymentMethodFeesType represents the type of fees for a payment method
 type PaymentMethodFeesType string
 
@@ -21,6 +25,7 @@ type PaymentMethod struct {
 	Name            string              `json:"name"`
 	Description     string              `json:"description"`
 	IsActive        bool                `json:"is_active"`
+	Gateway         string              `json:"gateway"` // Name of the PaymentGateway that takes payments for this method
 	FeesType        PaymentMethodFeesType `json:"fees_type"`
 	FeesAmount      float64             `json:"fees_amount"`
 	SortOrder       int                 `json:"sort_order"`
@@ -32,26 +37,42 @@ type Transaction struct {
 	TransactionID        uint          `json:"transaction_id"`
 	OrderID              uint          `json:"order_id"`
 	PaymentMethodID      uint          `json:"payment_method_id"`
+	Type                 TransactionType `json:"type"`
+	ParentTransactionID  *uint         `json:"parent_transaction_id,omitempty"` // Authorization a capture or void settles, or capture a refund pays back
 	TransactionDate      time.Time     `json:"transaction_date"`
 	Amount               vo.Money      `json:"amount"`
 	Status               PaymentStatus `json:"status"`
 	ReferenceNumber      string        `json:"reference_number"`
 	GatewayResponse      string        `json:"gateway_response"`
 	GatewayTransactionID string        `json:"gateway_transaction_id"`
+	RefundID             *uint         `json:"refund_id,omitempty"` // Refund a refund step pays back
+	IsSale               bool          `json:"is_sale"` // Authorization to capture as soon as the gateway approves it
 	Order                *Order        `json:"order,omitempty"`
 	PaymentMethod        *PaymentMethod `json:"payment_method,omitempty"`
 }
 
+// Refund statuses
+const (
+	RefundStatusPending   = "pending" // Waiting for approval
+	RefundStatusProcessed = "processed"
+	RefundStatusRejected  = "rejected"
+	RefundStatusFailed    = "failed" // Declined by the payment gateway
+)
+
 // Refund represents a refund for an order
 type Refund struct {
 	common.Entity
 	RefundID      uint          `json:"refund_id"`
 	OrderID       uint          `json:"order_id"`
 	TransactionID uint          `json:"transaction_id"`
-	Amount        vo.Money      `json:"amount"`
+	ReturnID      *uint         `json:"return_id,omitempty"` // Return the refund pays back, if any
+	Amount        vo.Money      `json:"amount"` // Total paid back, including any shipping and tax
+	ShippingAmount vo.Money     `json:"shipping_amount"`
+	TaxAmount     vo.Money      `json:"tax_amount"`
 	Reason        string        `json:"reason"`
 	Status        string        `json:"status"`
 	RefundDate    time.Time     `json:"refund_date"`
+	RequestedBy   uint          `json:"requested_by"` // Staff member who issued the refund
 	ProcessedBy   *uint         `json:"processed_by,omitempty"`
 	Notes         string        `json:"notes"`
 	Order         *Order        `json:"order,omitempty"`
@@ -71,3 +92,142 @@ func (pm *PaymentMethod) CalculatePaymentFee(amount float64) float64 {
 	// If percentage-based
 	return (amount * pm.FeesAmount) / 100
 }
+
+// NewRefund creates a pending refund against a transaction for an amount of goods,
+// plus any shipping and tax paid back with it
+func NewRefund(transaction *Transaction, goods, shipping, tax vo.Money, reason string, returnID *uint, requestedBy uint) (*Refund, error) {
+	if reason == "" {
+		return nil, errors.New("refund reason is required")
+	}
+	
+	if goods.IsNegative() || shipping.IsNegative() || tax.IsNegative() {
+		return nil, errors.New("refund amounts cannot be negative")
+	}
+	
+	amount, err := goods.Add(shipping)
+	if err != nil {
+		return nil, err
+	}
+	
+	amount, err = amount.Add(tax)
+	if err != nil {
+		return nil, err
+	}
+	
+	if !amount.IsPositive() {
+		return nil, errors.New("refund amount must be greater than zero")
+	}
+	
+	return &Refund{
+		OrderID:        transaction.OrderID,
+		TransactionID:  transaction.TransactionID,
+		ReturnID:       returnID,
+		Amount:         amount,
+		ShippingAmount: shipping,
+		TaxAmount:      tax,
+		Reason:         reason,
+		Status:         RefundStatusPending,
+		RefundDate:     time.Now(),
+		RequestedBy:    requestedBy,
+	}, nil
+}
+
+// IsPending checks if the refund is waiting for approval
+func (r *Refund) IsPending() bool {
+	return r.Status == RefundStatusPending
+}
+
+// Process marks the refund as paid back
+func (r *Refund) Process(staffID uint, notes string) error {
+	return r.decide(RefundStatusProcessed, staffID, notes)
+}
+
+// CheckApprover verifies a staff member may decide the refund: nobody approves
+// or rejects a refund they requested themselves
+func (r *Refund) CheckApprover(staffID uint) error {
+	if r.RequestedBy != 0 && r.RequestedBy == staffID {
+		return errors.New("staff cannot approve their own refund")
+	}
+	
+	return nil
+}
+
+// Fail marks the refund as declined by the payment gateway
+func (r *Refund) Fail(staffID uint, notes string) error {
+	return r.decide(RefundStatusFailed, staffID, notes)
+}
+
+// IsTurnedDown checks if the refund was rejected or declined, so it pays nothing back
+func (r *Refund) IsTurnedDown() bool {
+	return r.Status == RefundStatusRejected || r.Status == RefundStatusFailed
+}
+
+// Reject turns the refund down
+func (r *Refund) Reject(staffID uint, notes string) error {
+	if notes == "" {
+		return errors.New("rejection reason is required")
+	}
+	
+	return r.decide(RefundStatusRejected, staffID, notes)
+}
+
+// decide settles a pending refund
+func (r *Refund) decide(status string, staffID uint, notes string) error {
+	if !r.IsPending() {
+		return errors.New("refund has already been settled")
+	}
+	
+	r.Status = status
+	r.ProcessedBy = &staffID
+	r.Notes = notes
+	return nil
+}
+
+// RefundedAmount sums refunds that are processed or still pending, so a cap can
+// never be overrun by refunds waiting for approval
+func RefundedAmount(refunds []*Refund, currency string) (vo.Money, error) {
+	return sumRefunds(refunds, currency, func(r *Refund) bool {
+		return !r.IsTurnedDown()
+	})
+}
+
+// ProcessedRefundAmount sums the refunds that have been paid back
+func ProcessedRefundAmount(refunds []*Refund, currency string) (vo.Money, error) {
+	return sumRefunds(refunds, currency, func(r *Refund) bool {
+		return r.Status == RefundStatusProcessed
+	})
+}
+
+// sumRefunds adds up the amounts of the refunds matching include
+func sumRefunds(refunds []*Refund, currency string, include func(*Refund) bool) (vo.Money, error) {
+	total, err := vo.NewMoney(0, currency)
+	if err != nil {
+		return vo.Money{}, err
+	}
+	
+	for _, refund := range refunds {
+		if !include(refund) {
+			continue
+		}
+		
+		total, err = total.Add(refund.Amount)
+		if err != nil {
+			return vo.Money{}, err
+		}
+	}
+	
+	return total, nil
+}
+
+// PaymentStatusAfterRefunds works out the payment status once refunded of paid has been paid back
+func PaymentStatusAfterRefunds(paid, refunded vo.Money) PaymentStatus {
+	if !refunded.IsPositive() {
+		return PaymentStatusPaid
+	}
+	
+	if refunded.Amount >= paid.Amount {
+		return PaymentStatusRefunded
+	}
+	
+	return PaymentStatusPartiallyRefunded
+}
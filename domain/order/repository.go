@@ -37,6 +37,7 @@ type TransactionRepository interface {
 	FindByID(id uint) (*Transaction, error)
 	FindByOrder(orderID uint) ([]*Transaction, error)
 	FindByReferenceNumber(refNumber string) (*Transaction, error)
+	FindByGatewayTransactionID(gatewayTransactionID string) (*Transaction, error)
 	FindByStatus(status PaymentStatus) ([]*Transaction, error)
 	FindByDateRange(startDate, endDate time.Time, page, limit int) ([]*Transaction, error)
 	Create(transaction *Transaction) error
@@ -54,6 +55,35 @@ type RefundRepository interface {
 	ProcessRefund(refundID uint, status string, processedBy uint, notes string) error
 }
 
+// RefundUnitOfWork runs the checks and writes for refunds against one payment transaction
+// as one database transaction that holds the payment's row lock, so refunds against a
+// payment are checked against what is left to refund one at a time. Do hands work a
+// repository bound to the transaction and keeps what it wrote only when work returns nil.
+type RefundUnitOfWork interface {
+	Do(transactionID uint, work func(refunds RefundRepository) error) error
+}
+
+// ReturnRequestRepository defines the interface for return request operations
+type ReturnRequestRepository interface {
+	FindByID(id uint) (*ReturnRequest, error)
+	FindByReturnNumber(returnNumber string) (*ReturnRequest, error)
+	FindByOrder(orderID uint) ([]*ReturnRequest, error)
+	FindByStatus(status ReturnStatus, page, limit int) ([]*ReturnRequest, error)
+	Create(returnRequest *ReturnRequest) error
+	Update(returnRequest *ReturnRequest) error
+}
+
+// WebhookEventRepository defines the interface for webhook event operations.
+// Create fails when the gateway's event ID is already recorded for that gateway.
+type WebhookEventRepository interface {
+	FindByID(id uint) (*WebhookEvent, error)
+	FindByGatewayEvent(gateway string, eventID string) (*WebhookEvent, error)
+	FindByTransaction(transactionID uint) ([]*WebhookEvent, error)
+	FindByStatus(status WebhookEventStatus, page, limit int) ([]*WebhookEvent, error)
+	Create(event *WebhookEvent) error
+	Update(event *WebhookEvent) error
+}
+
 // ShipmentRepository defines the interface for shipment operations
 type ShipmentRepository interface {
 	FindByID(id uint) (*Shipment, error)
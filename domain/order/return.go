@@ -0,0 +1,364 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common"
+	"github.com/hydr0g3nz/ecom_mid/domain/common/vo"
+)
+
+// ReturnStatus represents the status of a return request
+type ReturnStatus string
+
+const (
+	ReturnStatusRequested ReturnStatus = "requested"
+	ReturnStatusApproved  ReturnStatus = "approved"
+	ReturnStatusReceived  ReturnStatus = "received"
+	ReturnStatusInspected ReturnStatus = "inspected"
+	ReturnStatusClosed    ReturnStatus = "closed"
+)
+
+// ReturnReason is the customer's reason for returning an item
+type ReturnReason string
+
+const (
+	ReturnReasonDamaged        ReturnReason = "damaged"
+	ReturnReasonDefective      ReturnReason = "defective"
+	ReturnReasonWrongItem      ReturnReason = "wrong_item"
+	ReturnReasonNotAsDescribed ReturnReason = "not_as_described"
+	ReturnReasonNoLongerNeeded ReturnReason = "no_longer_needed"
+	ReturnReasonOther          ReturnReason = "other"
+)
+
+// InspectionOutcome decides where returned stock goes once inspected
+type InspectionOutcome string
+
+const (
+	InspectionOutcomeRestock    InspectionOutcome = "restock"    // Back into sellable inventory
+	InspectionOutcomeQuarantine InspectionOutcome = "quarantine" // Held apart, out of sellable inventory
+)
+
+// RefundMethod is how a closed return is paid back
+type RefundMethod string
+
+const (
+	RefundMethodOriginalPayment RefundMethod = "original_payment"
+	RefundMethodStoreCredit     RefundMethod = "store_credit"
+)
+
+// ReturnRequest is a customer's request to send back items of a delivered order (an RMA)
+type ReturnRequest struct {
+	common.Entity
+	ReturnID      uint         `json:"return_id"`
+	ReturnNumber  string       `json:"return_number"`
+	OrderID       uint         `json:"order_id"`
+	CustomerID    uint         `json:"customer_id"`
+	Status        ReturnStatus `json:"status"`
+	RefundMethod  RefundMethod `json:"refund_method"`
+	WarehouseID   *uint        `json:"warehouse_id,omitempty"` // Warehouse the items came back to
+	RefundAmount  *vo.Money    `json:"refund_amount,omitempty"`
+	RefundID      *uint        `json:"refund_id,omitempty"`
+	StoreCreditID *uint        `json:"store_credit_id,omitempty"`
+	IsRejected    bool         `json:"is_rejected"`
+	Notes         string       `json:"notes"`
+	ApprovedBy    *uint        `json:"approved_by,omitempty"`
+	ApprovedAt    *time.Time   `json:"approved_at,omitempty"`
+	ReceivedAt    *time.Time   `json:"received_at,omitempty"`
+	InspectedAt   *time.Time   `json:"inspected_at,omitempty"`
+	ClosedAt      *time.Time   `json:"closed_at,omitempty"`
+	Items         []ReturnItem `json:"items"`
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+}
+
+// ReturnItem is a quantity of one order item being returned
+type ReturnItem struct {
+	common.Entity
+	ReturnItemID  uint               `json:"return_item_id"`
+	ReturnID      uint               `json:"return_id"`
+	OrderItemID   uint               `json:"order_item_id"`
+	ProductID     uint               `json:"product_id"`
+	VariantID     *uint              `json:"variant_id,omitempty"`
+	Quantity      int                `json:"quantity"`
+	Reason        ReturnReason       `json:"reason"`
+	Notes         string             `json:"notes"`
+	SerialNumbers []string           `json:"serial_numbers,omitempty"` // Units received back, for serialized products
+	Outcome       *InspectionOutcome `json:"outcome,omitempty"`
+	LocationID    *uint              `json:"location_id,omitempty"` // Quarantine bin the items were put in
+}
+
+// NewReturnRequest opens a return against a delivered order. sequence counts the
+// order's returns, this one included, and numbers the return.
+func NewReturnRequest(ord *Order, sequence int, refundMethod RefundMethod, notes string) (*ReturnRequest, error) {
+	if ord.Status != OrderStatusDelivered {
+		return nil, errors.New("only delivered orders can be returned")
+	}
+
+	if refundMethod != RefundMethodOriginalPayment && refundMethod != RefundMethodStoreCredit {
+		return nil, errors.New("invalid refund method")
+	}
+
+	now := time.Now()
+	return &ReturnRequest{
+		ReturnNumber: fmt.Sprintf("RMA-%s-%d", ord.OrderNumber, sequence),
+		OrderID:      ord.OrderID,
+		CustomerID:   ord.CustomerID,
+		Status:       ReturnStatusRequested,
+		RefundMethod: refundMethod,
+		Notes:        notes,
+		Items:        []ReturnItem{},
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}, nil
+}
+
+// AddItem adds quantity of an order item to the return. returnable is how many units
+// of the item have shipped and are not already on another return.
+func (r *ReturnRequest) AddItem(item OrderItem, quantity int, returnable int, reason ReturnReason, notes string) error {
+	if r.Status != ReturnStatusRequested {
+		return errors.New("can only add items to a requested return")
+	}
+
+	if item.OrderID != r.OrderID {
+		return errors.New("item does not belong to the returned order")
+	}
+
+	if !isValidReturnReason(reason) {
+		return errors.New("invalid return reason")
+	}
+
+	if quantity <= 0 {
+		return errors.New("quantity must be greater than zero")
+	}
+
+	for _, existing := range r.Items {
+		if existing.OrderItemID == item.OrderItemID {
+			returnable -= existing.Quantity
+		}
+	}
+
+	if quantity > returnable {
+		return fmt.Errorf("only %d of %s can be returned", max(returnable, 0), item.SKU)
+	}
+
+	r.Items = append(r.Items, ReturnItem{
+		ReturnID:    r.ReturnID,
+		OrderItemID: item.OrderItemID,
+		ProductID:   item.ProductID,
+		VariantID:   item.VariantID,
+		Quantity:    quantity,
+		Reason:      reason,
+		Notes:       notes,
+	})
+	r.UpdatedAt = time.Now()
+	return nil
+}
+
+// Approve accepts the return so the customer can send the items back
+func (r *ReturnRequest) Approve(staffID uint) error {
+	if r.Status != ReturnStatusRequested {
+		return errors.New("can only approve requested returns")
+	}
+
+	if len(r.Items) == 0 {
+		return errors.New("return has no items")
+	}
+
+	now := time.Now()
+	r.Status = ReturnStatusApproved
+	r.ApprovedBy = &staffID
+	r.ApprovedAt = &now
+	r.UpdatedAt = now
+	return nil
+}
+
+// Reject turns the return down and closes it without a refund
+func (r *ReturnRequest) Reject(reason string) error {
+	if r.Status != ReturnStatusRequested && r.Status != ReturnStatusApproved {
+		return errors.New("can only reject returns that have not been received")
+	}
+
+	if reason == "" {
+		return errors.New("rejection reason is required")
+	}
+
+	now := time.Now()
+	r.Status = ReturnStatusClosed
+	r.IsRejected = true
+	r.Notes = reason
+	r.ClosedAt = &now
+	r.UpdatedAt = now
+	return nil
+}
+
+// Receive records the items arriving back in a warehouse
+func (r *ReturnRequest) Receive(warehouseID uint) error {
+	if r.Status != ReturnStatusApproved {
+		return errors.New("can only receive approved returns")
+	}
+
+	now := time.Now()
+	r.Status = ReturnStatusReceived
+	r.WarehouseID = &warehouseID
+	r.ReceivedAt = &now
+	r.UpdatedAt = now
+	return nil
+}
+
+// Inspect records where a returned item's stock goes. The return is inspected
+// once every item has an outcome.
+func (r *ReturnRequest) Inspect(returnItemID uint, outcome InspectionOutcome, locationID *uint) (*ReturnItem, error) {
+	if r.Status != ReturnStatusReceived {
+		return nil, errors.New("can only inspect received returns")
+	}
+
+	if outcome != InspectionOutcomeRestock && outcome != InspectionOutcomeQuarantine {
+		return nil, errors.New("invalid inspection outcome")
+	}
+
+	if outcome == InspectionOutcomeQuarantine && locationID == nil {
+		return nil, errors.New("quarantined items need a quarantine location")
+	}
+
+	item := r.findItem(returnItemID)
+	if item == nil {
+		return nil, errors.New("item not found on this return")
+	}
+
+	if item.Outcome != nil {
+		return nil, errors.New("item has already been inspected")
+	}
+
+	item.Outcome = &outcome
+	item.LocationID = locationID
+
+	now := time.Now()
+	r.UpdatedAt = now
+	if r.IsInspected() {
+		r.Status = ReturnStatusInspected
+		r.InspectedAt = &now
+	}
+	return item, nil
+}
+
+// IsInspected checks if every item has an inspection outcome
+func (r *ReturnRequest) IsInspected() bool {
+	for _, item := range r.Items {
+		if item.Outcome == nil {
+			return false
+		}
+	}
+	return len(r.Items) > 0
+}
+
+// RefundableAmount works out what the return is worth: each item's share of
+// the order line's total for the quantity returned
+func (r *ReturnRequest) RefundableAmount(ord *Order) (vo.Money, error) {
+	total, err := vo.NewMoney(0, ord.TotalAmount.Currency)
+	if err != nil {
+		return vo.Money{}, err
+	}
+
+	for _, returned := range r.Items {
+		item := ord.findItem(returned.OrderItemID)
+		if item == nil {
+			return vo.Money{}, errors.New("returned item is no longer on the order")
+		}
+
+		share, err := item.Total.Multiply(float64(returned.Quantity) / float64(item.Quantity))
+		if err != nil {
+			return vo.Money{}, err
+		}
+
+		total, err = total.Add(share)
+		if err != nil {
+			return vo.Money{}, err
+		}
+	}
+
+	return total, nil
+}
+
+// CloseWithRefund closes an inspected return paid back through a refund
+func (r *ReturnRequest) CloseWithRefund(amount vo.Money, refundID uint) error {
+	if r.RefundMethod != RefundMethodOriginalPayment {
+		return errors.New("return is paid back in store credit")
+	}
+
+	err := r.close(amount)
+	if err != nil {
+		return err
+	}
+
+	r.RefundID = &refundID
+	return nil
+}
+
+// CloseWithStoreCredit closes an inspected return paid back in store credit
+func (r *ReturnRequest) CloseWithStoreCredit(amount vo.Money, storeCreditID uint) error {
+	if r.RefundMethod != RefundMethodStoreCredit {
+		return errors.New("return is paid back to the original payment")
+	}
+
+	err := r.close(amount)
+	if err != nil {
+		return err
+	}
+
+	r.StoreCreditID = &storeCreditID
+	return nil
+}
+
+// close marks an inspected return closed with the amount paid back
+func (r *ReturnRequest) close(amount vo.Money) error {
+	if r.Status != ReturnStatusInspected {
+		return errors.New("can only close inspected returns")
+	}
+
+	now := time.Now()
+	r.Status = ReturnStatusClosed
+	r.RefundAmount = &amount
+	r.ClosedAt = &now
+	r.UpdatedAt = now
+	return nil
+}
+
+// findItem returns the return item with an ID, or nil
+func (r *ReturnRequest) findItem(returnItemID uint) *ReturnItem {
+	for i := range r.Items {
+		if r.Items[i].ReturnItemID == returnItemID {
+			return &r.Items[i]
+		}
+	}
+	return nil
+}
+
+// ReturnedQuantity sums the units of an order item on returns that were not rejected
+func ReturnedQuantity(returns []*ReturnRequest, orderItemID uint) int {
+	total := 0
+	for _, r := range returns {
+		if r.IsRejected {
+			continue
+		}
+
+		for _, item := range r.Items {
+			if item.OrderItemID == orderItemID {
+				total += item.Quantity
+			}
+		}
+	}
+	return total
+}
+
+// isValidReturnReason checks if a reason is one of the known reason codes
+func isValidReturnReason(reason ReturnReason) bool {
+	switch reason {
+	case ReturnReasonDamaged, ReturnReasonDefective, ReturnReasonWrongItem,
+		ReturnReasonNotAsDescribed, ReturnReasonNoLongerNeeded, ReturnReasonOther:
+		return true
+	default:
+		return false
+	}
+}
@@ -21,16 +21,39 @@ type Shipment struct {
 	common.Entity
 	ShipmentID           uint           `json:"shipment_id"`
 	OrderID              uint           `json:"order_id"`
+	POID                 *uint          `json:"po_id,omitempty"` // Dropship purchase order the supplier shipped
 	TrackingNumber       string         `json:"tracking_number"`
 	Carrier              string         `json:"carrier"`
 	ShippingDate         *time.Time     `json:"shipping_date,omitempty"`
 	ExpectedDeliveryDate *time.Time     `json:"expected_delivery_date,omitempty"`
 	Status               ShipmentStatus `json:"status"`
+	Lines                []ShipmentLine `json:"lines,omitempty"`
 	CreatedAt            time.Time      `json:"created_at"`
 	UpdatedAt            time.Time      `json:"updated_at"`
 	Order                *Order        `json:"order,omitempty"`
 }
 
+// ShipmentLine is a quantity of one order item carried by a shipment
+type ShipmentLine struct {
+	common.Entity
+	ShipmentLineID uint  `json:"shipment_line_id"`
+	ShipmentID     uint  `json:"shipment_id"`
+	OrderItemID    uint  `json:"order_item_id"`
+	WarehouseID    *uint `json:"warehouse_id,omitempty"` // Nil for bundle and dropship items
+	Quantity       int   `json:"quantity"`
+}
+
+// QuantityOf returns how many units of an order item the shipment carries
+func (s *Shipment) QuantityOf(orderItemID uint) int {
+	total := 0
+	for _, line := range s.Lines {
+		if line.OrderItemID == orderItemID {
+			total += line.Quantity
+		}
+	}
+	return total
+}
+
 // MarkAsShipped updates the shipment status to shipped
 func (s *Shipment) MarkAsShipped() {
 	now := time.Now()
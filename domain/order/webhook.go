@@ -0,0 +1,150 @@
+package order
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common"
+)
+
+// ErrInvalidWebhookSignature is returned for webhooks not signed with the gateway's secret
+var ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+
+// ErrUnknownWebhookGateway is returned for webhooks from a gateway with no webhooks configured
+var ErrUnknownWebhookGateway = errors.New("no webhooks configured for this gateway")
+
+// WebhookProcessingTimeout is how long an event may stay received before it is taken to
+// have been abandoned part way, such as by a crash, and is applied again on its next delivery
+const WebhookProcessingTimeout = 5 * time.Minute
+
+// WebhookEventStatus represents how far a webhook event has been handled
+type WebhookEventStatus string
+
+const (
+	WebhookEventStatusReceived WebhookEventStatus = "received"
+	WebhookEventStatusApplied  WebhookEventStatus = "applied"  // Moved a transaction on
+	WebhookEventStatusIgnored  WebhookEventStatus = "ignored"  // Genuine, but stale or already reflected
+	WebhookEventStatusRejected WebhookEventStatus = "rejected" // Failed the signature check or could not be read
+	WebhookEventStatusFailed   WebhookEventStatus = "failed"   // Could not be applied yet, tried again when the gateway retries
+)
+
+// WebhookNotification is what a gateway's webhook reports about a transaction
+type WebhookNotification struct {
+	EventID              string        `json:"event_id"` // The gateway's ID for the event, the same on every retry
+	GatewayTransactionID string        `json:"gateway_transaction_id"`
+	ReferenceNumber      string        `json:"reference_number"`
+	Status               PaymentStatus `json:"status"`
+	OccurredAt           time.Time     `json:"occurred_at"`
+}
+
+// WebhookParser reads a gateway's webhook payloads
+type WebhookParser interface {
+	ParseWebhook(payload []byte) (WebhookNotification, error)
+}
+
+// WebhookEvent is a webhook delivery from a payment gateway, kept with its raw payload for audit
+type WebhookEvent struct {
+	common.Entity
+	WebhookEventID uint               `json:"webhook_event_id"`
+	Gateway        string             `json:"gateway"`
+	EventID        string             `json:"event_id"`
+	TransactionID  *uint              `json:"transaction_id,omitempty"`
+	ReportedStatus PaymentStatus      `json:"reported_status"`
+	Status         WebhookEventStatus `json:"status"`
+	Payload        string             `json:"payload"`
+	Signature      string             `json:"signature"`
+	Result         string             `json:"result"` // Why the event was ignored, rejected or failed
+	Deliveries     int                `json:"deliveries"`
+	OccurredAt     *time.Time         `json:"occurred_at,omitempty"`
+	ReceivedAt     time.Time          `json:"received_at"`
+	ProcessedAt    *time.Time         `json:"processed_at,omitempty"`
+}
+
+// NewWebhookEvent records a webhook delivery as it arrives
+func NewWebhookEvent(gateway string, payload []byte, signature string) *WebhookEvent {
+	return &WebhookEvent{
+		Gateway:    gateway,
+		Status:     WebhookEventStatusReceived,
+		Payload:    string(payload),
+		Signature:  signature,
+		Deliveries: 1,
+		ReceivedAt: time.Now(),
+	}
+}
+
+// Accept records what a verified event reports
+func (e *WebhookEvent) Accept(notification WebhookNotification) {
+	e.EventID = notification.EventID
+	e.ReportedStatus = notification.Status
+	if !notification.OccurredAt.IsZero() {
+		occurredAt := notification.OccurredAt
+		e.OccurredAt = &occurredAt
+	}
+}
+
+// Redeliver counts another delivery of the same event
+func (e *WebhookEvent) Redeliver() {
+	e.Deliveries++
+}
+
+// Apply marks the event as having moved a transaction on
+func (e *WebhookEvent) Apply(transactionID uint) {
+	e.TransactionID = &transactionID
+	e.finish(WebhookEventStatusApplied, "")
+}
+
+// Ignore marks a genuine event that changed nothing
+func (e *WebhookEvent) Ignore(transactionID *uint, reason string) {
+	e.TransactionID = transactionID
+	e.finish(WebhookEventStatusIgnored, reason)
+}
+
+// Reject marks an event that could not be trusted or read
+func (e *WebhookEvent) Reject(reason string) {
+	e.finish(WebhookEventStatusRejected, reason)
+}
+
+// Fail marks an event that could not be applied yet
+func (e *WebhookEvent) Fail(reason string) {
+	e.finish(WebhookEventStatusFailed, reason)
+}
+
+// IsAbandoned checks if the event was left received, neither applied nor failed,
+// for longer than WebhookProcessingTimeout
+func (e *WebhookEvent) IsAbandoned(asOf time.Time) bool {
+	return e.Status == WebhookEventStatusReceived && asOf.Sub(e.ReceivedAt) > WebhookProcessingTimeout
+}
+
+// IsHandled checks if the event has been dealt with for good, so a redelivery changes nothing
+func (e *WebhookEvent) IsHandled() bool {
+	return e.Status == WebhookEventStatusApplied || e.Status == WebhookEventStatusIgnored
+}
+
+// finish records the outcome of handling the event
+func (e *WebhookEvent) finish(status WebhookEventStatus, result string) {
+	now := time.Now()
+	e.Status = status
+	e.Result = result
+	e.ProcessedAt = &now
+}
+
+// SignWebhookPayload signs a payload the way gateways sign their webhooks:
+// the hex encoded HMAC-SHA256 of the raw body under the shared secret
+func SignWebhookPayload(payload []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature checks a webhook's signature in constant time
+func VerifyWebhookSignature(payload []byte, signature string, secret string) bool {
+	if secret == "" || signature == "" {
+		return false
+	}
+
+	expected := SignWebhookPayload(payload, secret)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
@@ -0,0 +1,108 @@
+package product
+
+import (
+	"errors"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common"
+	"github.com/hydr0g3nz/ecom_mid/domain/common/vo"
+)
+
+// ProductType represents how a product is stocked
+type ProductType string
+
+const (
+	ProductTypeSimple ProductType = "simple"
+	ProductTypeBundle ProductType = "bundle" // Built from component products; holds no stock of its own
+)
+
+// BundleComponent is a product or variant, and how many of it, that goes into one bundle
+type BundleComponent struct {
+	common.Entity
+	ComponentID uint     `json:"component_id"`
+	BundleID    uint     `json:"bundle_id"`
+	ProductID   uint     `json:"product_id"`
+	VariantID   *uint    `json:"variant_id,omitempty"`
+	Quantity    int      `json:"quantity"`
+	Product     *Product `json:"product,omitempty"`
+}
+
+// NewBundle creates a new bundle product; components are added once it has been saved
+func NewBundle(sku, name, description string, price vo.Money) (*Product, error) {
+	bundle, err := NewProduct(sku, name, description, price)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle.Type = ProductTypeBundle
+	bundle.Components = []BundleComponent{}
+	return bundle, nil
+}
+
+// IsBundle checks if the product is a bundle of other products
+func (p *Product) IsBundle() bool {
+	return p.Type == ProductTypeBundle
+}
+
+// AddComponent adds a component to a bundle, or adds to its quantity if it is already listed
+func (p *Product) AddComponent(component BundleComponent) error {
+	if !p.IsBundle() {
+		return errors.New("only bundles have components")
+	}
+
+	if component.ProductID == p.ProductID {
+		return errors.New("a bundle cannot contain itself")
+	}
+
+	if component.Quantity <= 0 {
+		return errors.New("component quantity must be greater than zero")
+	}
+
+	for i, c := range p.Components {
+		if c.ProductID == component.ProductID && SameVariant(c.VariantID, component.VariantID) {
+			p.Components[i].Quantity += component.Quantity
+			return nil
+		}
+	}
+
+	component.BundleID = p.ProductID
+	p.Components = append(p.Components, component)
+	return nil
+}
+
+// RemoveComponent removes a component from a bundle
+func (p *Product) RemoveComponent(componentID uint) error {
+	for i, c := range p.Components {
+		if c.ComponentID == componentID {
+			p.Components = append(p.Components[:i], p.Components[i+1:]...)
+			return nil
+		}
+	}
+
+	return errors.New("component not found in bundle")
+}
+
+// BuildableQuantity returns how many bundles can be built when each component has the
+// given quantity available, keyed in the same order as the bundle's components
+func (p *Product) BuildableQuantity(available []int) int {
+	if len(p.Components) == 0 || len(available) != len(p.Components) {
+		return 0
+	}
+
+	buildable := -1
+	for i, c := range p.Components {
+		fromComponent := max(available[i], 0) / c.Quantity
+		if buildable == -1 || fromComponent < buildable {
+			buildable = fromComponent
+		}
+	}
+
+	return buildable
+}
+
+// SameVariant checks if two optional variant IDs refer to the same variant
+func SameVariant(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
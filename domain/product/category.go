@@ -2,7 +2,6 @@ package product
 
 import (
 	"github.com/hydr0g3nz/ecom_mid/domain/common"
-	"github.com/hydr0g3nz/ecom_mid/domain/common/vo"
 )
 
 // CategoryStatus represents the status of a category
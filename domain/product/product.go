@@ -35,6 +35,14 @@ type Product struct {
 	Width              float64        `json:"width"`
 	Height             float64        `json:"height"`
 	Status             ProductStatus  `json:"status"`
+	Type               ProductType    `json:"type"`
+	IsSerialized       bool           `json:"is_serialized"`
+	AllowBackorder     bool           `json:"allow_backorder"`
+	BackorderLimit     *int           `json:"backorder_limit,omitempty"` // Most units that may wait on backorder at once; nil for no cap
+	PreOrderReleaseDate *time.Time    `json:"pre_order_release_date,omitempty"`
+	IsDropship         bool           `json:"is_dropship"` // Shipped to customers by the supplier; never stocked
+	DropshipSupplierID *uint          `json:"dropship_supplier_id,omitempty"`
+	StockQuantity      int            `json:"stock_quantity"` // Sellable stock across active warehouses, filled in by the availability service
 	MetaTitle          string         `json:"meta_title"`
 	MetaDescription    string         `json:"meta_description"`
 	MetaKeywords       string         `json:"meta_keywords"`
@@ -42,6 +50,7 @@ type Product struct {
 	Attributes         []ProductAttribute `json:"attributes"`
 	Variants           []ProductVariant   `json:"variants"`
 	Images             []ProductImage     `json:"images"`
+	Components         []BundleComponent  `json:"components,omitempty"`
 }
 
 // NewProduct creates a new product with validation
@@ -64,6 +73,7 @@ func NewProduct(sku, name, description string, price vo.Money) (*Product, error)
 		Description: description,
 		Price:       price,
 		Status:      ProductStatusDraft,
+		Type:        ProductTypeSimple,
 		Categories:  []Category{},
 		Attributes:  []ProductAttribute{},
 		Variants:    []ProductVariant{},
@@ -86,6 +96,89 @@ func (p *Product) Deactivate() {
 	p.Status = ProductStatusInactive
 }
 
+// IsInStock checks if the product or any of its variants has sellable stock
+func (p *Product) IsInStock() bool {
+	return p.StockQuantity > 0
+}
+
+// EnableSerialTracking requires every unit of the product to be tracked by serial number
+func (p *Product) EnableSerialTracking() {
+	p.IsSerialized = true
+}
+
+// DisableSerialTracking stops tracking the product by serial number
+func (p *Product) DisableSerialTracking() {
+	p.IsSerialized = false
+}
+
+// EnableBackorders lets the product be ordered when it is out of stock, up to an optional cap
+func (p *Product) EnableBackorders(limit *int) error {
+	if limit != nil && *limit < 0 {
+		return errors.New("backorder limit cannot be negative")
+	}
+	
+	p.AllowBackorder = true
+	p.BackorderLimit = limit
+	return nil
+}
+
+// DisableBackorders stops the product being ordered beyond its stock
+func (p *Product) DisableBackorders() {
+	p.AllowBackorder = false
+	p.BackorderLimit = nil
+}
+
+// StartPreOrder takes orders for the product ahead of its release date
+func (p *Product) StartPreOrder(releaseDate time.Time) error {
+	if !releaseDate.After(time.Now()) {
+		return errors.New("release date must be in the future")
+	}
+	
+	p.PreOrderReleaseDate = &releaseDate
+	return nil
+}
+
+// EndPreOrder ends the product's pre-order campaign
+func (p *Product) EndPreOrder() {
+	p.PreOrderReleaseDate = nil
+}
+
+// IsPreOrder checks if the product is on pre-order, that is, not yet released
+func (p *Product) IsPreOrder() bool {
+	return p.PreOrderReleaseDate != nil && time.Now().Before(*p.PreOrderReleaseDate)
+}
+
+// CanBackorder checks if quantity more units can be ordered without stock,
+// given the quantity already waiting on backorder
+func (p *Product) CanBackorder(openQuantity, quantity int) bool {
+	if !p.AllowBackorder && !p.IsPreOrder() {
+		return false
+	}
+	
+	return p.BackorderLimit == nil || openQuantity+quantity <= *p.BackorderLimit
+}
+
+// EnableDropship has the supplier ship the product straight to customers
+func (p *Product) EnableDropship(supplierID uint) error {
+	if supplierID == 0 {
+		return errors.New("dropship products need a supplier")
+	}
+	
+	if p.IsBundle() || p.IsSerialized {
+		return errors.New("bundles and serialized products cannot be dropshipped")
+	}
+	
+	p.IsDropship = true
+	p.DropshipSupplierID = &supplierID
+	return nil
+}
+
+// DisableDropship returns the product to being shipped from our own stock
+func (p *Product) DisableDropship() {
+	p.IsDropship = false
+	p.DropshipSupplierID = nil
+}
+
 // GetCurrentPrice returns the current applicable price (special or regular)
 func (p *Product) GetCurrentPrice() vo.Money {
 	if p.HasActiveSpecialPrice() {
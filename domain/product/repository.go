@@ -15,6 +15,9 @@ type ProductRepository interface {
 	AddAttribute(productAttribute *ProductAttribute) error
 	UpdateAttribute(productAttribute *ProductAttribute) error
 	RemoveAttribute(productID, attributeID uint) error
+	AddComponent(component *BundleComponent) error
+	UpdateComponent(component *BundleComponent) error
+	RemoveComponent(componentID uint) error
 }
 
 // CategoryRepository defines the interface for category operations
@@ -22,7 +22,7 @@ type ProductVariant struct {
 	SKU           string               `json:"sku"`
 	Price         vo.Money             `json:"price"`
 	SpecialPrice  *vo.Money            `json:"special_price,omitempty"`
-	StockQuantity int                  `json:"stock_quantity"`
+	StockQuantity int                  `json:"stock_quantity"` // Sellable stock across active warehouses, filled in by the availability service
 	Weight        float64              `json:"weight"`
 	Status        ProductVariantStatus `json:"status"`
 	Attributes    []VariantAttribute   `json:"attributes,omitempty"`
@@ -60,30 +60,6 @@ func (v *ProductVariant) IsInStock() bool {
 	return v.StockQuantity > 0
 }
 
-// AddStock adds stock quantity to the variant
-func (v *ProductVariant) AddStock(quantity int) error {
-	if quantity <= 0 {
-		return errors.New("quantity must be greater than zero")
-	}
-	
-	v.StockQuantity += quantity
-	return nil
-}
-
-// RemoveStock removes stock quantity from the variant
-func (v *ProductVariant) RemoveStock(quantity int) error {
-	if quantity <= 0 {
-		return errors.New("quantity must be greater than zero")
-	}
-	
-	if v.StockQuantity < quantity {
-		return errors.New("insufficient stock")
-	}
-	
-	v.StockQuantity -= quantity
-	return nil
-}
-
 // GetCurrentPrice returns the current applicable price (special or regular)
 func (v *ProductVariant) GetCurrentPrice() vo.Money {
 	if v.SpecialPrice != nil && !v.SpecialPrice.IsZero() {
@@ -27,6 +27,15 @@ type CustomerRepository interface {
 	FindAddressesByCustomerID(customerID uint) ([]CustomerAddress, error)
 }
 
+// StoreCreditRepository defines the interface for store credit operations
+type StoreCreditRepository interface {
+	FindByID(id uint) (*StoreCredit, error)
+	FindByCustomer(customerID uint) ([]*StoreCredit, error)
+	FindByReturn(returnID uint) (*StoreCredit, error)
+	Create(credit *StoreCredit) error
+	Update(credit *StoreCredit) error
+}
+
 // RoleRepository defines the interface for role operations
 type RoleRepository interface {
 	FindByID(id uint) (*Role, error)
@@ -0,0 +1,66 @@
+package user
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common"
+	"github.com/hydr0g3nz/ecom_mid/domain/common/vo"
+)
+
+// StoreCredit is an amount a customer can spend on later orders
+type StoreCredit struct {
+	common.Entity
+	StoreCreditID uint      `json:"store_credit_id"`
+	CustomerID    uint      `json:"customer_id"`
+	ReturnID      *uint     `json:"return_id,omitempty"` // Return the credit was issued for
+	Amount        vo.Money  `json:"amount"`
+	Balance       vo.Money  `json:"balance"` // What is left to spend
+	Reason        string    `json:"reason"`
+	IssuedBy      uint      `json:"issued_by"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// NewStoreCredit issues credit to a customer
+func NewStoreCredit(customerID uint, amount vo.Money, returnID *uint, reason string, issuedBy uint) (*StoreCredit, error) {
+	if customerID == 0 {
+		return nil, errors.New("customer is required")
+	}
+
+	if !amount.IsPositive() {
+		return nil, errors.New("store credit must be greater than zero")
+	}
+
+	now := time.Now()
+	return &StoreCredit{
+		CustomerID: customerID,
+		ReturnID:   returnID,
+		Amount:     amount,
+		Balance:    amount,
+		Reason:     reason,
+		IssuedBy:   issuedBy,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}, nil
+}
+
+// Redeem spends amount of the remaining balance
+func (c *StoreCredit) Redeem(amount vo.Money) error {
+	if !amount.IsPositive() {
+		return errors.New("amount must be greater than zero")
+	}
+
+	balance, err := c.Balance.Subtract(amount)
+	if err != nil {
+		return err
+	}
+
+	if balance.IsNegative() {
+		return errors.New("insufficient store credit")
+	}
+
+	c.Balance = balance
+	c.UpdatedAt = time.Now()
+	return nil
+}
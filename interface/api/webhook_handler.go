@@ -0,0 +1,56 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/order"
+	orderusecase "github.com/hydr0g3nz/ecom_mid/usecase/order"
+)
+
+// WebhookSignatureHeader is the request header gateways send their webhook signature in
+const WebhookSignatureHeader = "X-Webhook-Signature"
+
+// webhookFailedMessage answers a delivery that failed on our side. Why it failed stays
+// in the event's result rather than going back to the gateway.
+const webhookFailedMessage = "webhook could not be processed, deliver it again later"
+
+// WebhookHandler receives payment gateway webhooks over HTTP
+type WebhookHandler struct {
+	webhookUseCase *orderusecase.WebhookUseCase
+}
+
+// NewWebhookHandler creates a new WebhookHandler
+func NewWebhookHandler(webhookUseCase *orderusecase.WebhookUseCase) *WebhookHandler {
+	return &WebhookHandler{
+		webhookUseCase: webhookUseCase,
+	}
+}
+
+// RegisterRoutes mounts the webhook endpoint, one path per gateway name
+func (h *WebhookHandler) RegisterRoutes(router fiber.Router) {
+	router.Post("/webhooks/payments/:gateway", h.ReceiveWebhook)
+}
+
+// ReceiveWebhook handles a delivery from a gateway. Gateways retry anything but a success,
+// so it answers 200 once the event is dealt with, 401, 404 or 400 for deliveries that
+// would fail the same way every time, and 500 for those worth delivering again.
+func (h *WebhookHandler) ReceiveWebhook(c *fiber.Ctx) error {
+	// Fiber reuses the request body once the handler returns
+	payload := append([]byte(nil), c.Body()...)
+
+	event, err := h.webhookUseCase.ReceiveWebhook(c.Params("gateway"), payload, c.Get(WebhookSignatureHeader))
+	switch {
+	case err == nil:
+		return c.JSON(fiber.Map{"status": event.Status})
+	case errors.Is(err, order.ErrInvalidWebhookSignature):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, order.ErrUnknownWebhookGateway):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case event != nil && event.Status == order.WebhookEventStatusRejected:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": webhookFailedMessage})
+	}
+}
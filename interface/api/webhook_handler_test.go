@@ -0,0 +1,108 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/order"
+	"github.com/hydr0g3nz/ecom_mid/domain/order/ordertest"
+	orderusecase "github.com/hydr0g3nz/ecom_mid/usecase/order"
+)
+
+const testWebhookSecret = "whsec_test"
+
+// memoryWebhookEvents keeps the webhook events the handler records
+type memoryWebhookEvents struct {
+	order.WebhookEventRepository // Methods the tests do not need are left unimplemented
+	events                       []*order.WebhookEvent
+	createErr                    error // Returned by Create instead of saving, when set
+}
+
+func (r *memoryWebhookEvents) FindByGatewayEvent(gateway string, eventID string) (*order.WebhookEvent, error) {
+	return nil, nil
+}
+
+func (r *memoryWebhookEvents) Create(event *order.WebhookEvent) error {
+	if r.createErr != nil {
+		return r.createErr
+	}
+
+	r.events = append(r.events, event)
+	return nil
+}
+
+// newTestApp serves the webhook endpoint for the fake gateway, recording events in events
+func newTestApp(events *memoryWebhookEvents) *fiber.App {
+	webhooks := orderusecase.NewWebhookUseCase(events, nil, nil, nil, map[string]orderusecase.WebhookSource{
+		ordertest.GatewayName: {Secret: testWebhookSecret, Parser: ordertest.NewGateway()},
+	})
+
+	app := fiber.New()
+	NewWebhookHandler(webhooks).RegisterRoutes(app)
+	return app
+}
+
+func TestReceiveWebhookAnswersDeliveriesThatCannotSucceedWithClientErrors(t *testing.T) {
+	garbage := []byte("not json")
+
+	tests := []struct {
+		name      string
+		gateway   string
+		signature string
+		want      int
+	}{
+		{"unknown gateway", "nobody", order.SignWebhookPayload(garbage, testWebhookSecret), fiber.StatusNotFound},
+		{"bad signature", ordertest.GatewayName, "forged", fiber.StatusUnauthorized},
+		{"unreadable payload", ordertest.GatewayName, order.SignWebhookPayload(garbage, testWebhookSecret), fiber.StatusBadRequest},
+	}
+
+	app := newTestApp(&memoryWebhookEvents{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodPost, "/webhooks/payments/"+tt.gateway, bytes.NewReader(garbage))
+			req.Header.Set(WebhookSignatureHeader, tt.signature)
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != tt.want {
+				t.Fatalf("answered %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestReceiveWebhookKeepsFailureDetailsOutOfTheResponse(t *testing.T) {
+	events := &memoryWebhookEvents{createErr: errors.New("database at 10.0.0.5 refused the connection")}
+	app := newTestApp(events)
+
+	payload := ordertest.NewGateway().Webhook("fake_cap_1", order.PaymentStatusPaid)
+	req := httptest.NewRequest(fiber.MethodPost, "/webhooks/payments/"+ordertest.GatewayName, bytes.NewReader(payload))
+	req.Header.Set(WebhookSignatureHeader, order.SignWebhookPayload(payload, testWebhookSecret))
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != fiber.StatusInternalServerError {
+		t.Fatalf("answered %d, want %d", resp.StatusCode, fiber.StatusInternalServerError)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(body), "10.0.0.5") {
+		t.Fatalf("response %s gives away why the delivery failed", body)
+	}
+}
@@ -107,6 +107,13 @@ CREATE TABLE Product (
     width DECIMAL(10, 2),
     height DECIMAL(10, 2),
     status ENUM('active', 'inactive', 'draft') DEFAULT 'draft',
+    type ENUM('simple', 'bundle') DEFAULT 'simple',
+    is_serialized BOOLEAN DEFAULT FALSE,
+    allow_backorder BOOLEAN DEFAULT FALSE,
+    backorder_limit INT,
+    pre_order_release_date DATETIME,
+    is_dropship BOOLEAN DEFAULT FALSE,
+    dropship_supplier_id INT,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
     meta_title VARCHAR(255),
@@ -165,7 +172,6 @@ CREATE TABLE ProductVariant (
     sku VARCHAR(50) NOT NULL UNIQUE,
     price DECIMAL(10, 2) NOT NULL,
     special_price DECIMAL(10, 2),
-    stock_quantity INT DEFAULT 0,
     weight DECIMAL(10, 2),
     status ENUM('active', 'inactive') DEFAULT 'active',
     FOREIGN KEY (product_id) REFERENCES Product(product_id) ON DELETE CASCADE
@@ -182,6 +188,18 @@ CREATE TABLE VariantAttribute (
     UNIQUE KEY (variant_id, attribute_id)
 );
 
+CREATE TABLE BundleComponent (
+    component_id INT AUTO_INCREMENT PRIMARY KEY,
+    bundle_id INT NOT NULL,
+    product_id INT NOT NULL,
+    variant_id INT,
+    quantity INT NOT NULL,
+    FOREIGN KEY (bundle_id) REFERENCES Product(product_id) ON DELETE CASCADE,
+    FOREIGN KEY (product_id) REFERENCES Product(product_id) ON DELETE RESTRICT,
+    FOREIGN KEY (variant_id) REFERENCES ProductVariant(variant_id) ON DELETE RESTRICT,
+    UNIQUE KEY (bundle_id, product_id, variant_id)
+);
+
 CREATE TABLE ProductImage (
     image_id INT AUTO_INCREMENT PRIMARY KEY,
     product_id INT NOT NULL,
@@ -199,9 +217,21 @@ CREATE TABLE Warehouse (
     warehouse_id INT AUTO_INCREMENT PRIMARY KEY,
     name VARCHAR(100) NOT NULL,
     address TEXT NOT NULL,
+    province VARCHAR(100),
     phone VARCHAR(20),
     email VARCHAR(100),
-    status ENUM('active', 'inactive') DEFAULT 'active'
+    status ENUM('active', 'inactive') DEFAULT 'active',
+    priority INT DEFAULT 0,
+    pickup_only BOOLEAN DEFAULT FALSE,
+    serves_all BOOLEAN DEFAULT FALSE
+);
+
+CREATE TABLE WarehouseServiceArea (
+    service_area_id INT AUTO_INCREMENT PRIMARY KEY,
+    warehouse_id INT NOT NULL,
+    province VARCHAR(100) NOT NULL,
+    FOREIGN KEY (warehouse_id) REFERENCES Warehouse(warehouse_id) ON DELETE CASCADE,
+    UNIQUE KEY (warehouse_id, province)
 );
 
 CREATE TABLE Inventory (
@@ -211,11 +241,52 @@ CREATE TABLE Inventory (
     warehouse_id INT NOT NULL,
     quantity INT NOT NULL DEFAULT 0,
     reserved_quantity INT NOT NULL DEFAULT 0,
+    version INT NOT NULL DEFAULT 0,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
     FOREIGN KEY (product_id) REFERENCES Product(product_id) ON DELETE CASCADE,
     FOREIGN KEY (variant_id) REFERENCES ProductVariant(variant_id) ON DELETE CASCADE,
     FOREIGN KEY (warehouse_id) REFERENCES Warehouse(warehouse_id) ON DELETE CASCADE,
-    UNIQUE KEY (product_id, variant_id, warehouse_id)
+    UNIQUE KEY (product_id, variant_id, warehouse_id),
+    CHECK (reserved_quantity >= 0 AND reserved_quantity <= quantity)
+);
+
+CREATE TABLE InventoryLot (
+    lot_id INT AUTO_INCREMENT PRIMARY KEY,
+    inventory_id INT NOT NULL,
+    lot_number VARCHAR(100) NOT NULL,
+    expiry_date DATE,
+    quantity INT NOT NULL DEFAULT 0,
+    reserved_quantity INT NOT NULL DEFAULT 0,
+    received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (inventory_id) REFERENCES Inventory(inventory_id) ON DELETE CASCADE,
+    UNIQUE KEY (inventory_id, lot_number),
+    INDEX (expiry_date)
+);
+
+CREATE TABLE Location (
+    location_id INT AUTO_INCREMENT PRIMARY KEY,
+    warehouse_id INT NOT NULL,
+    parent_id INT,
+    type ENUM('zone', 'aisle', 'shelf', 'bin') NOT NULL,
+    code VARCHAR(50) NOT NULL,
+    path VARCHAR(255) NOT NULL,
+    is_active BOOLEAN DEFAULT TRUE,
+    is_quarantine BOOLEAN DEFAULT FALSE,
+    FOREIGN KEY (warehouse_id) REFERENCES Warehouse(warehouse_id) ON DELETE CASCADE,
+    FOREIGN KEY (parent_id) REFERENCES Location(location_id) ON DELETE CASCADE,
+    UNIQUE KEY (warehouse_id, path)
+);
+
+CREATE TABLE BinStock (
+    bin_stock_id INT AUTO_INCREMENT PRIMARY KEY,
+    location_id INT NOT NULL,
+    product_id INT NOT NULL,
+    variant_id INT,
+    quantity INT NOT NULL DEFAULT 0,
+    FOREIGN KEY (location_id) REFERENCES Location(location_id) ON DELETE CASCADE,
+    FOREIGN KEY (product_id) REFERENCES Product(product_id) ON DELETE CASCADE,
+    FOREIGN KEY (variant_id) REFERENCES ProductVariant(variant_id) ON DELETE CASCADE,
+    UNIQUE KEY (location_id, product_id, variant_id)
 );
 
 CREATE TABLE Supplier (
@@ -228,35 +299,198 @@ CREATE TABLE Supplier (
     status ENUM('active', 'inactive') DEFAULT 'active'
 );
 
+ALTER TABLE Product ADD FOREIGN KEY (dropship_supplier_id) REFERENCES Supplier(supplier_id) ON DELETE SET NULL;
+
 CREATE TABLE StockMovement (
     movement_id INT AUTO_INCREMENT PRIMARY KEY,
     product_id INT NOT NULL,
     variant_id INT,
     warehouse_id INT NOT NULL,
     quantity INT NOT NULL,
-    type ENUM('in', 'out', 'transfer') NOT NULL,
+    type ENUM('in', 'out', 'transfer', 'reserve', 'release') NOT NULL,
     reference_type VARCHAR(50) NOT NULL,
     reference_id INT NOT NULL,
+    lot_number VARCHAR(100),
+    expiry_date DATE,
+    from_location_id INT,
+    to_location_id INT,
     notes TEXT,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     staff_id INT NOT NULL,
     FOREIGN KEY (product_id) REFERENCES Product(product_id) ON DELETE CASCADE,
     FOREIGN KEY (variant_id) REFERENCES ProductVariant(variant_id) ON DELETE CASCADE,
     FOREIGN KEY (warehouse_id) REFERENCES Warehouse(warehouse_id) ON DELETE CASCADE,
+    FOREIGN KEY (from_location_id) REFERENCES Location(location_id) ON DELETE SET NULL,
+    FOREIGN KEY (to_location_id) REFERENCES Location(location_id) ON DELETE SET NULL,
     FOREIGN KEY (staff_id) REFERENCES Staff(staff_id) ON DELETE CASCADE
 );
 
+CREATE TABLE CostingSetting (
+    costing_setting_id INT AUTO_INCREMENT PRIMARY KEY,
+    method ENUM('fifo', 'weighted_average') NOT NULL DEFAULT 'fifo',
+    updated_by INT,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (updated_by) REFERENCES Staff(staff_id) ON DELETE SET NULL
+);
+
+CREATE TABLE CostLayer (
+    cost_layer_id INT AUTO_INCREMENT PRIMARY KEY,
+    product_id INT NOT NULL,
+    variant_id INT,
+    warehouse_id INT NOT NULL,
+    quantity INT NOT NULL,
+    remaining_quantity INT NOT NULL,
+    unit_cost DECIMAL(16, 6) NOT NULL,
+    reference_type VARCHAR(50) NOT NULL,
+    reference_id INT NOT NULL,
+    received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (product_id) REFERENCES Product(product_id) ON DELETE CASCADE,
+    FOREIGN KEY (variant_id) REFERENCES ProductVariant(variant_id) ON DELETE CASCADE,
+    FOREIGN KEY (warehouse_id) REFERENCES Warehouse(warehouse_id) ON DELETE CASCADE
+);
+
+CREATE TABLE CostLayerConsumption (
+    consumption_id INT AUTO_INCREMENT PRIMARY KEY,
+    cost_layer_id INT,
+    product_id INT NOT NULL,
+    variant_id INT,
+    warehouse_id INT NOT NULL,
+    quantity INT NOT NULL,
+    unit_cost DECIMAL(16, 6) NOT NULL,
+    total_cost DECIMAL(10, 2) NOT NULL,
+    reference_type VARCHAR(50) NOT NULL,
+    reference_id INT NOT NULL,
+    consumed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (cost_layer_id) REFERENCES CostLayer(cost_layer_id) ON DELETE SET NULL,
+    FOREIGN KEY (product_id) REFERENCES Product(product_id) ON DELETE CASCADE,
+    FOREIGN KEY (variant_id) REFERENCES ProductVariant(variant_id) ON DELETE CASCADE,
+    FOREIGN KEY (warehouse_id) REFERENCES Warehouse(warehouse_id) ON DELETE CASCADE
+);
+
+CREATE TABLE StockTransfer (
+    transfer_id INT AUTO_INCREMENT PRIMARY KEY,
+    source_warehouse_id INT NOT NULL,
+    destination_warehouse_id INT NOT NULL,
+    status ENUM('draft', 'dispatched', 'received', 'cancelled') DEFAULT 'draft',
+    notes TEXT,
+    staff_id INT NOT NULL,
+    dispatched_at TIMESTAMP NULL,
+    received_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (source_warehouse_id) REFERENCES Warehouse(warehouse_id) ON DELETE CASCADE,
+    FOREIGN KEY (destination_warehouse_id) REFERENCES Warehouse(warehouse_id) ON DELETE CASCADE,
+    FOREIGN KEY (staff_id) REFERENCES Staff(staff_id) ON DELETE CASCADE
+);
+
+CREATE TABLE StockTransferItem (
+    transfer_item_id INT AUTO_INCREMENT PRIMARY KEY,
+    transfer_id INT NOT NULL,
+    product_id INT NOT NULL,
+    variant_id INT,
+    quantity INT NOT NULL,
+    unit_cost DECIMAL(16, 6),
+    FOREIGN KEY (transfer_id) REFERENCES StockTransfer(transfer_id) ON DELETE CASCADE,
+    FOREIGN KEY (product_id) REFERENCES Product(product_id) ON DELETE CASCADE,
+    FOREIGN KEY (variant_id) REFERENCES ProductVariant(variant_id) ON DELETE CASCADE
+);
+
+CREATE TABLE StockTransferItemLot (
+    transfer_item_id INT NOT NULL,
+    lot_number VARCHAR(100) NOT NULL,
+    expiry_date DATE,
+    quantity INT NOT NULL,
+    PRIMARY KEY (transfer_item_id, lot_number),
+    FOREIGN KEY (transfer_item_id) REFERENCES StockTransferItem(transfer_item_id) ON DELETE CASCADE
+);
+
+CREATE TABLE StockTransferItemSerial (
+    transfer_item_id INT NOT NULL,
+    serial_number VARCHAR(100) NOT NULL,
+    PRIMARY KEY (transfer_item_id, serial_number),
+    FOREIGN KEY (transfer_item_id) REFERENCES StockTransferItem(transfer_item_id) ON DELETE CASCADE
+);
+
+CREATE TABLE CycleCount (
+    count_id INT AUTO_INCREMENT PRIMARY KEY,
+    warehouse_id INT NOT NULL,
+    status ENUM('counting', 'pending_approval', 'completed', 'cancelled') DEFAULT 'counting',
+    notes TEXT,
+    staff_id INT NOT NULL,
+    approved_by INT,
+    started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP NULL,
+    FOREIGN KEY (warehouse_id) REFERENCES Warehouse(warehouse_id) ON DELETE CASCADE,
+    FOREIGN KEY (staff_id) REFERENCES Staff(staff_id) ON DELETE CASCADE,
+    FOREIGN KEY (approved_by) REFERENCES Staff(staff_id) ON DELETE SET NULL
+);
+
+CREATE TABLE CycleCountLine (
+    count_line_id INT AUTO_INCREMENT PRIMARY KEY,
+    count_id INT NOT NULL,
+    product_id INT NOT NULL,
+    variant_id INT,
+    system_quantity INT NOT NULL,
+    counted_quantity INT NOT NULL,
+    status ENUM('counted', 'held', 'approved', 'rejected', 'posted') DEFAULT 'counted',
+    FOREIGN KEY (count_id) REFERENCES CycleCount(count_id) ON DELETE CASCADE,
+    FOREIGN KEY (product_id) REFERENCES Product(product_id) ON DELETE CASCADE,
+    FOREIGN KEY (variant_id) REFERENCES ProductVariant(variant_id) ON DELETE CASCADE
+);
+
+CREATE TABLE ReorderRule (
+    reorder_rule_id INT AUTO_INCREMENT PRIMARY KEY,
+    product_id INT NOT NULL,
+    variant_id INT,
+    warehouse_id INT NOT NULL,
+    reorder_point INT NOT NULL DEFAULT 0,
+    reorder_quantity INT NOT NULL,
+    safety_stock INT NOT NULL DEFAULT 0,
+    preferred_supplier_id INT,
+    FOREIGN KEY (product_id) REFERENCES Product(product_id) ON DELETE CASCADE,
+    FOREIGN KEY (variant_id) REFERENCES ProductVariant(variant_id) ON DELETE CASCADE,
+    FOREIGN KEY (warehouse_id) REFERENCES Warehouse(warehouse_id) ON DELETE CASCADE,
+    FOREIGN KEY (preferred_supplier_id) REFERENCES Supplier(supplier_id) ON DELETE SET NULL,
+    UNIQUE KEY (product_id, variant_id, warehouse_id)
+);
+
 CREATE TABLE PurchaseOrder (
     po_id INT AUTO_INCREMENT PRIMARY KEY,
     supplier_id INT NOT NULL,
     order_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     expected_date DATE,
-    status ENUM('draft', 'pending', 'confirmed', 'received', 'cancelled') DEFAULT 'draft',
+    status ENUM('draft', 'pending', 'confirmed', 'partially_received', 'received', 'cancelled') DEFAULT 'draft',
     notes TEXT,
     total_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
     staff_id INT NOT NULL,
+    approved_by INT,
+    approved_at TIMESTAMP NULL,
+    dropship_order_id INT,
+    ship_to_receiver_name VARCHAR(100),
+    ship_to_phone VARCHAR(20),
+    ship_to_address_line1 VARCHAR(255),
+    ship_to_address_line2 VARCHAR(255),
+    ship_to_district VARCHAR(100),
+    ship_to_city VARCHAR(100),
+    ship_to_province VARCHAR(100),
+    ship_to_postal_code VARCHAR(10),
+    tracking_number VARCHAR(100),
+    carrier VARCHAR(100),
+    UNIQUE KEY (dropship_order_id, supplier_id),
     FOREIGN KEY (supplier_id) REFERENCES Supplier(supplier_id) ON DELETE CASCADE,
-    FOREIGN KEY (staff_id) REFERENCES Staff(staff_id) ON DELETE CASCADE
+    FOREIGN KEY (staff_id) REFERENCES Staff(staff_id) ON DELETE CASCADE,
+    FOREIGN KEY (approved_by) REFERENCES Staff(staff_id) ON DELETE SET NULL
+);
+
+CREATE TABLE PurchaseOrderStatusHistory (
+    history_id INT AUTO_INCREMENT PRIMARY KEY,
+    po_id INT NOT NULL,
+    status ENUM('draft', 'pending', 'confirmed', 'partially_received', 'received', 'cancelled') NOT NULL,
+    comment TEXT,
+    staff_id INT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (po_id) REFERENCES PurchaseOrder(po_id) ON DELETE CASCADE,
+    FOREIGN KEY (staff_id) REFERENCES Staff(staff_id) ON DELETE SET NULL
 );
 
 CREATE TABLE PurchaseOrderItem (
@@ -265,6 +499,7 @@ CREATE TABLE PurchaseOrderItem (
     product_id INT NOT NULL,
     variant_id INT,
     quantity INT NOT NULL,
+    received_quantity INT NOT NULL DEFAULT 0,
     unit_cost DECIMAL(10, 2) NOT NULL,
     total_cost DECIMAL(10, 2) NOT NULL,
     FOREIGN KEY (po_id) REFERENCES PurchaseOrder(po_id) ON DELETE CASCADE,
@@ -272,12 +507,43 @@ CREATE TABLE PurchaseOrderItem (
     FOREIGN KEY (variant_id) REFERENCES ProductVariant(variant_id) ON DELETE CASCADE
 );
 
+CREATE TABLE GoodsReceipt (
+    receipt_id INT AUTO_INCREMENT PRIMARY KEY,
+    po_id INT NOT NULL,
+    warehouse_id INT NOT NULL,
+    received_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    staff_id INT NOT NULL,
+    notes TEXT,
+    FOREIGN KEY (po_id) REFERENCES PurchaseOrder(po_id) ON DELETE CASCADE,
+    FOREIGN KEY (warehouse_id) REFERENCES Warehouse(warehouse_id) ON DELETE CASCADE,
+    FOREIGN KEY (staff_id) REFERENCES Staff(staff_id) ON DELETE CASCADE
+);
+
+CREATE TABLE GoodsReceiptItem (
+    receipt_item_id INT AUTO_INCREMENT PRIMARY KEY,
+    receipt_id INT NOT NULL,
+    po_item_id INT NOT NULL,
+    product_id INT NOT NULL,
+    variant_id INT,
+    quantity INT NOT NULL,
+    unit_cost DECIMAL(10, 2) NOT NULL,
+    lot_number VARCHAR(100),
+    expiry_date DATE,
+    location_id INT,
+    FOREIGN KEY (receipt_id) REFERENCES GoodsReceipt(receipt_id) ON DELETE CASCADE,
+    FOREIGN KEY (po_item_id) REFERENCES PurchaseOrderItem(po_item_id) ON DELETE CASCADE,
+    FOREIGN KEY (product_id) REFERENCES Product(product_id) ON DELETE CASCADE,
+    FOREIGN KEY (variant_id) REFERENCES ProductVariant(variant_id) ON DELETE CASCADE,
+    FOREIGN KEY (location_id) REFERENCES Location(location_id) ON DELETE SET NULL
+);
+
 -- 5. ระบบ Order
 CREATE TABLE PaymentMethod (
     payment_method_id INT AUTO_INCREMENT PRIMARY KEY,
     name VARCHAR(100) NOT NULL,
     description TEXT,
     is_active BOOLEAN DEFAULT TRUE,
+    gateway VARCHAR(50),
     fees_type ENUM('fixed', 'percentage') DEFAULT 'fixed',
     fees_amount DECIMAL(10, 2) DEFAULT 0,
     sort_order INT DEFAULT 0
@@ -288,14 +554,14 @@ CREATE TABLE Order_Table (
     customer_id INT NOT NULL,
     order_number VARCHAR(50) NOT NULL UNIQUE,
     order_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    status ENUM('pending', 'processing', 'shipped', 'delivered', 'cancelled') DEFAULT 'pending',
+    status ENUM('pending', 'processing', 'partially_shipped', 'shipped', 'delivered', 'cancelled') DEFAULT 'pending',
     subtotal DECIMAL(10, 2) NOT NULL,
     shipping_fee DECIMAL(10, 2) NOT NULL DEFAULT 0,
     tax_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
     discount_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
     total_amount DECIMAL(10, 2) NOT NULL,
     payment_method_id INT NOT NULL,
-    payment_status ENUM('pending', 'paid', 'failed', 'refunded') DEFAULT 'pending',
+    payment_status ENUM('pending', 'authorized', 'paid', 'failed', 'refunded', 'partially_refunded', 'voided') DEFAULT 'pending',
     shipping_address_id INT NOT NULL,
     billing_address_id INT NOT NULL,
     notes TEXT,
@@ -307,11 +573,14 @@ CREATE TABLE Order_Table (
     FOREIGN KEY (billing_address_id) REFERENCES CustomerAddress(address_id) ON DELETE CASCADE
 );
 
+ALTER TABLE PurchaseOrder ADD FOREIGN KEY (dropship_order_id) REFERENCES Order_Table(order_id) ON DELETE SET NULL;
+
 CREATE TABLE OrderItem (
     order_item_id INT AUTO_INCREMENT PRIMARY KEY,
     order_id INT NOT NULL,
     product_id INT NOT NULL,
     variant_id INT,
+    warehouse_id INT,
     sku VARCHAR(50) NOT NULL,
     name VARCHAR(255) NOT NULL,
     quantity INT NOT NULL,
@@ -320,15 +589,81 @@ CREATE TABLE OrderItem (
     tax DECIMAL(10, 2) NOT NULL DEFAULT 0,
     discount DECIMAL(10, 2) NOT NULL DEFAULT 0,
     total DECIMAL(10, 2) NOT NULL,
+    cost_of_goods DECIMAL(10, 2),
+    is_backordered BOOLEAN DEFAULT FALSE,
+    release_date DATETIME,
+    expected_ship_date DATE,
+    is_dropship BOOLEAN DEFAULT FALSE,
+    purchase_order_id INT,
     FOREIGN KEY (order_id) REFERENCES Order_Table(order_id) ON DELETE CASCADE,
     FOREIGN KEY (product_id) REFERENCES Product(product_id) ON DELETE CASCADE,
-    FOREIGN KEY (variant_id) REFERENCES ProductVariant(variant_id) ON DELETE CASCADE
+    FOREIGN KEY (variant_id) REFERENCES ProductVariant(variant_id) ON DELETE CASCADE,
+    FOREIGN KEY (warehouse_id) REFERENCES Warehouse(warehouse_id) ON DELETE SET NULL,
+    FOREIGN KEY (purchase_order_id) REFERENCES PurchaseOrder(po_id) ON DELETE SET NULL
+);
+
+CREATE TABLE OrderItemComponent (
+    order_item_component_id INT AUTO_INCREMENT PRIMARY KEY,
+    order_item_id INT NOT NULL,
+    product_id INT NOT NULL,
+    variant_id INT,
+    warehouse_id INT,
+    sku VARCHAR(50) NOT NULL,
+    quantity INT NOT NULL,
+    revenue DECIMAL(10, 2) NOT NULL,
+    cost_of_goods DECIMAL(10, 2),
+    FOREIGN KEY (order_item_id) REFERENCES OrderItem(order_item_id) ON DELETE CASCADE,
+    FOREIGN KEY (product_id) REFERENCES Product(product_id) ON DELETE CASCADE,
+    FOREIGN KEY (variant_id) REFERENCES ProductVariant(variant_id) ON DELETE CASCADE,
+    FOREIGN KEY (warehouse_id) REFERENCES Warehouse(warehouse_id) ON DELETE SET NULL
+);
+
+CREATE TABLE Reservation (
+    reservation_id INT AUTO_INCREMENT PRIMARY KEY,
+    order_id INT NOT NULL,
+    order_item_id INT,
+    product_id INT NOT NULL,
+    variant_id INT,
+    warehouse_id INT NOT NULL,
+    quantity INT NOT NULL,
+    status ENUM('active', 'committed', 'released') DEFAULT 'active',
+    expires_at TIMESTAMP NULL,
+    version INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (order_id) REFERENCES Order_Table(order_id) ON DELETE RESTRICT,
+    FOREIGN KEY (order_item_id) REFERENCES OrderItem(order_item_id) ON DELETE SET NULL,
+    FOREIGN KEY (product_id) REFERENCES Product(product_id) ON DELETE CASCADE,
+    FOREIGN KEY (variant_id) REFERENCES ProductVariant(variant_id) ON DELETE CASCADE,
+    FOREIGN KEY (warehouse_id) REFERENCES Warehouse(warehouse_id) ON DELETE CASCADE,
+    INDEX (product_id, variant_id, warehouse_id, status),
+    INDEX (status, expires_at)
+);
+
+CREATE TABLE Backorder (
+    backorder_id INT AUTO_INCREMENT PRIMARY KEY,
+    order_id INT NOT NULL,
+    order_item_id INT NOT NULL,
+    product_id INT NOT NULL,
+    variant_id INT,
+    quantity INT NOT NULL,
+    is_pre_order BOOLEAN DEFAULT FALSE,
+    status ENUM('open', 'allocated', 'cancelled') DEFAULT 'open',
+    warehouse_id INT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    allocated_at TIMESTAMP NULL,
+    FOREIGN KEY (order_id) REFERENCES Order_Table(order_id) ON DELETE CASCADE,
+    FOREIGN KEY (order_item_id) REFERENCES OrderItem(order_item_id) ON DELETE CASCADE,
+    FOREIGN KEY (product_id) REFERENCES Product(product_id) ON DELETE CASCADE,
+    FOREIGN KEY (variant_id) REFERENCES ProductVariant(variant_id) ON DELETE CASCADE,
+    FOREIGN KEY (warehouse_id) REFERENCES Warehouse(warehouse_id) ON DELETE SET NULL,
+    INDEX (product_id, variant_id, status, created_at)
 );
 
 CREATE TABLE OrderStatusHistory (
     history_id INT AUTO_INCREMENT PRIMARY KEY,
     order_id INT NOT NULL,
-    status ENUM('pending', 'processing', 'shipped', 'delivered', 'cancelled') NOT NULL,
+    status ENUM('pending', 'processing', 'partially_shipped', 'shipped', 'delivered', 'cancelled') NOT NULL,
     comment TEXT,
     staff_id INT,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
@@ -339,6 +674,7 @@ CREATE TABLE OrderStatusHistory (
 CREATE TABLE Shipment (
     shipment_id INT AUTO_INCREMENT PRIMARY KEY,
     order_id INT NOT NULL,
+    po_id INT,
     tracking_number VARCHAR(100),
     carrier VARCHAR(100) NOT NULL,
     shipping_date TIMESTAMP,
@@ -346,7 +682,107 @@ CREATE TABLE Shipment (
     status ENUM('pending', 'shipped', 'delivered', 'failed') DEFAULT 'pending',
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-    FOREIGN KEY (order_id) REFERENCES Order_Table(order_id) ON DELETE CASCADE
+    FOREIGN KEY (order_id) REFERENCES Order_Table(order_id) ON DELETE CASCADE,
+    FOREIGN KEY (po_id) REFERENCES PurchaseOrder(po_id) ON DELETE SET NULL
+);
+
+CREATE TABLE ShipmentLine (
+    shipment_line_id INT AUTO_INCREMENT PRIMARY KEY,
+    shipment_id INT NOT NULL,
+    order_item_id INT NOT NULL,
+    warehouse_id INT,
+    quantity INT NOT NULL,
+    FOREIGN KEY (shipment_id) REFERENCES Shipment(shipment_id) ON DELETE CASCADE,
+    FOREIGN KEY (order_item_id) REFERENCES OrderItem(order_item_id) ON DELETE CASCADE,
+    FOREIGN KEY (warehouse_id) REFERENCES Warehouse(warehouse_id),
+    INDEX (order_item_id)
+);
+
+CREATE TABLE SerialNumber (
+    serial_id INT AUTO_INCREMENT PRIMARY KEY,
+    serial_number VARCHAR(100) NOT NULL UNIQUE,
+    product_id INT NOT NULL,
+    variant_id INT,
+    warehouse_id INT,
+    status ENUM('in_stock', 'shipped', 'returned', 'quarantined', 'in_transit') DEFAULT 'in_stock',
+    po_id INT,
+    order_id INT,
+    order_item_id INT,
+    shipment_id INT,
+    FOREIGN KEY (product_id) REFERENCES Product(product_id) ON DELETE CASCADE,
+    FOREIGN KEY (variant_id) REFERENCES ProductVariant(variant_id) ON DELETE CASCADE,
+    FOREIGN KEY (warehouse_id) REFERENCES Warehouse(warehouse_id) ON DELETE SET NULL,
+    FOREIGN KEY (po_id) REFERENCES PurchaseOrder(po_id) ON DELETE SET NULL,
+    FOREIGN KEY (order_id) REFERENCES Order_Table(order_id) ON DELETE SET NULL,
+    FOREIGN KEY (order_item_id) REFERENCES OrderItem(order_item_id) ON DELETE SET NULL,
+    FOREIGN KEY (shipment_id) REFERENCES Shipment(shipment_id) ON DELETE SET NULL
+);
+
+CREATE TABLE SerialEvent (
+    event_id INT AUTO_INCREMENT PRIMARY KEY,
+    serial_id INT NOT NULL,
+    type ENUM('received', 'shipped', 'returned', 'quarantined', 'dispatched', 'received_in') NOT NULL,
+    warehouse_id INT,
+    reference_type VARCHAR(50) NOT NULL,
+    reference_id INT NOT NULL,
+    shipment_id INT,
+    staff_id INT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (serial_id) REFERENCES SerialNumber(serial_id) ON DELETE CASCADE,
+    FOREIGN KEY (warehouse_id) REFERENCES Warehouse(warehouse_id) ON DELETE SET NULL,
+    FOREIGN KEY (shipment_id) REFERENCES Shipment(shipment_id) ON DELETE SET NULL
+);
+
+CREATE TABLE ReturnRequest (
+    return_id INT AUTO_INCREMENT PRIMARY KEY,
+    return_number VARCHAR(50) NOT NULL UNIQUE,
+    order_id INT NOT NULL,
+    customer_id INT NOT NULL,
+    status ENUM('requested', 'approved', 'received', 'inspected', 'closed') DEFAULT 'requested',
+    refund_method ENUM('original_payment', 'store_credit') NOT NULL,
+    warehouse_id INT,
+    refund_amount DECIMAL(10, 2),
+    refund_id INT,
+    store_credit_id INT,
+    is_rejected BOOLEAN DEFAULT FALSE,
+    notes TEXT,
+    approved_by INT,
+    approved_at TIMESTAMP NULL,
+    received_at TIMESTAMP NULL,
+    inspected_at TIMESTAMP NULL,
+    closed_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (order_id) REFERENCES Order_Table(order_id) ON DELETE CASCADE,
+    FOREIGN KEY (customer_id) REFERENCES Customer(customer_id) ON DELETE CASCADE,
+    FOREIGN KEY (warehouse_id) REFERENCES Warehouse(warehouse_id) ON DELETE SET NULL,
+    FOREIGN KEY (approved_by) REFERENCES Staff(staff_id) ON DELETE SET NULL,
+    INDEX (status)
+);
+
+CREATE TABLE ReturnItem (
+    return_item_id INT AUTO_INCREMENT PRIMARY KEY,
+    return_id INT NOT NULL,
+    order_item_id INT NOT NULL,
+    product_id INT NOT NULL,
+    variant_id INT,
+    quantity INT NOT NULL,
+    reason ENUM('damaged', 'defective', 'wrong_item', 'not_as_described', 'no_longer_needed', 'other') NOT NULL,
+    notes TEXT,
+    outcome ENUM('restock', 'quarantine'),
+    location_id INT,
+    FOREIGN KEY (return_id) REFERENCES ReturnRequest(return_id) ON DELETE CASCADE,
+    FOREIGN KEY (order_item_id) REFERENCES OrderItem(order_item_id) ON DELETE CASCADE,
+    FOREIGN KEY (product_id) REFERENCES Product(product_id) ON DELETE CASCADE,
+    FOREIGN KEY (variant_id) REFERENCES ProductVariant(variant_id) ON DELETE CASCADE,
+    FOREIGN KEY (location_id) REFERENCES Location(location_id) ON DELETE SET NULL
+);
+
+CREATE TABLE ReturnItemSerial (
+    return_item_id INT NOT NULL,
+    serial_number VARCHAR(100) NOT NULL,
+    PRIMARY KEY (return_item_id, serial_number),
+    FOREIGN KEY (return_item_id) REFERENCES ReturnItem(return_item_id) ON DELETE CASCADE
 );
 
 -- 6. ระบบ Payment
@@ -354,14 +790,40 @@ CREATE TABLE Transaction (
     transaction_id INT AUTO_INCREMENT PRIMARY KEY,
     order_id INT NOT NULL,
     payment_method_id INT NOT NULL,
+    type ENUM('authorization', 'capture', 'void', 'refund') NOT NULL,
+    parent_transaction_id INT,
     transaction_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     amount DECIMAL(10, 2) NOT NULL,
-    status ENUM('pending', 'completed', 'failed', 'refunded') DEFAULT 'pending',
+    status ENUM('pending', 'authorized', 'completed', 'failed', 'refunded', 'partially_refunded', 'voided') DEFAULT 'pending',
     reference_number VARCHAR(100),
     gateway_response TEXT,
     gateway_transaction_id VARCHAR(100),
+    refund_id INT,
+    is_sale BOOLEAN DEFAULT FALSE,
     FOREIGN KEY (order_id) REFERENCES Order_Table(order_id) ON DELETE CASCADE,
-    FOREIGN KEY (payment_method_id) REFERENCES PaymentMethod(payment_method_id) ON DELETE CASCADE
+    FOREIGN KEY (payment_method_id) REFERENCES PaymentMethod(payment_method_id) ON DELETE CASCADE,
+    FOREIGN KEY (parent_transaction_id) REFERENCES Transaction(transaction_id) ON DELETE SET NULL,
+    INDEX (gateway_transaction_id),
+    INDEX (reference_number)
+);
+
+CREATE TABLE WebhookEvent (
+    webhook_event_id INT AUTO_INCREMENT PRIMARY KEY,
+    gateway VARCHAR(50) NOT NULL,
+    event_id VARCHAR(100),
+    transaction_id INT,
+    reported_status VARCHAR(30),
+    status ENUM('received', 'applied', 'ignored', 'rejected', 'failed') DEFAULT 'received',
+    payload MEDIUMTEXT NOT NULL,
+    signature VARCHAR(255),
+    result TEXT,
+    deliveries INT DEFAULT 1,
+    occurred_at TIMESTAMP NULL,
+    received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    processed_at TIMESTAMP NULL,
+    FOREIGN KEY (transaction_id) REFERENCES Transaction(transaction_id) ON DELETE SET NULL,
+    UNIQUE KEY (gateway, event_id),
+    INDEX (status)
 );
 
 CREATE TABLE Refund (
@@ -369,16 +831,42 @@ CREATE TABLE Refund (
     order_id INT NOT NULL,
     transaction_id INT NOT NULL,
     amount DECIMAL(10, 2) NOT NULL,
+    shipping_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    tax_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
     reason TEXT NOT NULL,
-    status ENUM('pending', 'processed', 'rejected') DEFAULT 'pending',
+    status ENUM('pending', 'processed', 'rejected', 'failed') DEFAULT 'pending',
     refund_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    requested_by INT,
     processed_by INT,
     notes TEXT,
+    return_id INT,
     FOREIGN KEY (order_id) REFERENCES Order_Table(order_id) ON DELETE CASCADE,
     FOREIGN KEY (transaction_id) REFERENCES Transaction(transaction_id) ON DELETE CASCADE,
-    FOREIGN KEY (processed_by) REFERENCES Staff(staff_id) ON DELETE SET NULL
+    FOREIGN KEY (requested_by) REFERENCES Staff(staff_id) ON DELETE SET NULL,
+    FOREIGN KEY (processed_by) REFERENCES Staff(staff_id) ON DELETE SET NULL,
+    FOREIGN KEY (return_id) REFERENCES ReturnRequest(return_id) ON DELETE SET NULL
+);
+
+ALTER TABLE ReturnRequest ADD FOREIGN KEY (refund_id) REFERENCES Refund(refund_id) ON DELETE SET NULL;
+ALTER TABLE Transaction ADD FOREIGN KEY (refund_id) REFERENCES Refund(refund_id) ON DELETE SET NULL;
+
+CREATE TABLE StoreCredit (
+    store_credit_id INT AUTO_INCREMENT PRIMARY KEY,
+    customer_id INT NOT NULL,
+    return_id INT,
+    amount DECIMAL(10, 2) NOT NULL,
+    balance DECIMAL(10, 2) NOT NULL,
+    reason TEXT,
+    issued_by INT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (customer_id) REFERENCES Customer(customer_id) ON DELETE CASCADE,
+    FOREIGN KEY (return_id) REFERENCES ReturnRequest(return_id) ON DELETE SET NULL,
+    FOREIGN KEY (issued_by) REFERENCES Staff(staff_id) ON DELETE SET NULL
 );
 
+ALTER TABLE ReturnRequest ADD FOREIGN KEY (store_credit_id) REFERENCES StoreCredit(store_credit_id) ON DELETE SET NULL;
+
 -- 7. ระบบออกเอกสารต่างๆ
 CREATE TABLE Document (
     document_id INT AUTO_INCREMENT PRIMARY KEY,
@@ -0,0 +1,175 @@
+package inventory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/inventory"
+)
+
+// incomingPOStatuses are the purchase order statuses the supplier has committed to deliver
+var incomingPOStatuses = []inventory.PurchaseOrderStatus{
+	inventory.POStatusConfirmed,
+	inventory.POStatusPartiallyReceived,
+}
+
+// IncomingSupply is the quantity expected to arrive on a date and the running total promised by then
+type IncomingSupply struct {
+	Date       time.Time `json:"date"`
+	Quantity   int       `json:"quantity"`
+	Cumulative int       `json:"cumulative"` // Quantity available to promise once this delivery arrives
+}
+
+// AvailableToPromise is what can be promised to customers now and on future dates
+type AvailableToPromise struct {
+	ProductID    uint                    `json:"product_id"`
+	VariantID    *uint                   `json:"variant_id,omitempty"`
+	OnHand       int                     `json:"on_hand"`
+	Reserved     int                     `json:"reserved"`    // Held for orders not yet shipped
+	Unsellable   int                     `json:"unsellable"`  // Unreserved stock in expired lots
+	Backordered  int                     `json:"backordered"` // Owed to open backorders
+	AvailableNow int                     `json:"available_now"`
+	ByWarehouse  []WarehouseAvailability `json:"by_warehouse"`
+	Incoming     []IncomingSupply        `json:"incoming"`
+}
+
+// AvailableOn returns the first date quantity can be promised: now if in stock,
+// a delivery date if incoming supply covers it, or nil if nothing on order will
+func (atp *AvailableToPromise) AvailableOn(quantity int) *time.Time {
+	if atp.AvailableNow >= quantity {
+		now := time.Now()
+		return &now
+	}
+
+	for _, supply := range atp.Incoming {
+		if supply.Cumulative >= quantity {
+			date := supply.Date
+			return &date
+		}
+	}
+
+	return nil
+}
+
+// ATPUseCase contains the business logic for available-to-promise queries
+type ATPUseCase struct {
+	availability  *AvailabilityUseCase
+	poRepo        inventory.PurchaseOrderRepository
+	backorderRepo inventory.BackorderRepository
+}
+
+// NewATPUseCase creates a new ATPUseCase
+func NewATPUseCase(
+	availability *AvailabilityUseCase,
+	poRepo inventory.PurchaseOrderRepository,
+	backorderRepo inventory.BackorderRepository,
+) *ATPUseCase {
+	return &ATPUseCase{
+		availability:  availability,
+		poRepo:        poRepo,
+		backorderRepo: backorderRepo,
+	}
+}
+
+// GetATP returns the quantity available now in each warehouse and the quantity that becomes
+// available on each expected delivery date of confirmed purchase orders. Available now is
+// stock on hand less what is reserved for orders, what sits in expired lots and what open
+// backorders are owed; demand beyond what is on hand eats into incoming supply first.
+func (uc *ATPUseCase) GetATP(productID uint, variantID *uint) (*AvailableToPromise, error) {
+	levels, err := uc.availability.findShippableStock(productID, variantID)
+	if err != nil {
+		return nil, err
+	}
+
+	atp := &AvailableToPromise{
+		ProductID:   productID,
+		VariantID:   variantID,
+		ByWarehouse: []WarehouseAvailability{},
+		Incoming:    []IncomingSupply{},
+	}
+
+	now := time.Now()
+	for _, inv := range levels {
+		expired := inv.ExpiredQuantity(now)
+		sellable := inv.Quantity - inv.ReservedQuantity - expired
+		atp.OnHand += inv.Quantity
+		atp.Reserved += inv.ReservedQuantity
+		atp.Unsellable += expired
+		atp.ByWarehouse = append(atp.ByWarehouse, WarehouseAvailability{WarehouseID: inv.WarehouseID, Available: max(sellable, 0)})
+	}
+
+	backorders, err := uc.backorderRepo.FindOpenByProduct(productID, variantID)
+	if err != nil {
+		return nil, err
+	}
+	atp.Backordered = inventory.OpenBackorderQuantity(backorders)
+
+	position := atp.OnHand - atp.Reserved - atp.Unsellable - atp.Backordered
+	atp.AvailableNow = max(position, 0)
+
+	incoming, err := uc.findIncoming(productID, variantID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, supply := range incoming {
+		position += supply.Quantity
+		supply.Cumulative = max(position, 0)
+		atp.Incoming = append(atp.Incoming, supply)
+	}
+
+	return atp, nil
+}
+
+// GetAvailableDate returns the first date quantity can be promised, or nil if it cannot be
+func (uc *ATPUseCase) GetAvailableDate(productID uint, variantID *uint, quantity int) (*time.Time, error) {
+	atp, err := uc.GetATP(productID, variantID)
+	if err != nil {
+		return nil, err
+	}
+
+	return atp.AvailableOn(quantity), nil
+}
+
+// findIncoming sums the undelivered quantity of an item on confirmed purchase orders by expected date.
+// Lines on orders without an expected date cannot be promised and are left out.
+func (uc *ATPUseCase) findIncoming(productID uint, variantID *uint) ([]IncomingSupply, error) {
+	byDate := map[time.Time]int{}
+	for _, status := range incomingPOStatuses {
+		orders, err := findStockPurchaseOrders(uc.poRepo, status)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, po := range orders {
+			if po.ExpectedDate == nil {
+				continue
+			}
+
+			date := truncateToDay(*po.ExpectedDate)
+			for _, item := range po.Items {
+				if item.ProductID == productID && inventory.SameVariant(item.VariantID, variantID) {
+					byDate[date] += item.RemainingQuantity()
+				}
+			}
+		}
+	}
+
+	incoming := []IncomingSupply{}
+	for date, quantity := range byDate {
+		if quantity > 0 {
+			incoming = append(incoming, IncomingSupply{Date: date, Quantity: quantity})
+		}
+	}
+
+	sort.Slice(incoming, func(i, j int) bool {
+		return incoming[i].Date.Before(incoming[j].Date)
+	})
+
+	return incoming, nil
+}
+
+// truncateToDay returns midnight at the start of t's day
+func truncateToDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,177 @@
+package inventory
+
+import (
+	"github.com/hydr0g3nz/ecom_mid/domain/inventory"
+	"github.com/hydr0g3nz/ecom_mid/domain/product"
+)
+
+// WarehouseAvailability is the sellable quantity of an item in one warehouse
+type WarehouseAvailability struct {
+	WarehouseID uint `json:"warehouse_id"`
+	Available   int  `json:"available"`
+}
+
+// AvailabilityUseCase is the single place stock availability is read from.
+// Quantities are the sellable stock summed across the warehouses that can ship orders,
+// the same warehouses reservations for orders are made in.
+type AvailabilityUseCase struct {
+	inventoryRepo inventory.InventoryRepository
+	warehouseRepo inventory.WarehouseRepository
+}
+
+// NewAvailabilityUseCase creates a new AvailabilityUseCase
+func NewAvailabilityUseCase(inventoryRepo inventory.InventoryRepository, warehouseRepo inventory.WarehouseRepository) *AvailabilityUseCase {
+	return &AvailabilityUseCase{
+		inventoryRepo: inventoryRepo,
+		warehouseRepo: warehouseRepo,
+	}
+}
+
+// GetAvailableQuantity returns the sellable quantity of a product or variant across shipping warehouses
+func (uc *AvailabilityUseCase) GetAvailableQuantity(productID uint, variantID *uint) (int, error) {
+	levels, err := uc.findShippableStock(productID, variantID)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, inv := range levels {
+		total += inv.GetSellableQuantity()
+	}
+
+	return total, nil
+}
+
+// GetAvailableByWarehouse returns the sellable quantity of a product or variant in each shipping warehouse
+func (uc *AvailabilityUseCase) GetAvailableByWarehouse(productID uint, variantID *uint) ([]WarehouseAvailability, error) {
+	levels, err := uc.findShippableStock(productID, variantID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []WarehouseAvailability{}
+	for _, inv := range levels {
+		result = append(result, WarehouseAvailability{WarehouseID: inv.WarehouseID, Available: inv.GetSellableQuantity()})
+	}
+
+	return result, nil
+}
+
+// GetReservableQuantity returns the most of a product or variant one reservation can take,
+// the sellable quantity of the best stocked shipping warehouse
+func (uc *AvailabilityUseCase) GetReservableQuantity(productID uint, variantID *uint) (int, error) {
+	levels, err := uc.findShippableStock(productID, variantID)
+	if err != nil {
+		return 0, err
+	}
+
+	return largestSellable(levels), nil
+}
+
+// IsAvailable checks if quantity can be sold across shipping warehouses
+func (uc *AvailabilityUseCase) IsAvailable(productID uint, variantID *uint, quantity int) (bool, error) {
+	available, err := uc.GetAvailableQuantity(productID, variantID)
+	if err != nil {
+		return false, err
+	}
+
+	return available >= quantity, nil
+}
+
+// GetBundleQuantity returns how many of a bundle can be built from its components' sellable stock
+func (uc *AvailabilityUseCase) GetBundleQuantity(bundle *product.Product) (int, error) {
+	available := []int{}
+	for _, component := range bundle.Components {
+		quantity, err := uc.GetAvailableQuantity(component.ProductID, component.VariantID)
+		if err != nil {
+			return 0, err
+		}
+		available = append(available, quantity)
+	}
+
+	return bundle.BuildableQuantity(available), nil
+}
+
+// ApplyToProduct fills in the stock quantity of a product and each of its variants.
+// A product with variants is in stock when any of its variants is; a bundle is in
+// stock when all of its components are.
+func (uc *AvailabilityUseCase) ApplyToProduct(prod *product.Product) error {
+	if prod.IsBundle() {
+		available, err := uc.GetBundleQuantity(prod)
+		if err != nil {
+			return err
+		}
+		prod.StockQuantity = available
+		return nil
+	}
+
+	if len(prod.Variants) == 0 {
+		available, err := uc.GetAvailableQuantity(prod.ProductID, nil)
+		if err != nil {
+			return err
+		}
+		prod.StockQuantity = available
+		return nil
+	}
+
+	total := 0
+	for i := range prod.Variants {
+		variantID := prod.Variants[i].VariantID
+		available, err := uc.GetAvailableQuantity(prod.ProductID, &variantID)
+		if err != nil {
+			return err
+		}
+		prod.Variants[i].StockQuantity = available
+		total += available
+	}
+	prod.StockQuantity = total
+
+	return nil
+}
+
+// ApplyToProducts fills in the stock quantities of a page of products
+func (uc *AvailabilityUseCase) ApplyToProducts(products []*product.Product) error {
+	for _, prod := range products {
+		err := uc.ApplyToProduct(prod)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// largestSellable returns the highest sellable quantity among stock records
+func largestSellable(levels []*inventory.Inventory) int {
+	largest := 0
+	for _, inv := range levels {
+		largest = max(largest, inv.GetSellableQuantity())
+	}
+	return largest
+}
+
+// findShippableStock loads a product's stock records in warehouses that can ship orders,
+// with the warehouse attached. Pickup-only and inactive warehouses are left out.
+func (uc *AvailabilityUseCase) findShippableStock(productID uint, variantID *uint) ([]*inventory.Inventory, error) {
+	levels, err := uc.inventoryRepo.FindByProduct(productID, variantID)
+	if err != nil {
+		return nil, err
+	}
+
+	shippable := []*inventory.Inventory{}
+	for _, inv := range levels {
+		if inv.Warehouse == nil {
+			warehouse, err := uc.warehouseRepo.FindByID(inv.WarehouseID)
+			if err != nil {
+				return nil, err
+			}
+			inv.Warehouse = warehouse
+		}
+
+		if inv.Warehouse != nil && inv.Warehouse.CanShip() {
+			shippable = append(shippable, inv)
+		}
+	}
+
+	return shippable, nil
+}
@@ -0,0 +1,181 @@
+package inventory
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/inventory"
+	"github.com/hydr0g3nz/ecom_mid/domain/order"
+	"github.com/hydr0g3nz/ecom_mid/domain/product"
+)
+
+// BackorderUseCase contains the business logic for backorders and pre-orders
+type BackorderUseCase struct {
+	backorderRepo    inventory.BackorderRepository
+	orderRepo        order.OrderRepository
+	inventoryUseCase *InventoryUseCase
+	atpUseCase       *ATPUseCase
+}
+
+// NewBackorderUseCase creates a new BackorderUseCase
+func NewBackorderUseCase(
+	backorderRepo inventory.BackorderRepository,
+	orderRepo order.OrderRepository,
+	inventoryUseCase *InventoryUseCase,
+	atpUseCase *ATPUseCase,
+) *BackorderUseCase {
+	return &BackorderUseCase{
+		backorderRepo:    backorderRepo,
+		orderRepo:        orderRepo,
+		inventoryUseCase: inventoryUseCase,
+		atpUseCase:       atpUseCase,
+	}
+}
+
+// CheckBackorder verifies that quantity of a product can be ordered without stock and returns
+// the date it is expected to ship. The date is nil when no confirmed purchase order covers
+// the queue ahead of it; pre-orders never ship before their release date.
+func (uc *BackorderUseCase) CheckBackorder(prod *product.Product, variantID *uint, quantity int) (*time.Time, error) {
+	backorders, err := uc.backorderRepo.FindOpenByProduct(prod.ProductID, variantID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !prod.CanBackorder(inventory.OpenBackorderQuantity(backorders), quantity) {
+		if prod.AllowBackorder || prod.IsPreOrder() {
+			return nil, errors.New("backorder limit reached for this product")
+		}
+		return nil, errors.New("product cannot be backordered")
+	}
+
+	// Open backorders are netted off by ATP, so this is the date supply reaches this order
+	shipDate, err := uc.atpUseCase.GetAvailableDate(prod.ProductID, variantID, quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	if prod.IsPreOrder() && (shipDate == nil || shipDate.Before(*prod.PreOrderReleaseDate)) {
+		releaseDate := *prod.PreOrderReleaseDate
+		shipDate = &releaseDate
+	}
+
+	return shipDate, nil
+}
+
+// PlaceBackorder queues a backordered order item for stock
+func (uc *BackorderUseCase) PlaceBackorder(item order.OrderItem) (*inventory.Backorder, error) {
+	backorder, err := inventory.NewBackorder(item.OrderID, item.OrderItemID, item.ProductID, item.VariantID, item.Quantity, item.ReleaseDate != nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = uc.backorderRepo.Create(backorder)
+	if err != nil {
+		return nil, err
+	}
+
+	return backorder, nil
+}
+
+// AllocateBackorders reserves stock that has arrived in a warehouse for open backorders,
+// oldest first. Allocation stops at the first backorder the stock cannot cover in full
+// so later orders never jump the queue.
+func (uc *BackorderUseCase) AllocateBackorders(productID uint, variantID *uint, warehouseID uint, staffID uint) error {
+	backorders, err := uc.backorderRepo.FindOpenByProduct(productID, variantID)
+	if err != nil {
+		return err
+	}
+
+	for _, backorder := range backorders {
+		ord, err := uc.orderRepo.FindByID(backorder.OrderID)
+		if err != nil {
+			return err
+		}
+
+		// Orders cancelled elsewhere no longer need the stock
+		if ord == nil || ord.Status == order.OrderStatusCancelled {
+			err = uc.cancel(backorder)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		inv, err := uc.inventoryUseCase.findInventory(productID, warehouseID, variantID)
+		if err != nil {
+			return err
+		}
+
+		if inv.GetSellableQuantity() < backorder.Quantity {
+			return nil
+		}
+
+		// Stock taken by a checkout since it was counted leaves the queue where it is
+		err = uc.inventoryUseCase.ReserveStock(productID, warehouseID, variantID, backorder.Quantity, backorder.OrderID, backorder.OrderItemID, staffID)
+		var shortage *inventory.InsufficientStockError
+		if errors.As(err, &shortage) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = ord.AllocateBackorder(backorder.OrderItemID, warehouseID)
+		if err != nil {
+			return err
+		}
+
+		err = uc.orderRepo.Update(ord)
+		if err != nil {
+			return err
+		}
+
+		err = backorder.Allocate(warehouseID)
+		if err != nil {
+			return err
+		}
+
+		err = uc.backorderRepo.Update(backorder)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CancelOrderBackorders withdraws an order's open backorders from the queue
+func (uc *BackorderUseCase) CancelOrderBackorders(orderID uint) error {
+	backorders, err := uc.backorderRepo.FindByOrder(orderID)
+	if err != nil {
+		return err
+	}
+
+	for _, backorder := range backorders {
+		if !backorder.IsOpen() {
+			continue
+		}
+
+		err = uc.cancel(backorder)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetOpenBackorders gets the backorders waiting for a product, oldest first
+func (uc *BackorderUseCase) GetOpenBackorders(productID uint, variantID *uint) ([]*inventory.Backorder, error) {
+	return uc.backorderRepo.FindOpenByProduct(productID, variantID)
+}
+
+// cancel marks a backorder cancelled
+func (uc *BackorderUseCase) cancel(backorder *inventory.Backorder) error {
+	err := backorder.Cancel()
+	if err != nil {
+		return err
+	}
+
+	return uc.backorderRepo.Update(backorder)
+}
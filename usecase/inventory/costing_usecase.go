@@ -0,0 +1,346 @@
+package inventory
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common/vo"
+	"github.com/hydr0g3nz/ecom_mid/domain/inventory"
+)
+
+// ValuationLine is the quantity and value of one product held in a warehouse
+type ValuationLine struct {
+	ProductID   uint     `json:"product_id"`
+	VariantID   *uint    `json:"variant_id,omitempty"`
+	WarehouseID uint     `json:"warehouse_id"`
+	Quantity    int      `json:"quantity"`
+	Value       vo.Money `json:"value"`
+}
+
+// ValuationReport is the value of a warehouse's stock at a point in time
+type ValuationReport struct {
+	WarehouseID uint            `json:"warehouse_id"`
+	AsOf        time.Time       `json:"as_of"`
+	Lines       []ValuationLine `json:"lines"`
+	TotalValue  vo.Money        `json:"total_value"`
+}
+
+// CostingUseCase contains the business logic for cost layers and inventory valuation
+type CostingUseCase struct {
+	costLayerRepo inventory.CostLayerRepository
+	settingsRepo  inventory.CostingSettingsRepository
+	currency      string
+}
+
+// NewCostingUseCase creates a new CostingUseCase. The costing method is read from the
+// store's settings each time stock is costed, so a change applies from the next movement.
+func NewCostingUseCase(costLayerRepo inventory.CostLayerRepository, settingsRepo inventory.CostingSettingsRepository) *CostingUseCase {
+	return &CostingUseCase{
+		costLayerRepo: costLayerRepo,
+		settingsRepo:  settingsRepo,
+		currency:      "THB",
+	}
+}
+
+// GetCostingMethod gets the store's costing method, FIFO until one is set
+func (uc *CostingUseCase) GetCostingMethod() (inventory.CostingMethod, error) {
+	settings, err := uc.settingsRepo.Get()
+	if err != nil {
+		return "", err
+	}
+
+	if settings == nil || settings.Method == "" {
+		return inventory.CostingMethodFIFO, nil
+	}
+
+	return settings.Method, nil
+}
+
+// SetCostingMethod changes how the store costs stock leaving inventory. Layers already
+// recorded are kept, so the new method applies to them from the next movement.
+func (uc *CostingUseCase) SetCostingMethod(method inventory.CostingMethod, staffID uint) error {
+	if !method.IsValid() {
+		return errors.New("invalid costing method")
+	}
+
+	settings, err := uc.settingsRepo.Get()
+	if err != nil {
+		return err
+	}
+
+	if settings == nil {
+		settings = &inventory.CostingSettings{}
+	}
+
+	settings.Method = method
+	settings.UpdatedBy = staffID
+	settings.UpdatedAt = time.Now()
+	return uc.settingsRepo.Save(settings)
+}
+
+// RecordStockIn creates a cost layer for stock entering a warehouse.
+// When unitCost is nil the layer is valued at the current average cost of the item.
+func (uc *CostingUseCase) RecordStockIn(
+	productID uint,
+	warehouseID uint,
+	variantID *uint,
+	quantity int,
+	unitCost *vo.Money,
+	referenceType inventory.ReferenceType,
+	referenceID uint,
+) error {
+	return uc.recordStockIn(uc.costLayerRepo, productID, warehouseID, variantID, quantity, unitCost, referenceType, referenceID)
+}
+
+// recordStockIn creates a cost layer through costLayerRepo, such as one bound to a stock unit of work
+func (uc *CostingUseCase) recordStockIn(
+	costLayerRepo inventory.CostLayerRepository,
+	productID uint,
+	warehouseID uint,
+	variantID *uint,
+	quantity int,
+	unitCost *vo.Money,
+	referenceType inventory.ReferenceType,
+	referenceID uint,
+) error {
+	cost := unitCost
+	if cost == nil {
+		layers, err := findOpenLayers(costLayerRepo, productID, warehouseID, variantID)
+		if err != nil {
+			return err
+		}
+
+		average, err := inventory.AverageUnitCost(layers, uc.currency)
+		if err != nil {
+			return err
+		}
+		cost = &average
+	}
+
+	layer, err := inventory.NewCostLayer(productID, variantID, warehouseID, quantity, *cost, referenceType, referenceID)
+	if err != nil {
+		return err
+	}
+
+	return costLayerRepo.Create(layer)
+}
+
+// ConsumeStock draws stock leaving a warehouse from its cost layers and returns the total cost
+func (uc *CostingUseCase) ConsumeStock(
+	productID uint,
+	warehouseID uint,
+	variantID *uint,
+	quantity int,
+	referenceType inventory.ReferenceType,
+	referenceID uint,
+) (vo.Money, error) {
+	return uc.consumeStock(uc.costLayerRepo, productID, warehouseID, variantID, quantity, referenceType, referenceID)
+}
+
+// consumeStock draws stock from its cost layers through costLayerRepo, such as one bound
+// to a stock unit of work
+func (uc *CostingUseCase) consumeStock(
+	costLayerRepo inventory.CostLayerRepository,
+	productID uint,
+	warehouseID uint,
+	variantID *uint,
+	quantity int,
+	referenceType inventory.ReferenceType,
+	referenceID uint,
+) (vo.Money, error) {
+	method, err := uc.GetCostingMethod()
+	if err != nil {
+		return vo.Money{}, err
+	}
+
+	layers, err := findOpenLayers(costLayerRepo, productID, warehouseID, variantID)
+	if err != nil {
+		return vo.Money{}, err
+	}
+
+	// Uncosted stock is charged at the last known average so it does not show as free
+	fallbackCost, err := inventory.AverageUnitCost(layers, uc.currency)
+	if err != nil {
+		return vo.Money{}, err
+	}
+
+	consumptions, err := inventory.ConsumeCostLayers(layers, quantity, method, fallbackCost)
+	if err != nil {
+		return vo.Money{}, err
+	}
+
+	for _, layer := range layers {
+		err = costLayerRepo.Update(layer)
+		if err != nil {
+			return vo.Money{}, err
+		}
+	}
+
+	for i := range consumptions {
+		consumptions[i].ProductID = productID
+		consumptions[i].VariantID = variantID
+		consumptions[i].WarehouseID = warehouseID
+		consumptions[i].ReferenceType = referenceType
+		consumptions[i].ReferenceID = referenceID
+
+		err = costLayerRepo.CreateConsumption(&consumptions[i])
+		if err != nil {
+			return vo.Money{}, err
+		}
+	}
+
+	return inventory.TotalConsumedCost(consumptions, uc.currency)
+}
+
+// GetValuationReport values a warehouse's stock as of a date by replaying its
+// cost layers and the consumptions drawn from them up to that date
+func (uc *CostingUseCase) GetValuationReport(warehouseID uint, asOf time.Time) (*ValuationReport, error) {
+	layers, err := uc.costLayerRepo.FindByWarehouseAsOf(warehouseID, asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	consumptions, err := uc.costLayerRepo.FindConsumptionsByWarehouseAsOf(warehouseID, asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := map[stockKey]*ValuationLine{}
+	keys := []stockKey{}
+	lineFor := func(productID uint, variantID *uint) (*ValuationLine, error) {
+		key := stockKey{productID: productID, variantID: variantValue(variantID)}
+		if line, ok := lines[key]; ok {
+			return line, nil
+		}
+
+		zero, err := vo.NewMoney(0, uc.currency)
+		if err != nil {
+			return nil, err
+		}
+
+		line := &ValuationLine{ProductID: productID, VariantID: variantID, WarehouseID: warehouseID, Value: zero}
+		lines[key] = line
+		keys = append(keys, key)
+		return line, nil
+	}
+
+	for _, layer := range layers {
+		line, err := lineFor(layer.ProductID, layer.VariantID)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := layer.UnitCost.Multiply(float64(layer.Quantity))
+		if err != nil {
+			return nil, err
+		}
+
+		line.Quantity += layer.Quantity
+		line.Value, err = line.Value.Add(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, consumption := range consumptions {
+		line, err := lineFor(consumption.ProductID, consumption.VariantID)
+		if err != nil {
+			return nil, err
+		}
+
+		line.Quantity -= consumption.Quantity
+		line.Value, err = line.Value.Subtract(consumption.TotalCost)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	total, err := vo.NewMoney(0, uc.currency)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ValuationReport{WarehouseID: warehouseID, AsOf: asOf, Lines: []ValuationLine{}}
+	for _, key := range keys {
+		line := lines[key]
+		if line.Quantity == 0 && line.Value.IsZero() {
+			continue
+		}
+
+		total, err = total.Add(line.Value)
+		if err != nil {
+			return nil, err
+		}
+		report.Lines = append(report.Lines, *line)
+	}
+	report.TotalValue = total
+
+	return report, nil
+}
+
+// GetCostOfGoods gets the cost recorded against a reference document, such as an order
+func (uc *CostingUseCase) GetCostOfGoods(referenceType inventory.ReferenceType, referenceID uint) (vo.Money, error) {
+	return uc.costOf(referenceType, referenceID, func(*inventory.CostLayerConsumption) bool { return true })
+}
+
+// GetItemCost gets the cost recorded against a reference document for one item leaving a warehouse
+func (uc *CostingUseCase) GetItemCost(
+	referenceType inventory.ReferenceType,
+	referenceID uint,
+	productID uint,
+	warehouseID uint,
+	variantID *uint,
+) (vo.Money, error) {
+	return uc.costOf(referenceType, referenceID, func(consumption *inventory.CostLayerConsumption) bool {
+		return consumption.ProductID == productID && consumption.WarehouseID == warehouseID && inventory.SameVariant(consumption.VariantID, variantID)
+	})
+}
+
+// costOf sums the consumptions recorded against a reference document that match include
+func (uc *CostingUseCase) costOf(
+	referenceType inventory.ReferenceType,
+	referenceID uint,
+	include func(*inventory.CostLayerConsumption) bool,
+) (vo.Money, error) {
+	consumptions, err := uc.costLayerRepo.FindConsumptionsByReference(string(referenceType), referenceID)
+	if err != nil {
+		return vo.Money{}, err
+	}
+
+	total, err := vo.NewMoney(0, uc.currency)
+	if err != nil {
+		return vo.Money{}, err
+	}
+
+	for _, consumption := range consumptions {
+		if !include(consumption) {
+			continue
+		}
+
+		total, err = total.Add(consumption.TotalCost)
+		if err != nil {
+			return vo.Money{}, err
+		}
+	}
+
+	return total, nil
+}
+
+// findOpenLayers loads an item's layers with stock left through costLayerRepo, oldest first
+func findOpenLayers(costLayerRepo inventory.CostLayerRepository, productID, warehouseID uint, variantID *uint) ([]*inventory.CostLayer, error) {
+	if costLayerRepo == nil {
+		return nil, errors.New("cost layer repository is not configured")
+	}
+
+	layers, err := costLayerRepo.FindOpenLayers(productID, warehouseID, variantID)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(layers, func(i, j int) bool {
+		return layers[i].ReceivedAt.Before(layers[j].ReceivedAt)
+	})
+
+	return layers, nil
+}
@@ -0,0 +1,248 @@
+package inventory
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/inventory"
+	"github.com/hydr0g3nz/ecom_mid/domain/user"
+)
+
+// CycleCountUseCase contains the business logic for stock counts and their adjustments
+type CycleCountUseCase struct {
+	countRepo         inventory.CycleCountRepository
+	inventoryRepo     inventory.InventoryRepository
+	warehouseRepo     inventory.WarehouseRepository
+	staffRepo         user.StaffRepository
+	inventoryUseCase  *InventoryUseCase
+	varianceThreshold int
+}
+
+// NewCycleCountUseCase creates a new CycleCountUseCase.
+// Lines whose absolute variance exceeds varianceThreshold units are held for approval.
+func NewCycleCountUseCase(
+	countRepo inventory.CycleCountRepository,
+	inventoryRepo inventory.InventoryRepository,
+	warehouseRepo inventory.WarehouseRepository,
+	staffRepo user.StaffRepository,
+	inventoryUseCase *InventoryUseCase,
+	varianceThreshold int,
+) *CycleCountUseCase {
+	return &CycleCountUseCase{
+		countRepo:         countRepo,
+		inventoryRepo:     inventoryRepo,
+		warehouseRepo:     warehouseRepo,
+		staffRepo:         staffRepo,
+		inventoryUseCase:  inventoryUseCase,
+		varianceThreshold: varianceThreshold,
+	}
+}
+
+// StartCount opens a new count session for a warehouse
+func (uc *CycleCountUseCase) StartCount(warehouseID uint, staffID uint, notes string) (*inventory.CycleCount, error) {
+	warehouse, err := uc.warehouseRepo.FindByID(warehouseID)
+	if err != nil {
+		return nil, err
+	}
+
+	if warehouse == nil {
+		return nil, errors.New("warehouse not found")
+	}
+
+	count, err := inventory.NewCycleCount(warehouseID, staffID, notes)
+	if err != nil {
+		return nil, err
+	}
+
+	err = uc.countRepo.Create(count)
+	if err != nil {
+		return nil, err
+	}
+
+	return count, nil
+}
+
+// RecordCount records the quantity counted for a product, capturing the current system quantity
+func (uc *CycleCountUseCase) RecordCount(countID, productID uint, variantID *uint, countedQuantity int) error {
+	count, err := uc.findCount(countID)
+	if err != nil {
+		return err
+	}
+
+	// Items found on the shelf without an inventory record count against zero
+	systemQuantity, err := uc.systemQuantity(productID, count.WarehouseID, variantID)
+	if err != nil {
+		return err
+	}
+
+	err = count.RecordCount(productID, variantID, systemQuantity, countedQuantity)
+	if err != nil {
+		return err
+	}
+
+	return uc.countRepo.Update(count)
+}
+
+// SubmitCount closes counting, posts adjustments within the threshold and holds the rest for approval
+func (uc *CycleCountUseCase) SubmitCount(countID uint, staffID uint) (*inventory.CycleCount, error) {
+	count, err := uc.findCount(countID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = count.Submit(uc.varianceThreshold)
+	if err != nil {
+		return nil, err
+	}
+
+	err = uc.postReadyLines(count, staffID)
+	if err != nil {
+		return nil, err
+	}
+
+	if count.Status == inventory.CycleCountStatusCounting {
+		err = count.Complete()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = uc.countRepo.Update(count)
+	if err != nil {
+		return nil, err
+	}
+
+	return count, nil
+}
+
+// ApproveCount approves held lines and posts their adjustments
+func (uc *CycleCountUseCase) ApproveCount(countID uint, managerID uint) error {
+	manager, err := uc.staffRepo.FindByID(managerID)
+	if err != nil {
+		return err
+	}
+
+	if manager == nil || !manager.IsActive() {
+		return errors.New("staff not found or inactive")
+	}
+
+	if !manager.HasPermission(inventory.PermissionApproveAdjustment) {
+		return errors.New("staff is not allowed to approve stock adjustments")
+	}
+
+	count, err := uc.findCount(countID)
+	if err != nil {
+		return err
+	}
+
+	err = count.Approve(managerID)
+	if err != nil {
+		return err
+	}
+
+	err = uc.postReadyLines(count, managerID)
+	if err != nil {
+		return err
+	}
+
+	err = count.Complete()
+	if err != nil {
+		return err
+	}
+
+	return uc.countRepo.Update(count)
+}
+
+// RejectCountLine discards a held line so its variance is not posted
+func (uc *CycleCountUseCase) RejectCountLine(countID, lineID uint) error {
+	count, err := uc.findCount(countID)
+	if err != nil {
+		return err
+	}
+
+	err = count.RejectLine(lineID)
+	if err != nil {
+		return err
+	}
+
+	return uc.countRepo.Update(count)
+}
+
+// CancelCount abandons a count session
+func (uc *CycleCountUseCase) CancelCount(countID uint) error {
+	count, err := uc.findCount(countID)
+	if err != nil {
+		return err
+	}
+
+	err = count.Cancel()
+	if err != nil {
+		return err
+	}
+
+	return uc.countRepo.Update(count)
+}
+
+// GetCountByID gets a count session by ID
+func (uc *CycleCountUseCase) GetCountByID(countID uint) (*inventory.CycleCount, error) {
+	return uc.countRepo.FindByID(countID)
+}
+
+// postReadyLines writes an adjustment movement for every line cleared for posting.
+// Each variance is posted as a change against the quantity on hand when the line was
+// counted, so stock that moved while a held line waited for approval is kept.
+func (uc *CycleCountUseCase) postReadyLines(count *inventory.CycleCount, staffID uint) error {
+	for i, line := range count.Lines {
+		if !line.IsReadyToPost() {
+			continue
+		}
+
+		if variance := line.Variance(); variance != 0 {
+			err := uc.inventoryUseCase.AdjustStock(
+				line.ProductID,
+				count.WarehouseID,
+				line.VariantID,
+				variance,
+				count.CountID,
+				staffID,
+				fmt.Sprintf("Cycle count #%d variance", count.CountID),
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		count.MarkLinePosted(i)
+	}
+
+	return nil
+}
+
+// systemQuantity returns the quantity on hand the system holds for an item in a warehouse,
+// counting items without an inventory record as zero
+func (uc *CycleCountUseCase) systemQuantity(productID, warehouseID uint, variantID *uint) (int, error) {
+	inv, err := uc.inventoryRepo.FindByProductAndWarehouse(productID, warehouseID, variantID)
+	if err != nil {
+		return 0, err
+	}
+
+	if inv == nil {
+		return 0, nil
+	}
+
+	return inv.Quantity, nil
+}
+
+// findCount loads an existing count session
+func (uc *CycleCountUseCase) findCount(countID uint) (*inventory.CycleCount, error) {
+	count, err := uc.countRepo.FindByID(countID)
+	if err != nil {
+		return nil, err
+	}
+
+	if count == nil {
+		return nil, errors.New("count session not found")
+	}
+
+	return count, nil
+}
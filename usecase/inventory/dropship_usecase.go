@@ -0,0 +1,313 @@
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common/vo"
+	"github.com/hydr0g3nz/ecom_mid/domain/inventory"
+	"github.com/hydr0g3nz/ecom_mid/domain/order"
+	"github.com/hydr0g3nz/ecom_mid/domain/product"
+)
+
+// DropshipUseCase contains the business logic for order lines shipped by suppliers
+type DropshipUseCase struct {
+	poRepo       inventory.PurchaseOrderRepository
+	supplierRepo inventory.SupplierRepository
+	productRepo  product.ProductRepository
+	orderRepo    order.OrderRepository
+	shipmentRepo order.ShipmentRepository
+}
+
+// NewDropshipUseCase creates a new DropshipUseCase
+func NewDropshipUseCase(
+	poRepo inventory.PurchaseOrderRepository,
+	supplierRepo inventory.SupplierRepository,
+	productRepo product.ProductRepository,
+	orderRepo order.OrderRepository,
+	shipmentRepo order.ShipmentRepository,
+) *DropshipUseCase {
+	return &DropshipUseCase{
+		poRepo:       poRepo,
+		supplierRepo: supplierRepo,
+		productRepo:  productRepo,
+		orderRepo:    orderRepo,
+		shipmentRepo: shipmentRepo,
+	}
+}
+
+// CreatePurchaseOrders raises one purchase order per supplier for a paid order's dropship
+// items, addressed to the customer, and submits them for approval. Each item is linked to
+// its purchase order; the caller saves the order.
+//
+// Dropship purchase orders go through approval like any other: the supplier is only asked
+// to ship, and RecordSupplierShipment only accepts tracking, once one is approved through
+// PurchaseOrderUseCase.ApprovePurchaseOrder.
+//
+// An order has at most one purchase order per supplier. When a call fails partway, or the
+// order could not be saved after it, calling again links the items to the purchase orders
+// already raised instead of raising them twice.
+func (uc *DropshipUseCase) CreatePurchaseOrders(ord *order.Order, shipTo vo.Address) ([]*inventory.PurchaseOrder, error) {
+	raised, err := uc.poRepo.FindByDropshipOrder(ord.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := map[uint]*inventory.PurchaseOrder{}
+	for _, po := range raised {
+		if po.Status != inventory.POStatusCancelled {
+			existing[po.SupplierID] = po
+		}
+	}
+
+	bySupplier := map[uint]*inventory.PurchaseOrder{}
+	supplierOrder := []uint{}
+	itemSupplier := map[int]uint{}
+
+	for i, item := range ord.Items {
+		if !item.IsDropship || item.PurchaseOrderID != nil {
+			continue
+		}
+
+		prod, err := uc.productRepo.FindByID(item.ProductID)
+		if err != nil {
+			return nil, err
+		}
+
+		if prod == nil || !prod.IsDropship {
+			return nil, errors.New("product is no longer dropshipped")
+		}
+
+		supplierID := *prod.DropshipSupplierID
+		if po, ok := existing[supplierID]; ok {
+			poID := po.POID
+			ord.Items[i].PurchaseOrderID = &poID
+			continue
+		}
+
+		po, ok := bySupplier[supplierID]
+		if !ok {
+			supplier, err := uc.supplierRepo.FindByID(supplierID)
+			if err != nil {
+				return nil, err
+			}
+
+			if supplier == nil || !supplier.IsActive() {
+				return nil, errors.New("dropship supplier not found or inactive")
+			}
+
+			po, err = inventory.NewPurchaseOrder(supplierID, 0, nil, fmt.Sprintf("Dropship for order %s", ord.OrderNumber))
+			if err != nil {
+				return nil, err
+			}
+
+			orderID := ord.OrderID
+			address := shipTo
+			po.DropshipOrderID = &orderID
+			po.ShipTo = &address
+
+			bySupplier[supplierID] = po
+			supplierOrder = append(supplierOrder, supplierID)
+		}
+
+		unitCost, err := lastUnitCost(uc.poRepo, uc.productRepo, item.ProductID, item.VariantID)
+		if err != nil {
+			return nil, err
+		}
+
+		totalCost, err := unitCost.Multiply(float64(item.Quantity))
+		if err != nil {
+			return nil, err
+		}
+
+		err = po.AddItem(inventory.PurchaseOrderItem{
+			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			Quantity:  item.Quantity,
+			UnitCost:  unitCost,
+			TotalCost: totalCost,
+		})
+		if err != nil {
+			return nil, err
+		}
+		itemSupplier[i] = supplierID
+	}
+
+	orders := []*inventory.PurchaseOrder{}
+	for _, supplierID := range supplierOrder {
+		po := bySupplier[supplierID]
+
+		err := po.Submit(0, "Dropship order awaiting approval")
+		if err != nil {
+			return nil, err
+		}
+
+		err = uc.poRepo.Create(po)
+		if err != nil {
+			return nil, err
+		}
+
+		orders = append(orders, po)
+	}
+
+	for i, supplierID := range itemSupplier {
+		poID := bySupplier[supplierID].POID
+		ord.Items[i].PurchaseOrderID = &poID
+	}
+
+	return orders, nil
+}
+
+// RecordSupplierShipment records the tracking number a supplier sent for a dropship
+// purchase order on the customer's order, creating the shipment the first time and
+// updating it after. The items' cost of goods is taken from the purchase order. Each call
+// saves the order's cost and status, so a call that failed after recording the shipment
+// can be repeated.
+func (uc *DropshipUseCase) RecordSupplierShipment(
+	poID uint,
+	trackingNumber string,
+	carrier string,
+	expectedDeliveryDate *time.Time,
+	staffID uint,
+) (*order.Shipment, error) {
+	po, err := uc.poRepo.FindByID(poID)
+	if err != nil {
+		return nil, err
+	}
+
+	if po == nil {
+		return nil, errors.New("purchase order not found")
+	}
+
+	err = po.RecordSupplierShipment(trackingNumber, carrier, staffID)
+	if err != nil {
+		return nil, err
+	}
+
+	ord, err := uc.orderRepo.FindByID(*po.DropshipOrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if ord == nil {
+		return nil, errors.New("order not found")
+	}
+
+	shipment := ord.FindSupplierShipment(poID)
+	if shipment != nil {
+		shipment.TrackingNumber = trackingNumber
+		shipment.Carrier = carrier
+		shipment.ExpectedDeliveryDate = expectedDeliveryDate
+		shipment.UpdatedAt = time.Now()
+
+		err = uc.shipmentRepo.Update(shipment)
+		if err != nil {
+			return nil, err
+		}
+
+		// The order may not have been saved when the shipment was first recorded
+		err = ord.RefreshShippingStatus("Order shipped by supplier")
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		newShipment := order.Shipment{
+			OrderID:              ord.OrderID,
+			POID:                 &poID,
+			TrackingNumber:       trackingNumber,
+			Carrier:              carrier,
+			ExpectedDeliveryDate: expectedDeliveryDate,
+			Status:               order.ShipmentStatusPending,
+			CreatedAt:            time.Now(),
+			UpdatedAt:            time.Now(),
+		}
+		newShipment.MarkAsShipped()
+
+		// The order fills in the lines for the purchase order's items
+		err = ord.AddSupplierShipment(newShipment)
+		if err != nil {
+			return nil, err
+		}
+		shipment = &ord.Shipments[len(ord.Shipments)-1]
+
+		err = uc.shipmentRepo.Create(shipment)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = uc.recordCostOfGoods(ord, po)
+	if err != nil {
+		return nil, err
+	}
+
+	err = uc.orderRepo.Update(ord)
+	if err != nil {
+		return nil, err
+	}
+
+	err = uc.poRepo.Update(po)
+	if err != nil {
+		return nil, err
+	}
+
+	return shipment, nil
+}
+
+// CancelPurchaseOrders cancels the dropship purchase orders of a cancelled order
+// that the supplier has not shipped yet
+func (uc *DropshipUseCase) CancelPurchaseOrders(ord *order.Order, staffID uint) error {
+	cancelled := map[uint]bool{}
+	for _, item := range ord.Items {
+		if item.PurchaseOrderID == nil || cancelled[*item.PurchaseOrderID] {
+			continue
+		}
+		cancelled[*item.PurchaseOrderID] = true
+
+		po, err := uc.poRepo.FindByID(*item.PurchaseOrderID)
+		if err != nil {
+			return err
+		}
+
+		if po == nil || po.Status == inventory.POStatusReceived || po.Status == inventory.POStatusCancelled {
+			continue
+		}
+
+		err = po.CancelOrder(staffID, fmt.Sprintf("Order %s cancelled", ord.OrderNumber))
+		if err != nil {
+			return err
+		}
+
+		err = uc.poRepo.Update(po)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recordCostOfGoods sets the cost of the order's items on a dropship purchase order
+func (uc *DropshipUseCase) recordCostOfGoods(ord *order.Order, po *inventory.PurchaseOrder) error {
+	for i, item := range ord.Items {
+		if item.PurchaseOrderID == nil || *item.PurchaseOrderID != po.POID {
+			continue
+		}
+
+		for _, poItem := range po.Items {
+			if poItem.ProductID != item.ProductID || !inventory.SameVariant(poItem.VariantID, item.VariantID) {
+				continue
+			}
+
+			cost, err := poItem.UnitCost.Multiply(float64(item.Quantity))
+			if err != nil {
+				return err
+			}
+			ord.Items[i].CostOfGoods = &cost
+			break
+		}
+	}
+
+	return nil
+}
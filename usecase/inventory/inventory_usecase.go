@@ -0,0 +1,1128 @@
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common/vo"
+	"github.com/hydr0g3nz/ecom_mid/domain/inventory"
+	"github.com/hydr0g3nz/ecom_mid/domain/product"
+)
+
+// ExpiringLot is a lot nearing or past its expiry date
+type ExpiringLot struct {
+	ProductID   uint      `json:"product_id"`
+	VariantID   *uint     `json:"variant_id,omitempty"`
+	WarehouseID uint      `json:"warehouse_id"`
+	LotNumber   string    `json:"lot_number"`
+	ExpiryDate  time.Time `json:"expiry_date"`
+	Quantity    int       `json:"quantity"`
+	Reserved    int       `json:"reserved"`
+	Expired     bool      `json:"expired"`
+}
+
+// A stock change that loses a race for an inventory record waits between minConflictBackoff
+// and maxConflictBackoff before it is tried again against the freshly loaded record
+const (
+	minConflictBackoff = 100 * time.Microsecond
+	maxConflictBackoff = 10 * time.Millisecond
+)
+
+// InventoryUseCase contains the business logic for inventory operations
+type InventoryUseCase struct {
+	inventoryRepo   inventory.InventoryRepository
+	movementRepo    inventory.StockMovementRepository
+	warehouseRepo   inventory.WarehouseRepository
+	reservationRepo inventory.ReservationRepository
+	unitOfWork      inventory.StockUnitOfWork
+	selector        inventory.WarehouseSelector
+	costing         *CostingUseCase
+	locations       *LocationUseCase
+	availability    *AvailabilityUseCase
+	reservationTTL  time.Duration
+}
+
+// NewInventoryUseCase creates a new InventoryUseCase.
+// Every change to an inventory record is saved in one unitOfWork with the reservations,
+// stock movements and cost layers that go with it.
+// Stock movements are costed through costing; pass nil to run without valuation.
+// Availability is read through availability, which also decides the warehouses
+// reservations are made in, so stock shown as available can always be reserved.
+// Stock leaving a warehouse is taken out of its bins through locations; pass nil when
+// warehouses are not organised into bins. Stock coming in waits outside the bins until
+// it is put away. Reservations for orders lapse after reservationTTL unless the order is paid for;
+// zero keeps them until the order ships or is cancelled.
+func NewInventoryUseCase(
+	inventoryRepo inventory.InventoryRepository,
+	movementRepo inventory.StockMovementRepository,
+	warehouseRepo inventory.WarehouseRepository,
+	reservationRepo inventory.ReservationRepository,
+	unitOfWork inventory.StockUnitOfWork,
+	selector inventory.WarehouseSelector,
+	costing *CostingUseCase,
+	locations *LocationUseCase,
+	availability *AvailabilityUseCase,
+	reservationTTL time.Duration,
+) *InventoryUseCase {
+	// Without an explicit strategy, fulfil from wherever stock is deepest
+	if selector == nil {
+		selector = inventory.MostStockSelector{}
+	}
+
+	return &InventoryUseCase{
+		inventoryRepo:   inventoryRepo,
+		movementRepo:    movementRepo,
+		warehouseRepo:   warehouseRepo,
+		reservationRepo: reservationRepo,
+		unitOfWork:      unitOfWork,
+		selector:        selector,
+		costing:         costing,
+		locations:       locations,
+		availability:    availability,
+		reservationTTL:  reservationTTL,
+	}
+}
+
+// AddStock adds stock to a warehouse, creating the inventory record if needed.
+// A nil unitCost values the stock at the item's current average cost.
+func (uc *InventoryUseCase) AddStock(
+	productID uint,
+	warehouseID uint,
+	variantID *uint,
+	quantity int,
+	unitCost *vo.Money,
+	referenceType inventory.ReferenceType,
+	referenceID uint,
+	staffID uint,
+	notes string,
+) error {
+	return uc.addStock(productID, warehouseID, variantID, quantity, nil, unitCost, referenceType, referenceID, staffID, notes)
+}
+
+// AddLotStock adds stock received under a lot number and expiry date to a warehouse
+func (uc *InventoryUseCase) AddLotStock(
+	productID uint,
+	warehouseID uint,
+	variantID *uint,
+	lot inventory.LotQuantity,
+	unitCost *vo.Money,
+	referenceType inventory.ReferenceType,
+	referenceID uint,
+	staffID uint,
+	notes string,
+) error {
+	return uc.addStock(productID, warehouseID, variantID, lot.Quantity, &lot, unitCost, referenceType, referenceID, staffID, notes)
+}
+
+// addStock books stock into a warehouse, into a lot when one is given
+func (uc *InventoryUseCase) addStock(
+	productID uint,
+	warehouseID uint,
+	variantID *uint,
+	quantity int,
+	lot *inventory.LotQuantity,
+	unitCost *vo.Money,
+	referenceType inventory.ReferenceType,
+	referenceID uint,
+	staffID uint,
+	notes string,
+) error {
+	// Verify warehouse exists
+	warehouse, err := uc.warehouseRepo.FindByID(warehouseID)
+	if err != nil {
+		return err
+	}
+
+	if warehouse == nil {
+		return errors.New("warehouse not found")
+	}
+
+	lots := []inventory.LotQuantity{}
+	if lot != nil {
+		lots = append(lots, *lot)
+	}
+
+	// The stock, its cost layer and its movement are saved together or not at all
+	return uc.transact(func(tx stockTx) error {
+		inv, err := tx.inventories.FindByProductAndWarehouse(productID, warehouseID, variantID)
+		if err != nil {
+			return err
+		}
+
+		// First receipt into this warehouse creates the inventory record
+		if inv == nil {
+			inv = &inventory.Inventory{
+				ProductID:   productID,
+				VariantID:   variantID,
+				WarehouseID: warehouseID,
+			}
+			err = uc.addToInventory(inv, quantity, lot)
+			if err != nil {
+				return err
+			}
+			err = tx.inventories.Create(inv)
+		} else {
+			err = uc.addToInventory(inv, quantity, lot)
+			if err != nil {
+				return err
+			}
+			err = tx.inventories.Update(inv)
+		}
+		if err != nil {
+			return err
+		}
+
+		if uc.costing != nil {
+			err = uc.costing.recordStockIn(tx.costLayers, productID, warehouseID, variantID, quantity, unitCost, referenceType, referenceID)
+			if err != nil {
+				return err
+			}
+		}
+
+		return recordMovement(tx.movements, inv, quantity, lots, inventory.MovementTypeIn, referenceType, referenceID, staffID, notes)
+	})
+}
+
+// addToInventory books quantity onto a loaded inventory record, into a lot when one is given
+func (uc *InventoryUseCase) addToInventory(inv *inventory.Inventory, quantity int, lot *inventory.LotQuantity) error {
+	if lot != nil {
+		return inv.AddLotStock(lot.LotNumber, lot.ExpiryDate, quantity)
+	}
+	return inv.AddStock(quantity)
+}
+
+// RemoveStock removes stock from a warehouse and returns the cost of the stock removed
+func (uc *InventoryUseCase) RemoveStock(
+	productID uint,
+	warehouseID uint,
+	variantID *uint,
+	quantity int,
+	referenceType inventory.ReferenceType,
+	referenceID uint,
+	staffID uint,
+	notes string,
+) (vo.Money, error) {
+	cost, _, err := uc.removeStock(productID, warehouseID, variantID, quantity, referenceType, referenceID, staffID, notes)
+	return cost, err
+}
+
+// removeStock removes stock from a warehouse and returns its cost and the lots it was drawn from.
+// The stock, its cost and its movements are saved together; the bins are brought in line after.
+func (uc *InventoryUseCase) removeStock(
+	productID uint,
+	warehouseID uint,
+	variantID *uint,
+	quantity int,
+	referenceType inventory.ReferenceType,
+	referenceID uint,
+	staffID uint,
+	notes string,
+) (vo.Money, []inventory.LotQuantity, error) {
+	var inv *inventory.Inventory
+	var lots []inventory.LotQuantity
+	var cost vo.Money
+	err := uc.transact(func(tx stockTx) error {
+		var err error
+		inv, lots, err = uc.takeAvailableStock(tx, productID, warehouseID, variantID, quantity)
+		if err != nil {
+			return err
+		}
+
+		cost, err = uc.consumeCost(tx, inv, quantity, referenceType, referenceID)
+		if err != nil {
+			return err
+		}
+
+		return recordMovement(tx.movements, inv, quantity, lots, inventory.MovementTypeOut, referenceType, referenceID, staffID, notes)
+	})
+	if err != nil {
+		return vo.Money{}, nil, err
+	}
+
+	err = uc.takeFromBins(inv, referenceType, referenceID, staffID)
+	if err != nil {
+		return vo.Money{}, nil, err
+	}
+
+	return cost, lots, nil
+}
+
+// takeAvailableStock removes unreserved stock from an inventory record and saves it within tx,
+// returning the record and the lots the stock was drawn from
+func (uc *InventoryUseCase) takeAvailableStock(
+	tx stockTx,
+	productID uint,
+	warehouseID uint,
+	variantID *uint,
+	quantity int,
+) (*inventory.Inventory, []inventory.LotQuantity, error) {
+	inv, err := loadInventory(tx.inventories, productID, warehouseID, variantID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Reserved stock is promised to orders and cannot be removed
+	if inv.GetAvailableQuantity() < quantity {
+		return nil, nil, &inventory.InsufficientStockError{
+			ProductID:   productID,
+			VariantID:   variantID,
+			WarehouseID: warehouseID,
+			Requested:   quantity,
+			Available:   max(inv.GetAvailableQuantity(), 0),
+		}
+	}
+
+	lots, err := inv.RemoveLots(quantity)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = tx.inventories.Update(inv)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return inv, lots, nil
+}
+
+// ReserveStock reserves stock in a warehouse for an order item. Concurrent reservations
+// against the same stock are serialised by the inventory record's version, so a shortfall
+// is reported as an *inventory.InsufficientStockError rather than oversold.
+func (uc *InventoryUseCase) ReserveStock(
+	productID uint,
+	warehouseID uint,
+	variantID *uint,
+	quantity int,
+	orderID uint,
+	orderItemID uint,
+	staffID uint,
+) error {
+	// Inactive warehouses cannot take on new reservations
+	warehouse, err := uc.warehouseRepo.FindByID(warehouseID)
+	if err != nil {
+		return err
+	}
+
+	if warehouse == nil || !warehouse.IsActive() {
+		return errors.New("warehouse not found or inactive")
+	}
+
+	return uc.transact(func(tx stockTx) error {
+		inv, lots, err := uc.reserveStock(tx, productID, warehouseID, variantID, quantity, orderID, orderItemID)
+		if err != nil {
+			return err
+		}
+
+		return recordMovement(tx.movements, inv, quantity, lots, inventory.MovementTypeReserve, inventory.ReferenceTypeOrder, orderID, staffID, "Stock reserved for order")
+	})
+}
+
+// reserveStock makes one attempt at a reservation against the inventory record as loaded
+func (uc *InventoryUseCase) reserveStock(
+	tx stockTx,
+	productID uint,
+	warehouseID uint,
+	variantID *uint,
+	quantity int,
+	orderID uint,
+	orderItemID uint,
+) (*inventory.Inventory, []inventory.LotQuantity, error) {
+	inv, err := loadInventory(tx.inventories, productID, warehouseID, variantID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reservation, err := inventory.NewReservation(orderID, orderItemID, productID, variantID, warehouseID, quantity, uc.reservationTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Reserve first-expiring lots first; expired lots are never reserved
+	lots, err := inv.ReserveLots(quantity, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The conditional write decides the race; the reservation is kept only if it wins
+	err = tx.inventories.Update(inv)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = tx.reservations.Create(reservation)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return inv, lots, nil
+}
+
+// ReserveForOrder selects a warehouse that can fulfil the whole quantity and reserves it there.
+// It returns the ID of the warehouse holding the reservation. When no single warehouse holds
+// the quantity, the *inventory.InsufficientStockError reports the most one of them could give.
+func (uc *InventoryUseCase) ReserveForOrder(
+	productID uint,
+	variantID *uint,
+	quantity int,
+	orderID uint,
+	orderItemID uint,
+	shippingProvince string,
+	staffID uint,
+) (uint, error) {
+	if quantity <= 0 {
+		return 0, errors.New("quantity must be greater than zero")
+	}
+
+	// Only the stock counted as available can be reserved
+	candidates, err := uc.availability.findShippableStock(productID, variantID)
+	if err != nil {
+		return 0, err
+	}
+
+	selected := uc.selector.Select(candidates, quantity, shippingProvince)
+	if selected == nil {
+		return 0, &inventory.InsufficientStockError{
+			ProductID: productID,
+			VariantID: variantID,
+			Requested: quantity,
+			Available: largestSellable(candidates),
+		}
+	}
+
+	err = uc.ReserveStock(productID, selected.WarehouseID, variantID, quantity, orderID, orderItemID, staffID)
+	if err != nil {
+		return 0, err
+	}
+
+	return selected.WarehouseID, nil
+}
+
+// ReleaseReservedStock releases stock previously reserved for an order item
+func (uc *InventoryUseCase) ReleaseReservedStock(
+	productID uint,
+	warehouseID uint,
+	variantID *uint,
+	quantity int,
+	orderID uint,
+	orderItemID uint,
+	staffID uint,
+) error {
+	return uc.transact(func(tx stockTx) error {
+		inv, lots, err := uc.releaseReservedStock(tx, productID, warehouseID, variantID, quantity, orderID, orderItemID)
+		if err != nil {
+			return err
+		}
+
+		return recordMovement(tx.movements, inv, quantity, lots, inventory.MovementTypeRelease, inventory.ReferenceTypeOrder, orderID, staffID, "Reserved stock released")
+	})
+}
+
+// releaseReservedStock makes one attempt at a release. The reservations are read in the
+// same transaction as the inventory record, so a release that loses the race reads them again.
+func (uc *InventoryUseCase) releaseReservedStock(
+	tx stockTx,
+	productID uint,
+	warehouseID uint,
+	variantID *uint,
+	quantity int,
+	orderID uint,
+	orderItemID uint,
+) (*inventory.Inventory, []inventory.LotQuantity, error) {
+	held, err := findHeldReservations(tx.reservations, orderID, orderItemID, productID, variantID, warehouseID, quantity)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inv, err := loadInventory(tx.inventories, productID, warehouseID, variantID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lots, err := uc.findOrderLots(inv, orderID, quantity)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = inv.ReleaseLots(quantity, lots)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = tx.inventories.Update(inv)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = settleReservations(tx.reservations, held, quantity, (*inventory.Reservation).Release)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return inv, lots, nil
+}
+
+// CommittedStock is stock CommitReservedStock took out of a warehouse for an order,
+// kept so the commit can be undone when the rest of a shipment fails
+type CommittedStock struct {
+	ProductID   uint
+	WarehouseID uint
+	VariantID   *uint
+	OrderID     uint
+	OrderItemID uint
+	Quantity    int
+	Lots        []inventory.LotQuantity
+	Cost        vo.Money
+}
+
+// CommitReservedStock deducts stock previously reserved for an order item and returns what
+// was taken, with its cost in currency, the currency the order is in
+func (uc *InventoryUseCase) CommitReservedStock(
+	productID uint,
+	warehouseID uint,
+	variantID *uint,
+	quantity int,
+	orderID uint,
+	orderItemID uint,
+	currency string,
+	staffID uint,
+) (*CommittedStock, error) {
+	// Cost layers are not converted, so the order has to be in the currency stock is costed in
+	if uc.costing != nil && uc.costing.currency != currency {
+		return nil, fmt.Errorf("stock is costed in %s, not in the order's currency %s", uc.costing.currency, currency)
+	}
+
+	var inv *inventory.Inventory
+	var lots []inventory.LotQuantity
+	var cost vo.Money
+	err := uc.transact(func(tx stockTx) error {
+		var err error
+		inv, lots, err = uc.commitReservedStock(tx, productID, warehouseID, variantID, quantity, orderID, orderItemID)
+		if err != nil {
+			return err
+		}
+
+		cost, err = uc.consumeCost(tx, inv, quantity, inventory.ReferenceTypeOrder, orderID)
+		if err != nil {
+			return err
+		}
+
+		return recordMovement(tx.movements, inv, quantity, lots, inventory.MovementTypeOut, inventory.ReferenceTypeOrder, orderID, staffID, "Reserved stock committed")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Uncosted stock is free in the order's currency
+	if uc.costing == nil {
+		cost = vo.Money{Currency: currency}
+	}
+
+	err = uc.takeFromBins(inv, inventory.ReferenceTypeOrder, orderID, staffID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CommittedStock{
+		ProductID:   productID,
+		WarehouseID: warehouseID,
+		VariantID:   variantID,
+		OrderID:     orderID,
+		OrderItemID: orderItemID,
+		Quantity:    quantity,
+		Lots:        lots,
+		Cost:        cost,
+	}, nil
+}
+
+// commitReservedStock makes one attempt at a commit, reading the reservations in the same
+// transaction as the inventory record like releaseReservedStock
+func (uc *InventoryUseCase) commitReservedStock(
+	tx stockTx,
+	productID uint,
+	warehouseID uint,
+	variantID *uint,
+	quantity int,
+	orderID uint,
+	orderItemID uint,
+) (*inventory.Inventory, []inventory.LotQuantity, error) {
+	held, err := findHeldReservations(tx.reservations, orderID, orderItemID, productID, variantID, warehouseID, quantity)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inv, err := loadInventory(tx.inventories, productID, warehouseID, variantID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lots, err := uc.findOrderLots(inv, orderID, quantity)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = inv.CommitLots(quantity, lots)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = tx.inventories.Update(inv)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = settleReservations(tx.reservations, held, quantity, (*inventory.Reservation).Commit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return inv, lots, nil
+}
+
+// UndoCommit puts stock committed for a shipment that could not be completed back on hand,
+// at the cost it left at, and reserves it for the order item again
+func (uc *InventoryUseCase) UndoCommit(commit *CommittedStock, staffID uint) error {
+	return uc.transact(func(tx stockTx) error {
+		reservation, err := inventory.NewReservation(commit.OrderID, commit.OrderItemID, commit.ProductID, commit.VariantID, commit.WarehouseID, commit.Quantity, 0)
+		if err != nil {
+			return err
+		}
+
+		inv, err := loadInventory(tx.inventories, commit.ProductID, commit.WarehouseID, commit.VariantID)
+		if err != nil {
+			return err
+		}
+
+		err = inv.UncommitLots(commit.Quantity, commit.Lots)
+		if err != nil {
+			return err
+		}
+
+		err = tx.inventories.Update(inv)
+		if err != nil {
+			return err
+		}
+
+		err = tx.reservations.Create(reservation)
+		if err != nil {
+			return err
+		}
+
+		if uc.costing != nil {
+			// Kept unrounded so the layer adds back up to the cost that was consumed
+			unitCost := vo.Money{Amount: commit.Cost.Amount / float64(commit.Quantity), Currency: commit.Cost.Currency}
+			err = uc.costing.recordStockIn(tx.costLayers, commit.ProductID, commit.WarehouseID, commit.VariantID, commit.Quantity, &unitCost, inventory.ReferenceTypeOrder, commit.OrderID)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = recordMovement(tx.movements, inv, commit.Quantity, commit.Lots, inventory.MovementTypeIn, inventory.ReferenceTypeOrder, commit.OrderID, staffID, "Committed stock returned")
+		if err != nil {
+			return err
+		}
+
+		return recordMovement(tx.movements, inv, commit.Quantity, commit.Lots, inventory.MovementTypeReserve, inventory.ReferenceTypeOrder, commit.OrderID, staffID, "Committed stock reserved again")
+	})
+}
+
+// AdjustStock corrects the on-hand quantity by a signed delta
+func (uc *InventoryUseCase) AdjustStock(
+	productID uint,
+	warehouseID uint,
+	variantID *uint,
+	delta int,
+	referenceID uint,
+	staffID uint,
+	reason string,
+) error {
+	if delta == 0 {
+		return errors.New("adjustment cannot be zero")
+	}
+
+	if reason == "" {
+		return errors.New("adjustment reason is required")
+	}
+
+	if delta > 0 {
+		// Found stock carries no invoice, so it is valued at the current average cost
+		return uc.AddStock(productID, warehouseID, variantID, delta, nil, inventory.ReferenceTypeAdjustment, referenceID, staffID, reason)
+	}
+
+	// A negative adjustment may not eat into stock already promised to orders
+	_, _, err := uc.removeStock(productID, warehouseID, variantID, -delta, inventory.ReferenceTypeAdjustment, referenceID, staffID, reason)
+	return err
+}
+
+// PostUnrecordedChange posts a change of delta units that was made to an inventory record
+// without a stock movement. The quantity on hand already includes the change, so only its
+// movement and cost are written, in one unit of work. The movement references the inventory
+// record.
+func (uc *InventoryUseCase) PostUnrecordedChange(
+	productID uint,
+	warehouseID uint,
+	variantID *uint,
+	delta int,
+	staffID uint,
+	reason string,
+) error {
+	if delta == 0 {
+		return errors.New("adjustment cannot be zero")
+	}
+
+	return uc.transact(func(tx stockTx) error {
+		inv, err := loadInventory(tx.inventories, productID, warehouseID, variantID)
+		if err != nil {
+			return err
+		}
+
+		if delta < 0 {
+			_, err = uc.consumeCost(tx, inv, -delta, inventory.ReferenceTypeAdjustment, inv.InventoryID)
+			if err != nil {
+				return err
+			}
+			return writeMovement(tx.movements, inv, -delta, nil, inventory.MovementTypeOut, inventory.ReferenceTypeAdjustment, inv.InventoryID, staffID, reason)
+		}
+
+		// Found stock carries no invoice, so it is valued at the current average cost
+		if uc.costing != nil {
+			err = uc.costing.recordStockIn(tx.costLayers, productID, warehouseID, variantID, delta, nil, inventory.ReferenceTypeAdjustment, inv.InventoryID)
+			if err != nil {
+				return err
+			}
+		}
+		return writeMovement(tx.movements, inv, delta, nil, inventory.MovementTypeIn, inventory.ReferenceTypeAdjustment, inv.InventoryID, staffID, reason)
+	})
+}
+
+// GetStockLevels gets the inventory records for a product across all warehouses
+func (uc *InventoryUseCase) GetStockLevels(productID uint, variantID *uint) ([]*inventory.Inventory, error) {
+	return uc.inventoryRepo.FindByProduct(productID, variantID)
+}
+
+// GetAvailableQuantity returns the total sellable quantity across the warehouses that can ship orders
+func (uc *InventoryUseCase) GetAvailableQuantity(productID uint, variantID *uint) (int, error) {
+	return uc.availability.GetAvailableQuantity(productID, variantID)
+}
+
+// GetReservableQuantity returns the most of a product or variant ReserveForOrder can reserve
+// at once, since a reservation is held in a single warehouse
+func (uc *InventoryUseCase) GetReservableQuantity(productID uint, variantID *uint) (int, error) {
+	return uc.availability.GetReservableQuantity(productID, variantID)
+}
+
+// GetBundleQuantity returns how many of a bundle can be built from component stock
+func (uc *InventoryUseCase) GetBundleQuantity(bundle *product.Product) (int, error) {
+	return uc.availability.GetBundleQuantity(bundle)
+}
+
+// GetMovements gets the stock movements recorded for a reference document
+func (uc *InventoryUseCase) GetMovements(referenceType inventory.ReferenceType, referenceID uint) ([]*inventory.StockMovement, error) {
+	return uc.movementRepo.FindByReference(string(referenceType), referenceID)
+}
+
+// movedStock sums what the movements of a type recorded against a reference document moved
+// of an item in a warehouse, with the lots they touched. Documents that move their items one
+// at a time use it to skip the items a retry finds already moved.
+func (uc *InventoryUseCase) movedStock(
+	productID uint,
+	warehouseID uint,
+	variantID *uint,
+	movementType inventory.MovementType,
+	referenceType inventory.ReferenceType,
+	referenceID uint,
+) (int, []inventory.LotQuantity, error) {
+	movements, err := uc.movementRepo.FindByReference(string(referenceType), referenceID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	quantity := 0
+	lots := []inventory.LotQuantity{}
+	for _, m := range movements {
+		if m.Type != movementType || m.ProductID != productID || m.WarehouseID != warehouseID || !inventory.SameVariant(m.VariantID, variantID) {
+			continue
+		}
+
+		quantity += m.Quantity
+		if m.LotNumber != "" {
+			lots = append(lots, inventory.LotQuantity{LotNumber: m.LotNumber, ExpiryDate: m.ExpiryDate, Quantity: m.Quantity})
+		}
+	}
+
+	return quantity, lots, nil
+}
+
+// movedCost gets the cost charged against a reference document for an item that left a
+// warehouse. Without costing configured the stock is treated as free.
+func (uc *InventoryUseCase) movedCost(
+	productID uint,
+	warehouseID uint,
+	variantID *uint,
+	referenceType inventory.ReferenceType,
+	referenceID uint,
+) (vo.Money, error) {
+	if uc.costing == nil {
+		return vo.NewMoney(0, "THB")
+	}
+
+	return uc.costing.GetItemCost(referenceType, referenceID, productID, warehouseID, variantID)
+}
+
+// GetExpiringLots lists the lots in a warehouse that expire within the given number of days,
+// including lots that have already expired
+func (uc *InventoryUseCase) GetExpiringLots(warehouseID uint, days int) ([]ExpiringLot, error) {
+	levels, err := uc.inventoryRepo.FindByWarehouse(warehouseID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	window := time.Duration(days) * 24 * time.Hour
+
+	expiring := []ExpiringLot{}
+	for _, inv := range levels {
+		for _, lot := range inv.Lots {
+			if !lot.ExpiresWithin(now, window) {
+				continue
+			}
+
+			expiring = append(expiring, ExpiringLot{
+				ProductID:   inv.ProductID,
+				VariantID:   inv.VariantID,
+				WarehouseID: inv.WarehouseID,
+				LotNumber:   lot.LotNumber,
+				ExpiryDate:  *lot.ExpiryDate,
+				Quantity:    lot.Quantity,
+				Reserved:    lot.ReservedQuantity,
+				Expired:     lot.IsExpired(now),
+			})
+		}
+	}
+
+	sort.SliceStable(expiring, func(i, j int) bool {
+		return expiring[i].ExpiryDate.Before(expiring[j].ExpiryDate)
+	})
+
+	return expiring, nil
+}
+
+// GetLotMovements traces a lot through receipts, transfers and the orders it shipped on
+func (uc *InventoryUseCase) GetLotMovements(lotNumber string) ([]*inventory.StockMovement, error) {
+	return uc.movementRepo.FindByLot(lotNumber)
+}
+
+// findOrderLots works out which lots hold an order's outstanding reservation from its
+// movement history and picks up to quantity from them, first-expiring first
+func (uc *InventoryUseCase) findOrderLots(inv *inventory.Inventory, orderID uint, quantity int) ([]inventory.LotQuantity, error) {
+	if !inv.IsLotTracked() {
+		return nil, nil
+	}
+
+	movements, err := uc.movementRepo.FindByReference(string(inventory.ReferenceTypeOrder), orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	outstanding := map[string]int{}
+	for _, m := range movements {
+		if m.LotNumber == "" || m.WarehouseID != inv.WarehouseID || m.ProductID != inv.ProductID || !inventory.SameVariant(m.VariantID, inv.VariantID) {
+			continue
+		}
+
+		switch m.Type {
+		case inventory.MovementTypeReserve:
+			outstanding[m.LotNumber] += m.Quantity
+		case inventory.MovementTypeRelease, inventory.MovementTypeOut:
+			outstanding[m.LotNumber] -= m.Quantity
+		}
+	}
+
+	reserved := []inventory.LotQuantity{}
+	for lotNumber, qty := range outstanding {
+		if qty > 0 {
+			reserved = append(reserved, inventory.LotQuantity{LotNumber: lotNumber, Quantity: qty})
+		}
+	}
+
+	return inv.SelectReservedLots(reserved, quantity), nil
+}
+
+// HoldReservations stops an order's reservations from lapsing, once it has been paid for
+func (uc *InventoryUseCase) HoldReservations(orderID uint) error {
+	return uc.transact(func(tx stockTx) error {
+		reservations, err := tx.reservations.FindByOrder(orderID)
+		if err != nil {
+			return err
+		}
+
+		for _, reservation := range reservations {
+			if !reservation.IsActive() || reservation.ExpiresAt == nil {
+				continue
+			}
+
+			reservation.Hold()
+			err = tx.reservations.Update(reservation)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetOrderReservations gets the reservations made for an order
+func (uc *InventoryUseCase) GetOrderReservations(orderID uint) ([]*inventory.Reservation, error) {
+	return uc.reservationRepo.FindByOrder(orderID)
+}
+
+// GetExpiredReservations gets the active reservations that have outlived their time to live
+func (uc *InventoryUseCase) GetExpiredReservations(asOf time.Time) ([]*inventory.Reservation, error) {
+	return uc.reservationRepo.FindExpired(asOf)
+}
+
+// findHeldReservations gets the active reservations an order item holds of stock in a
+// warehouse, oldest first, checking that together they cover quantity
+func findHeldReservations(
+	reservationRepo inventory.ReservationRepository,
+	orderID uint,
+	orderItemID uint,
+	productID uint,
+	variantID *uint,
+	warehouseID uint,
+	quantity int,
+) ([]*inventory.Reservation, error) {
+	reservations, err := reservationRepo.FindByOrder(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	held := []*inventory.Reservation{}
+	for _, reservation := range reservations {
+		if reservation.Holds(orderItemID, productID, variantID, warehouseID) {
+			held = append(held, reservation)
+		}
+	}
+
+	if inventory.ReservedQuantity(held) < quantity {
+		return nil, errors.New("order does not hold enough reserved stock")
+	}
+
+	sort.SliceStable(held, func(i, j int) bool {
+		return held[i].CreatedAt.Before(held[j].CreatedAt)
+	})
+
+	return held, nil
+}
+
+// settleReservations commits or releases quantity from held reservations, oldest first
+func settleReservations(
+	reservationRepo inventory.ReservationRepository,
+	held []*inventory.Reservation,
+	quantity int,
+	settle func(*inventory.Reservation, int) error,
+) error {
+	remaining := quantity
+	for _, reservation := range held {
+		if remaining == 0 {
+			break
+		}
+
+		settled := min(reservation.Quantity, remaining)
+		err := settle(reservation, settled)
+		if err != nil {
+			return err
+		}
+
+		err = reservationRepo.Update(reservation)
+		if err != nil {
+			return err
+		}
+		remaining -= settled
+	}
+
+	return nil
+}
+
+// RecountReservedStock resets an inventory record's reserved quantity to the total of
+// the active reservations against it. Reservations are saved with the reserved quantity
+// they account for, so the two only drift apart when edited outside the application.
+func (uc *InventoryUseCase) RecountReservedStock(productID, warehouseID uint, variantID *uint) error {
+	return uc.transact(func(tx stockTx) error {
+		inv, err := loadInventory(tx.inventories, productID, warehouseID, variantID)
+		if err != nil {
+			return err
+		}
+
+		active, err := tx.reservations.FindActiveByStock(productID, warehouseID, variantID)
+		if err != nil {
+			return err
+		}
+
+		inv.ReservedQuantity = inventory.ReservedQuantity(active)
+		inv.UpdatedAt = time.Now()
+		return tx.inventories.Update(inv)
+	})
+}
+
+// stockTx is the repositories of one unit of work
+type stockTx struct {
+	inventories  inventory.InventoryRepository
+	reservations inventory.ReservationRepository
+	movements    inventory.StockMovementRepository
+	costLayers   inventory.CostLayerRepository
+}
+
+// transact runs change as one unit of work, running it again each time it loses a race
+// for an inventory record or reservation. Either everything change writes is saved or none of it.
+func (uc *InventoryUseCase) transact(change func(tx stockTx) error) error {
+	return retryOnConflict(func() error {
+		return uc.unitOfWork.Do(func(repos inventory.StockRepositories) error {
+			return change(stockTx{
+				inventories:  repos.Inventories,
+				reservations: repos.Reservations,
+				movements:    repos.Movements,
+				costLayers:   repos.CostLayers,
+			})
+		})
+	})
+}
+
+// retryOnConflict runs change again each time it loses a race for an inventory record,
+// until it settles. Every conflict means another change was saved, so the record keeps
+// moving on; the wait between tries doubles, with jitter, so racing changes spread out.
+func retryOnConflict(change func() error) error {
+	backoff := minConflictBackoff
+	for {
+		err := change()
+		if !errors.Is(err, inventory.ErrConcurrentUpdate) {
+			return err
+		}
+
+		time.Sleep(backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1)))
+		backoff = min(backoff*2, maxConflictBackoff)
+	}
+}
+
+// findInventory loads an existing inventory record
+func (uc *InventoryUseCase) findInventory(productID, warehouseID uint, variantID *uint) (*inventory.Inventory, error) {
+	return loadInventory(uc.inventoryRepo, productID, warehouseID, variantID)
+}
+
+// loadInventory loads an existing inventory record through inventoryRepo
+func loadInventory(inventoryRepo inventory.InventoryRepository, productID, warehouseID uint, variantID *uint) (*inventory.Inventory, error) {
+	inv, err := inventoryRepo.FindByProductAndWarehouse(productID, warehouseID, variantID)
+	if err != nil {
+		return nil, err
+	}
+
+	if inv == nil {
+		return nil, errors.New("inventory not found for this product and warehouse")
+	}
+
+	return inv, nil
+}
+
+// consumeCost charges stock leaving a warehouse against its cost layers within tx.
+// Without costing configured the stock is treated as free.
+func (uc *InventoryUseCase) consumeCost(
+	tx stockTx,
+	inv *inventory.Inventory,
+	quantity int,
+	referenceType inventory.ReferenceType,
+	referenceID uint,
+) (vo.Money, error) {
+	if uc.costing == nil {
+		return vo.NewMoney(0, "THB")
+	}
+
+	return uc.costing.consumeStock(tx.costLayers, inv.ProductID, inv.WarehouseID, inv.VariantID, quantity, referenceType, referenceID)
+}
+
+// takeFromBins brings the bins in line with stock that has just left the warehouse
+func (uc *InventoryUseCase) takeFromBins(inv *inventory.Inventory, referenceType inventory.ReferenceType, referenceID uint, staffID uint) error {
+	if uc.locations == nil {
+		return nil
+	}
+
+	return uc.locations.RemoveFromBins(inv.ProductID, inv.VariantID, inv.WarehouseID, inv.Quantity, referenceType, referenceID, staffID)
+}
+
+// recordMovement writes the stock movements for an inventory change through movementRepo,
+// one per lot touched plus one for any quantity held outside lots
+func recordMovement(
+	movementRepo inventory.StockMovementRepository,
+	inv *inventory.Inventory,
+	quantity int,
+	lots []inventory.LotQuantity,
+	movementType inventory.MovementType,
+	referenceType inventory.ReferenceType,
+	referenceID uint,
+	staffID uint,
+	notes string,
+) error {
+	untracked := quantity
+	for _, lot := range lots {
+		err := writeMovement(movementRepo, inv, lot.Quantity, &lot, movementType, referenceType, referenceID, staffID, notes)
+		if err != nil {
+			return err
+		}
+		untracked -= lot.Quantity
+	}
+
+	if untracked <= 0 {
+		return nil
+	}
+
+	return writeMovement(movementRepo, inv, untracked, nil, movementType, referenceType, referenceID, staffID, notes)
+}
+
+// writeMovement writes a single stock movement through movementRepo, of a lot when one is given
+func writeMovement(
+	movementRepo inventory.StockMovementRepository,
+	inv *inventory.Inventory,
+	quantity int,
+	lot *inventory.LotQuantity,
+	movementType inventory.MovementType,
+	referenceType inventory.ReferenceType,
+	referenceID uint,
+	staffID uint,
+	notes string,
+) error {
+	movement := inventory.StockMovement{
+		ProductID:     inv.ProductID,
+		VariantID:     inv.VariantID,
+		WarehouseID:   inv.WarehouseID,
+		Quantity:      quantity,
+		Type:          movementType,
+		ReferenceType: referenceType,
+		ReferenceID:   referenceID,
+		Notes:         notes,
+		CreatedAt:     time.Now(),
+		StaffID:       staffID,
+	}
+
+	if lot != nil {
+		movement.LotNumber = lot.LotNumber
+		movement.ExpiryDate = lot.ExpiryDate
+	}
+
+	return movementRepo.Create(&movement)
+}
+
+// stockKey identifies a product or variant independently of warehouse
+type stockKey struct {
+	productID uint
+	variantID uint
+}
+
+// variantValue returns the variant ID, or zero for products without variants
+func variantValue(variantID *uint) uint {
+	if variantID == nil {
+		return 0
+	}
+	return *variantID
+}
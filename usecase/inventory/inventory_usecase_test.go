@@ -0,0 +1,284 @@
+package inventory
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/inventory"
+)
+
+const (
+	testProductID   = 1
+	testWarehouseID = 1
+)
+
+// checkReservedStock fails the test unless the record's reserved quantity is within its stock
+// and matches the active reservations behind it
+func checkReservedStock(t *testing.T, store *memoryStock, id uint) inventory.Inventory {
+	t.Helper()
+
+	inv := store.inventory(id)
+	if inv.ReservedQuantity < 0 || inv.ReservedQuantity > inv.Quantity {
+		t.Fatalf("reserved %d of %d in stock", inv.ReservedQuantity, inv.Quantity)
+	}
+
+	if active := store.activeReserved(inv); active != inv.ReservedQuantity {
+		t.Fatalf("record shows %d reserved, active reservations hold %d", inv.ReservedQuantity, active)
+	}
+
+	return inv
+}
+
+func TestReserveStockNeverOversellsUnderConcurrentCheckouts(t *testing.T) {
+	const (
+		stock     = 500
+		checkouts = 2000
+	)
+
+	store := newMemoryStock()
+	id := store.add(inventory.Inventory{ProductID: testProductID, WarehouseID: testWarehouseID, Quantity: stock})
+	uc := newTestInventoryUseCase(store, testWarehouseID)
+
+	var reserved, shortages atomic.Int64
+	var wg sync.WaitGroup
+	errs := make(chan error, checkouts)
+	for i := 0; i < checkouts; i++ {
+		wg.Add(1)
+		go func(orderID uint) {
+			defer wg.Done()
+
+			err := uc.ReserveStock(testProductID, testWarehouseID, nil, 1, orderID, orderID, 0)
+			var shortage *inventory.InsufficientStockError
+			switch {
+			case err == nil:
+				reserved.Add(1)
+			case errors.As(err, &shortage):
+				shortages.Add(1)
+			default:
+				errs <- err
+			}
+		}(uint(i + 1))
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if reserved.Load() != stock {
+		t.Fatalf("reserved %d units, want exactly the %d in stock", reserved.Load(), stock)
+	}
+
+	if shortages.Load() != checkouts-stock {
+		t.Fatalf("%d checkouts were turned away, want %d", shortages.Load(), checkouts-stock)
+	}
+
+	inv := checkReservedStock(t, store, id)
+	if inv.ReservedQuantity != stock {
+		t.Fatalf("record shows %d reserved, want %d", inv.ReservedQuantity, stock)
+	}
+}
+
+func TestConcurrentReleasesOfOneReservationReleaseItOnce(t *testing.T) {
+	const releases = 1000
+
+	store := newMemoryStock()
+	id := store.add(inventory.Inventory{ProductID: testProductID, WarehouseID: testWarehouseID, Quantity: 10})
+	uc := newTestInventoryUseCase(store, testWarehouseID)
+
+	// Another order's reservation must survive the double release untouched
+	err := uc.ReserveStock(testProductID, testWarehouseID, nil, 3, 1, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = uc.ReserveStock(testProductID, testWarehouseID, nil, 4, 2, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var released atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < releases; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := uc.ReleaseReservedStock(testProductID, testWarehouseID, nil, 3, 1, 1, 0)
+			if err == nil {
+				released.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if released.Load() != 1 {
+		t.Fatalf("reservation released %d times, want once", released.Load())
+	}
+
+	inv := checkReservedStock(t, store, id)
+	if inv.ReservedQuantity != 4 {
+		t.Fatalf("record shows %d reserved, want the other order's 4", inv.ReservedQuantity)
+	}
+}
+
+func TestConcurrentCommitsTakeEachReservationOnce(t *testing.T) {
+	const (
+		orders  = 200
+		retries = 5
+	)
+
+	store := newMemoryStock()
+	id := store.add(inventory.Inventory{ProductID: testProductID, WarehouseID: testWarehouseID, Quantity: orders + 10})
+	uc := newTestInventoryUseCase(store, testWarehouseID)
+
+	for orderID := uint(1); orderID <= orders; orderID++ {
+		err := uc.ReserveStock(testProductID, testWarehouseID, nil, 1, orderID, orderID, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each order's shipment is committed several times at once, as retried requests would be
+	var committed atomic.Int64
+	var wg sync.WaitGroup
+	for orderID := uint(1); orderID <= orders; orderID++ {
+		for i := 0; i < retries; i++ {
+			wg.Add(1)
+			go func(orderID uint) {
+				defer wg.Done()
+
+				_, err := uc.CommitReservedStock(testProductID, testWarehouseID, nil, 1, orderID, orderID, "THB", 0)
+				if err == nil {
+					committed.Add(1)
+				}
+			}(orderID)
+		}
+	}
+	wg.Wait()
+
+	if committed.Load() != orders {
+		t.Fatalf("%d commits went through, want one for each of the %d orders", committed.Load(), orders)
+	}
+
+	inv := checkReservedStock(t, store, id)
+	if inv.Quantity != 10 || inv.ReservedQuantity != 0 {
+		t.Fatalf("%d on hand with %d reserved, want 10 with none reserved", inv.Quantity, inv.ReservedQuantity)
+	}
+}
+
+func TestReserveStockKeepsNothingWhenTheReservationCannotBeSaved(t *testing.T) {
+	store := newMemoryStock()
+	id := store.add(inventory.Inventory{ProductID: testProductID, WarehouseID: testWarehouseID, Quantity: 10})
+	uc := newTestInventoryUseCase(store, testWarehouseID)
+
+	store.failReservationWrites = true
+	err := uc.ReserveStock(testProductID, testWarehouseID, nil, 4, 1, 1, 0)
+	if err == nil {
+		t.Fatal("reservation succeeded without being saved")
+	}
+
+	inv := checkReservedStock(t, store, id)
+	if inv.ReservedQuantity != 0 {
+		t.Fatalf("record shows %d reserved after a failed reservation, want 0", inv.ReservedQuantity)
+	}
+}
+
+func TestReleaseKeepsTheReservationWhenItCannotBeSettled(t *testing.T) {
+	store := newMemoryStock()
+	id := store.add(inventory.Inventory{ProductID: testProductID, WarehouseID: testWarehouseID, Quantity: 10})
+	uc := newTestInventoryUseCase(store, testWarehouseID)
+
+	err := uc.ReserveStock(testProductID, testWarehouseID, nil, 4, 1, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.failReservationWrites = true
+	err = uc.ReleaseReservedStock(testProductID, testWarehouseID, nil, 4, 1, 1, 0)
+	if err == nil {
+		t.Fatal("release succeeded without settling the reservation")
+	}
+
+	inv := checkReservedStock(t, store, id)
+	if inv.ReservedQuantity != 4 {
+		t.Fatalf("record shows %d reserved, want the 4 still held", inv.ReservedQuantity)
+	}
+}
+
+func TestStockChangesKeepNothingWhenTheirMovementCannotBeSaved(t *testing.T) {
+	store := newMemoryStock()
+	id := store.add(inventory.Inventory{ProductID: testProductID, WarehouseID: testWarehouseID, Quantity: 10})
+	uc := newTestInventoryUseCase(store, testWarehouseID)
+
+	store.failMovementWrites = true
+	err := uc.AddStock(testProductID, testWarehouseID, nil, 5, nil, inventory.ReferenceTypeAdjustment, 1, 0, "Found on the shelf")
+	if err == nil {
+		t.Fatal("stock was added without its movement")
+	}
+
+	_, err = uc.RemoveStock(testProductID, testWarehouseID, nil, 4, inventory.ReferenceTypeAdjustment, 1, 0, "Damaged")
+	if err == nil {
+		t.Fatal("stock was removed without its movement")
+	}
+
+	if inv := store.inventory(id); inv.Quantity != 10 {
+		t.Fatalf("%d on hand after failed changes, want the 10 the ledger accounts for", inv.Quantity)
+	}
+
+	if movements := store.movementsOf(testProductID, testWarehouseID); len(movements) != 0 {
+		t.Fatalf("%d movements saved for failed changes", len(movements))
+	}
+}
+
+func TestUnrecordedChangeIsPostedWithoutMovingStockAgain(t *testing.T) {
+	store := newMemoryStock()
+	id := store.add(inventory.Inventory{ProductID: testProductID, WarehouseID: testWarehouseID, Quantity: 7})
+	uc := newTestInventoryUseCase(store, testWarehouseID)
+
+	err := uc.PostUnrecordedChange(testProductID, testWarehouseID, nil, -3, 0, "Ledger reconciliation")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if inv := store.inventory(id); inv.Quantity != 7 {
+		t.Fatalf("%d on hand after posting the change, want the 7 already there", inv.Quantity)
+	}
+
+	movements := store.movementsOf(testProductID, testWarehouseID)
+	if len(movements) != 1 || movements[0].OnHandDelta() != -3 {
+		t.Fatalf("movements %+v, want one taking out 3", movements)
+	}
+}
+
+func TestReserveForOrderReportsWhatOneWarehouseCanGive(t *testing.T) {
+	const otherWarehouseID = 2
+	store := newMemoryStock()
+	store.add(inventory.Inventory{ProductID: testProductID, WarehouseID: testWarehouseID, Quantity: 3})
+	store.add(inventory.Inventory{ProductID: testProductID, WarehouseID: otherWarehouseID, Quantity: 4})
+	uc := newTestInventoryUseCase(store, testWarehouseID, otherWarehouseID)
+
+	reservable, err := uc.GetReservableQuantity(testProductID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reservable != 4 {
+		t.Fatalf("%d reservable, want the 4 in the best stocked warehouse", reservable)
+	}
+
+	_, err = uc.ReserveForOrder(testProductID, nil, 5, 1, 1, "", 0)
+	var shortage *inventory.InsufficientStockError
+	if !errors.As(err, &shortage) || shortage.Available != 4 {
+		t.Fatalf("reserving 5 across two warehouses gave %v, want a shortage with 4 available", err)
+	}
+
+	warehouseID, err := uc.ReserveForOrder(testProductID, nil, 4, 1, 1, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if warehouseID != otherWarehouseID {
+		t.Fatalf("reserved in warehouse %d, want %d", warehouseID, otherWarehouseID)
+	}
+}
@@ -0,0 +1,541 @@
+package inventory
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/inventory"
+	"github.com/hydr0g3nz/ecom_mid/domain/order"
+)
+
+// LocationUseCase contains the business logic for bin locations, put-away and picking
+type LocationUseCase struct {
+	locationRepo  inventory.LocationRepository
+	binStockRepo  inventory.BinStockRepository
+	movementRepo  inventory.StockMovementRepository
+	warehouseRepo inventory.WarehouseRepository
+}
+
+// NewLocationUseCase creates a new LocationUseCase
+func NewLocationUseCase(
+	locationRepo inventory.LocationRepository,
+	binStockRepo inventory.BinStockRepository,
+	movementRepo inventory.StockMovementRepository,
+	warehouseRepo inventory.WarehouseRepository,
+) *LocationUseCase {
+	return &LocationUseCase{
+		locationRepo:  locationRepo,
+		binStockRepo:  binStockRepo,
+		movementRepo:  movementRepo,
+		warehouseRepo: warehouseRepo,
+	}
+}
+
+// CreateLocation adds a zone, aisle, shelf or bin to a warehouse
+func (uc *LocationUseCase) CreateLocation(
+	warehouseID uint,
+	parentID *uint,
+	locationType inventory.LocationType,
+	code string,
+) (*inventory.Location, error) {
+	warehouse, err := uc.warehouseRepo.FindByID(warehouseID)
+	if err != nil {
+		return nil, err
+	}
+
+	if warehouse == nil {
+		return nil, errors.New("warehouse not found")
+	}
+
+	var parent *inventory.Location
+	if parentID != nil {
+		parent, err = uc.locationRepo.FindByID(*parentID)
+		if err != nil {
+			return nil, err
+		}
+
+		if parent == nil {
+			return nil, errors.New("parent location not found")
+		}
+	}
+
+	location, err := inventory.NewLocation(warehouseID, parent, locationType, code)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := uc.locationRepo.FindByPath(warehouseID, location.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing != nil {
+		return nil, errors.New("location already exists")
+	}
+
+	err = uc.locationRepo.Create(location)
+	if err != nil {
+		return nil, err
+	}
+
+	return location, nil
+}
+
+// CheckBin verifies that a location is an active bin in the given warehouse
+func (uc *LocationUseCase) CheckBin(locationID, warehouseID uint) (*inventory.Location, error) {
+	location, err := uc.locationRepo.FindByID(locationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if location == nil || !location.IsActive {
+		return nil, errors.New("location not found or inactive")
+	}
+
+	if !location.IsBin() {
+		return nil, errors.New("stock can only be stored in bins")
+	}
+
+	if location.WarehouseID != warehouseID {
+		return nil, errors.New("bin is in a different warehouse")
+	}
+
+	// Quarantined stock is not part of sellable inventory and only arrives through Quarantine
+	if location.IsQuarantine {
+		return nil, errors.New("bin is reserved for quarantined stock")
+	}
+
+	return location, nil
+}
+
+// SetQuarantine marks a bin as holding quarantined returns, or clears the mark.
+// The mark can only change while the bin is empty.
+func (uc *LocationUseCase) SetQuarantine(locationID uint, quarantine bool) error {
+	location, err := uc.locationRepo.FindByID(locationID)
+	if err != nil {
+		return err
+	}
+
+	if location == nil {
+		return errors.New("location not found")
+	}
+
+	contents, err := uc.binStockRepo.FindByLocation(locationID)
+	if err != nil {
+		return err
+	}
+
+	if len(contents) > 0 {
+		return errors.New("bin must be empty to change its quarantine mark")
+	}
+
+	err = location.SetQuarantine(quarantine)
+	if err != nil {
+		return err
+	}
+
+	return uc.locationRepo.Update(location)
+}
+
+// Quarantine places returned stock into a quarantine bin. The stock stays out of
+// the warehouse's inventory, so it can never be reserved or picked.
+func (uc *LocationUseCase) Quarantine(
+	productID uint,
+	variantID *uint,
+	warehouseID uint,
+	locationID uint,
+	quantity int,
+	referenceType inventory.ReferenceType,
+	referenceID uint,
+	staffID uint,
+) error {
+	location, err := uc.locationRepo.FindByID(locationID)
+	if err != nil {
+		return err
+	}
+
+	if location == nil || !location.IsActive || !location.IsQuarantine {
+		return errors.New("quarantine bin not found or inactive")
+	}
+
+	if location.WarehouseID != warehouseID {
+		return errors.New("bin is in a different warehouse")
+	}
+
+	err = uc.addToBin(productID, variantID, locationID, quantity)
+	if err != nil {
+		return err
+	}
+
+	return uc.recordMove(productID, variantID, warehouseID, nil, &locationID, quantity, referenceType, referenceID, staffID, "Quarantined")
+}
+
+// PutAway places received stock into a bin
+func (uc *LocationUseCase) PutAway(
+	productID uint,
+	variantID *uint,
+	warehouseID uint,
+	locationID uint,
+	quantity int,
+	referenceType inventory.ReferenceType,
+	referenceID uint,
+	staffID uint,
+) error {
+	_, err := uc.CheckBin(locationID, warehouseID)
+	if err != nil {
+		return err
+	}
+
+	err = uc.addToBin(productID, variantID, locationID, quantity)
+	if err != nil {
+		return err
+	}
+
+	return uc.recordMove(productID, variantID, warehouseID, nil, &locationID, quantity, referenceType, referenceID, staffID, "Put away")
+}
+
+// MoveBetweenBins moves stock from one bin to another in the same warehouse
+func (uc *LocationUseCase) MoveBetweenBins(
+	productID uint,
+	variantID *uint,
+	fromLocationID uint,
+	toLocationID uint,
+	quantity int,
+	staffID uint,
+	notes string,
+) error {
+	if fromLocationID == toLocationID {
+		return errors.New("source and destination bins must differ")
+	}
+
+	from, err := uc.locationRepo.FindByID(fromLocationID)
+	if err != nil {
+		return err
+	}
+
+	if from == nil {
+		return errors.New("source bin not found")
+	}
+
+	if from.IsQuarantine {
+		return errors.New("quarantined stock cannot be moved into sellable bins")
+	}
+
+	_, err = uc.CheckBin(toLocationID, from.WarehouseID)
+	if err != nil {
+		return err
+	}
+
+	err = uc.removeFromBin(productID, variantID, fromLocationID, quantity)
+	if err != nil {
+		return err
+	}
+
+	err = uc.addToBin(productID, variantID, toLocationID, quantity)
+	if err != nil {
+		return err
+	}
+
+	return uc.recordMove(productID, variantID, from.WarehouseID, &fromLocationID, &toLocationID, quantity, inventory.ReferenceTypeRelocation, 0, staffID, notes)
+}
+
+// BuildPickLists plans where to pick each of an order's items, one list per warehouse,
+// drawing from the fullest bins first and sorting each list by bin path
+func (uc *LocationUseCase) BuildPickLists(ord *order.Order) ([]*inventory.PickList, error) {
+	lists := map[uint]*inventory.PickList{}
+	warehouses := []uint{}
+
+	// Bins are shared between lines for the same product so a bin is never planned twice
+	type binKey struct {
+		warehouseID uint
+		stock       stockKey
+	}
+	loaded := map[binKey][]*inventory.BinStock{}
+
+	for _, pick := range orderPicks(ord) {
+		list, ok := lists[pick.warehouseID]
+		if !ok {
+			list = &inventory.PickList{OrderID: ord.OrderID, WarehouseID: pick.warehouseID, Lines: []inventory.PickLine{}}
+			lists[pick.warehouseID] = list
+			warehouses = append(warehouses, pick.warehouseID)
+		}
+
+		key := binKey{warehouseID: pick.warehouseID, stock: stockKey{productID: pick.productID, variantID: variantValue(pick.variantID)}}
+		bins, ok := loaded[key]
+		if !ok {
+			var err error
+			bins, err = uc.findBins(pick.productID, pick.warehouseID, pick.variantID)
+			if err != nil {
+				return nil, err
+			}
+			loaded[key] = bins
+		}
+
+		remaining := pick.quantity
+		for _, bin := range bins {
+			if remaining == 0 {
+				break
+			}
+
+			if bin.Quantity <= 0 {
+				continue
+			}
+
+			quantity := min(bin.Quantity, remaining)
+			locationID := bin.LocationID
+			list.Lines = append(list.Lines, inventory.PickLine{
+				OrderItemID: pick.orderItemID,
+				ProductID:   pick.productID,
+				VariantID:   pick.variantID,
+				LocationID:  &locationID,
+				Path:        bin.Location.Path,
+				Quantity:    quantity,
+			})
+
+			bin.Quantity -= quantity
+			remaining -= quantity
+		}
+
+		// Stock that has not been put away yet is picked from the receiving area
+		if remaining > 0 {
+			list.Lines = append(list.Lines, inventory.PickLine{
+				OrderItemID: pick.orderItemID,
+				ProductID:   pick.productID,
+				VariantID:   pick.variantID,
+				Quantity:    remaining,
+			})
+		}
+	}
+
+	result := []*inventory.PickList{}
+	for _, warehouseID := range warehouses {
+		lists[warehouseID].SortByPath()
+		result = append(result, lists[warehouseID])
+	}
+
+	return result, nil
+}
+
+// orderPick is stock to pick for an order item from one warehouse
+type orderPick struct {
+	orderItemID uint
+	productID   uint
+	variantID   *uint
+	warehouseID uint
+	quantity    int
+}
+
+// orderPicks lists the stock reserved for what is still to ship of an order's items.
+// Bundle items are picked as their components; items without a reservation are left out.
+func orderPicks(ord *order.Order) []orderPick {
+	picks := []orderPick{}
+	for _, item := range ord.Items {
+		remaining := ord.RemainingQuantity(item.OrderItemID)
+		if remaining == 0 {
+			continue
+		}
+
+		for _, component := range item.Components {
+			if component.WarehouseID != nil {
+				picks = append(picks, orderPick{item.OrderItemID, component.ProductID, component.VariantID, *component.WarehouseID, item.ComponentUnits(component, remaining)})
+			}
+		}
+
+		if item.WarehouseID != nil {
+			picks = append(picks, orderPick{item.OrderItemID, item.ProductID, item.VariantID, *item.WarehouseID, remaining})
+		}
+	}
+	return picks
+}
+
+// ConfirmPick takes picked stock out of its bins
+func (uc *LocationUseCase) ConfirmPick(list *inventory.PickList, staffID uint) error {
+	for _, line := range list.Lines {
+		if line.LocationID == nil {
+			continue
+		}
+
+		err := uc.removeFromBin(line.ProductID, line.VariantID, *line.LocationID, line.Quantity)
+		if err != nil {
+			return err
+		}
+
+		err = uc.recordMove(line.ProductID, line.VariantID, list.WarehouseID, line.LocationID, nil, line.Quantity, inventory.ReferenceTypeOrder, list.OrderID, staffID, "Picked")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RemoveFromBins takes stock that has left a warehouse out of its bins, so that no more than
+// onHand units stay binned. Stock picked or not yet put away is outside the bins and goes
+// first; the rest comes out of the fullest bins.
+func (uc *LocationUseCase) RemoveFromBins(
+	productID uint,
+	variantID *uint,
+	warehouseID uint,
+	onHand int,
+	referenceType inventory.ReferenceType,
+	referenceID uint,
+	staffID uint,
+) error {
+	bins, err := uc.findBins(productID, warehouseID, variantID)
+	if err != nil {
+		return err
+	}
+
+	excess := -onHand
+	for _, bin := range bins {
+		excess += bin.Quantity
+	}
+
+	for _, bin := range bins {
+		if excess <= 0 {
+			break
+		}
+
+		quantity := min(bin.Quantity, excess)
+		if quantity <= 0 {
+			continue
+		}
+
+		locationID := bin.LocationID
+		err = uc.removeFromBin(productID, variantID, locationID, quantity)
+		if err != nil {
+			return err
+		}
+
+		err = uc.recordMove(productID, variantID, warehouseID, &locationID, nil, quantity, referenceType, referenceID, staffID, "Left the warehouse")
+		if err != nil {
+			return err
+		}
+		excess -= quantity
+	}
+
+	return nil
+}
+
+// GetBinContents gets the stock held in a bin
+func (uc *LocationUseCase) GetBinContents(locationID uint) ([]*inventory.BinStock, error) {
+	return uc.binStockRepo.FindByLocation(locationID)
+}
+
+// GetLocations gets every location in a warehouse
+func (uc *LocationUseCase) GetLocations(warehouseID uint) ([]*inventory.Location, error) {
+	return uc.locationRepo.FindByWarehouse(warehouseID)
+}
+
+// findBins loads the bins holding a product in a warehouse, fullest first, with their locations attached
+func (uc *LocationUseCase) findBins(productID, warehouseID uint, variantID *uint) ([]*inventory.BinStock, error) {
+	bins, err := uc.binStockRepo.FindByProduct(productID, warehouseID, variantID)
+	if err != nil {
+		return nil, err
+	}
+
+	sellable := []*inventory.BinStock{}
+	for _, bin := range bins {
+		if bin.Location == nil {
+			bin.Location, err = uc.locationRepo.FindByID(bin.LocationID)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if bin.Location == nil {
+			return nil, errors.New("bin location not found")
+		}
+
+		// Quarantined stock is never picked
+		if !bin.Location.IsQuarantine {
+			sellable = append(sellable, bin)
+		}
+	}
+	bins = sellable
+
+	sort.SliceStable(bins, func(i, j int) bool {
+		return bins[i].Quantity > bins[j].Quantity
+	})
+
+	return bins, nil
+}
+
+// addToBin adds quantity to a product's stock in a bin, creating the record if needed
+func (uc *LocationUseCase) addToBin(productID uint, variantID *uint, locationID uint, quantity int) error {
+	bin, err := uc.binStockRepo.FindByLocationAndProduct(locationID, productID, variantID)
+	if err != nil {
+		return err
+	}
+
+	if bin == nil {
+		bin = &inventory.BinStock{LocationID: locationID, ProductID: productID, VariantID: variantID}
+		err = bin.AddStock(quantity)
+		if err != nil {
+			return err
+		}
+		return uc.binStockRepo.Create(bin)
+	}
+
+	err = bin.AddStock(quantity)
+	if err != nil {
+		return err
+	}
+
+	return uc.binStockRepo.Update(bin)
+}
+
+// removeFromBin takes quantity out of a product's stock in a bin, dropping the record once empty
+func (uc *LocationUseCase) removeFromBin(productID uint, variantID *uint, locationID uint, quantity int) error {
+	bin, err := uc.binStockRepo.FindByLocationAndProduct(locationID, productID, variantID)
+	if err != nil {
+		return err
+	}
+
+	if bin == nil {
+		return errors.New("product is not stored in this bin")
+	}
+
+	err = bin.RemoveStock(quantity)
+	if err != nil {
+		return err
+	}
+
+	if bin.Quantity == 0 {
+		return uc.binStockRepo.Delete(bin.BinStockID)
+	}
+
+	return uc.binStockRepo.Update(bin)
+}
+
+// recordMove writes a bin-to-bin movement; a nil location is the receiving or dispatch area
+func (uc *LocationUseCase) recordMove(
+	productID uint,
+	variantID *uint,
+	warehouseID uint,
+	fromLocationID *uint,
+	toLocationID *uint,
+	quantity int,
+	referenceType inventory.ReferenceType,
+	referenceID uint,
+	staffID uint,
+	notes string,
+) error {
+	movement := inventory.StockMovement{
+		ProductID:      productID,
+		VariantID:      variantID,
+		WarehouseID:    warehouseID,
+		Quantity:       quantity,
+		Type:           inventory.MovementTypeTransfer,
+		ReferenceType:  referenceType,
+		ReferenceID:    referenceID,
+		FromLocationID: fromLocationID,
+		ToLocationID:   toLocationID,
+		Notes:          notes,
+		CreatedAt:      time.Now(),
+		StaffID:        staffID,
+	}
+
+	return uc.movementRepo.Create(&movement)
+}
@@ -0,0 +1,375 @@
+package inventory
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/inventory"
+)
+
+// memoryStock is an in-memory store of inventory records, reservations and stock movements.
+// Its writes are conditional on Version like the database's, and its unit of work stages writes
+// and applies them all at once, or none of them when a record it wrote has changed since it was read.
+type memoryStock struct {
+	mu           sync.Mutex
+	inventories  map[uint]inventory.Inventory
+	reservations map[uint]inventory.Reservation
+	movements    []inventory.StockMovement
+	nextID       uint
+
+	failReservationWrites bool // Makes every reservation write fail, to interrupt a unit of work
+	failMovementWrites    bool // Makes every movement write fail, to interrupt a unit of work
+}
+
+// newMemoryStock creates an empty store
+func newMemoryStock() *memoryStock {
+	return &memoryStock{
+		inventories:  map[uint]inventory.Inventory{},
+		reservations: map[uint]inventory.Reservation{},
+	}
+}
+
+// add saves a new inventory record as is and returns its ID
+func (s *memoryStock) add(inv inventory.Inventory) uint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	inv.InventoryID = s.nextID
+	s.inventories[inv.InventoryID] = copyInventory(inv)
+	return inv.InventoryID
+}
+
+// inventory returns a copy of a stored inventory record
+func (s *memoryStock) inventory(id uint) inventory.Inventory {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return copyInventory(s.inventories[id])
+}
+
+// activeReserved sums the quantity held by stored active reservations against an inventory record
+func (s *memoryStock) activeReserved(inv inventory.Inventory) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	total := 0
+	for _, r := range s.reservations {
+		if r.IsActive() && r.ProductID == inv.ProductID && r.WarehouseID == inv.WarehouseID && inventory.SameVariant(r.VariantID, inv.VariantID) {
+			total += r.Quantity
+		}
+	}
+	return total
+}
+
+// movementsOf returns copies of the stored movements of a product in a warehouse
+func (s *memoryStock) movementsOf(productID, warehouseID uint) []inventory.StockMovement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := []inventory.StockMovement{}
+	for _, m := range s.movements {
+		if m.ProductID == productID && m.WarehouseID == warehouseID {
+			found = append(found, m)
+		}
+	}
+	return found
+}
+
+// Do runs work against repositories that stage its writes, then applies them in one step.
+// Cost layers are not kept, so the use cases run without costing.
+func (s *memoryStock) Do(work func(repos inventory.StockRepositories) error) error {
+	tx := &memoryTx{
+		store:        s,
+		inventories:  map[uint]inventory.Inventory{},
+		reservations: map[uint]inventory.Reservation{},
+	}
+
+	err := work(inventory.StockRepositories{
+		Inventories:  &memoryInventoryRepo{tx: tx},
+		Reservations: &memoryReservationRepo{tx: tx},
+		Movements:    &memoryMovementRepo{tx: tx},
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.commit()
+}
+
+// memoryTx holds the writes of one unit of work until it commits
+type memoryTx struct {
+	store        *memoryStock
+	inventories  map[uint]inventory.Inventory   // Updated records, at the version they were loaded at
+	reservations map[uint]inventory.Reservation // Updated reservations, at the version they were loaded at
+	created      []inventory.Reservation
+	movements    []inventory.StockMovement
+}
+
+// outside checks if the repositories are used directly rather than within a unit of work
+func (tx *memoryTx) outside() bool {
+	return tx.inventories == nil
+}
+
+// commit applies the staged writes if nothing they overwrite has changed since it was read
+func (tx *memoryTx) commit() error {
+	s := tx.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, inv := range tx.inventories {
+		if s.inventories[id].Version != inv.Version {
+			return inventory.ErrConcurrentUpdate
+		}
+	}
+	for id, r := range tx.reservations {
+		if s.reservations[id].Version != r.Version {
+			return inventory.ErrConcurrentUpdate
+		}
+	}
+
+	for id, inv := range tx.inventories {
+		inv.Version++
+		s.inventories[id] = inv
+	}
+	for id, r := range tx.reservations {
+		r.Version++
+		s.reservations[id] = r
+	}
+	for _, r := range tx.created {
+		s.nextID++
+		r.ReservationID = s.nextID
+		s.reservations[r.ReservationID] = r
+	}
+	s.movements = append(s.movements, tx.movements...)
+	return nil
+}
+
+// memoryInventoryRepo reads and writes inventory records within a unit of work
+type memoryInventoryRepo struct {
+	inventory.InventoryRepository // Methods the tests do not need are left unimplemented
+	tx                            *memoryTx
+}
+
+func (r *memoryInventoryRepo) FindByProductAndWarehouse(productID, warehouseID uint, variantID *uint) (*inventory.Inventory, error) {
+	for _, inv := range r.all() {
+		if inv.ProductID == productID && inv.WarehouseID == warehouseID && inventory.SameVariant(inv.VariantID, variantID) {
+			return inv, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryInventoryRepo) FindByProduct(productID uint, variantID *uint) ([]*inventory.Inventory, error) {
+	levels := []*inventory.Inventory{}
+	for _, inv := range r.all() {
+		if inv.ProductID == productID && inventory.SameVariant(inv.VariantID, variantID) {
+			levels = append(levels, inv)
+		}
+	}
+	return levels, nil
+}
+
+// all returns copies of every record, as the unit of work sees them. It yields after
+// reading so concurrent callers interleave between their reads and writes as they would
+// against a database.
+func (r *memoryInventoryRepo) all() []*inventory.Inventory {
+	defer runtime.Gosched()
+
+	s := r.tx.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all := []*inventory.Inventory{}
+	for id, inv := range s.inventories {
+		if staged, ok := r.tx.inventories[id]; ok {
+			inv = staged
+		}
+		found := copyInventory(inv)
+		all = append(all, &found)
+	}
+	return all
+}
+
+// Update stages the record, failing at once if it was loaded from a stale copy.
+// Outside a unit of work the write commits on its own.
+func (r *memoryInventoryRepo) Update(inv *inventory.Inventory) error {
+	if r.tx.outside() {
+		return r.tx.store.Do(func(repos inventory.StockRepositories) error {
+			return repos.Inventories.Update(inv)
+		})
+	}
+
+	s := r.tx.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.inventories[inv.InventoryID].Version != inv.Version {
+		return inventory.ErrConcurrentUpdate
+	}
+	r.tx.inventories[inv.InventoryID] = copyInventory(*inv)
+	inv.Version++
+	return nil
+}
+
+// memoryReservationRepo reads and writes reservations within a unit of work
+type memoryReservationRepo struct {
+	inventory.ReservationRepository // Methods the tests do not need are left unimplemented
+	tx                              *memoryTx
+}
+
+func (r *memoryReservationRepo) FindByOrder(orderID uint) ([]*inventory.Reservation, error) {
+	s := r.tx.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := []*inventory.Reservation{}
+	for id, reservation := range s.reservations {
+		if staged, ok := r.tx.reservations[id]; ok {
+			reservation = staged
+		}
+		if reservation.OrderID == orderID {
+			reservation := reservation
+			found = append(found, &reservation)
+		}
+	}
+	for _, reservation := range r.tx.created {
+		if reservation.OrderID == orderID {
+			reservation := reservation
+			found = append(found, &reservation)
+		}
+	}
+	return found, nil
+}
+
+func (r *memoryReservationRepo) FindActiveByStock(productID, warehouseID uint, variantID *uint) ([]*inventory.Reservation, error) {
+	s := r.tx.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := []*inventory.Reservation{}
+	for _, reservation := range s.reservations {
+		if reservation.IsActive() && reservation.ProductID == productID && reservation.WarehouseID == warehouseID && inventory.SameVariant(reservation.VariantID, variantID) {
+			reservation := reservation
+			found = append(found, &reservation)
+		}
+	}
+	return found, nil
+}
+
+func (r *memoryReservationRepo) Create(reservation *inventory.Reservation) error {
+	if r.tx.store.failReservationWrites {
+		return errors.New("reservation could not be saved")
+	}
+
+	if r.tx.outside() {
+		return r.tx.store.Do(func(repos inventory.StockRepositories) error {
+			return repos.Reservations.Create(reservation)
+		})
+	}
+
+	r.tx.created = append(r.tx.created, *reservation)
+	return nil
+}
+
+// Update stages the reservation, failing at once if it was loaded from a stale copy
+func (r *memoryReservationRepo) Update(reservation *inventory.Reservation) error {
+	s := r.tx.store
+	if s.failReservationWrites {
+		return errors.New("reservation could not be saved")
+	}
+
+	if r.tx.outside() {
+		return s.Do(func(repos inventory.StockRepositories) error {
+			return repos.Reservations.Update(reservation)
+		})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.reservations[reservation.ReservationID].Version != reservation.Version {
+		return inventory.ErrConcurrentUpdate
+	}
+	r.tx.reservations[reservation.ReservationID] = *reservation
+	reservation.Version++
+	return nil
+}
+
+// memoryMovementRepo reads and writes stock movements within a unit of work
+type memoryMovementRepo struct {
+	inventory.StockMovementRepository // Methods the tests do not need are left unimplemented
+	tx                                *memoryTx
+}
+
+func (r *memoryMovementRepo) FindByReference(referenceType string, referenceID uint) ([]*inventory.StockMovement, error) {
+	s := r.tx.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := []*inventory.StockMovement{}
+	for _, m := range append(append([]inventory.StockMovement(nil), s.movements...), r.tx.movements...) {
+		if string(m.ReferenceType) == referenceType && m.ReferenceID == referenceID {
+			m := m
+			found = append(found, &m)
+		}
+	}
+	return found, nil
+}
+
+func (r *memoryMovementRepo) Create(movement *inventory.StockMovement) error {
+	if r.tx.store.failMovementWrites {
+		return errors.New("movement could not be saved")
+	}
+
+	if r.tx.outside() {
+		return r.tx.store.Do(func(repos inventory.StockRepositories) error {
+			return repos.Movements.Create(movement)
+		})
+	}
+
+	r.tx.movements = append(r.tx.movements, *movement)
+	return nil
+}
+
+// memoryWarehouses serves a fixed set of warehouses
+type memoryWarehouses struct {
+	inventory.WarehouseRepository // Methods the tests do not need are left unimplemented
+	warehouses                    map[uint]*inventory.Warehouse
+}
+
+func (r *memoryWarehouses) FindByID(id uint) (*inventory.Warehouse, error) {
+	return r.warehouses[id], nil
+}
+
+// copyInventory copies a record along with its lots, so callers never share them
+func copyInventory(inv inventory.Inventory) inventory.Inventory {
+	inv.Lots = append([]inventory.InventoryLot(nil), inv.Lots...)
+	return inv
+}
+
+// newTestInventoryUseCase wires an InventoryUseCase to store, with the given warehouses
+// active and reservations that lapse after an hour
+func newTestInventoryUseCase(store *memoryStock, warehouseIDs ...uint) *InventoryUseCase {
+	warehouses := &memoryWarehouses{warehouses: map[uint]*inventory.Warehouse{}}
+	for _, warehouseID := range warehouseIDs {
+		warehouses.warehouses[warehouseID] = &inventory.Warehouse{WarehouseID: warehouseID, Status: inventory.WarehouseStatusActive}
+	}
+	inventoryRepo := &memoryInventoryRepo{tx: &memoryTx{store: store}}
+	reservationRepo := &memoryReservationRepo{tx: &memoryTx{store: store}}
+
+	return NewInventoryUseCase(
+		inventoryRepo,
+		&memoryMovementRepo{tx: &memoryTx{store: store}},
+		warehouses,
+		reservationRepo,
+		store,
+		nil,
+		nil,
+		nil,
+		NewAvailabilityUseCase(inventoryRepo, warehouses),
+		time.Hour,
+	)
+}
@@ -0,0 +1,298 @@
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/inventory"
+	"github.com/hydr0g3nz/ecom_mid/domain/user"
+)
+
+// PurchaseOrderUseCase contains the business logic for purchase order operations
+type PurchaseOrderUseCase struct {
+	poRepo               inventory.PurchaseOrderRepository
+	receiptRepo          inventory.GoodsReceiptRepository
+	warehouseRepo        inventory.WarehouseRepository
+	staffRepo            user.StaffRepository
+	inventoryUseCase     *InventoryUseCase
+	serialUseCase        *SerialUseCase
+	locationUseCase      *LocationUseCase
+	backorderUseCase     *BackorderUseCase
+	overReceiptTolerance float64
+	approvalLimit        float64
+}
+
+// NewPurchaseOrderUseCase creates a new PurchaseOrderUseCase.
+// overReceiptTolerance is the fraction of a line's ordered quantity that may be
+// received on top of it (0.05 allows 5% over-delivery). Purchase orders whose
+// total exceeds approvalLimit can only be confirmed by staff holding
+// inventory.PermissionApprovePurchaseOrder.
+func NewPurchaseOrderUseCase(
+	poRepo inventory.PurchaseOrderRepository,
+	receiptRepo inventory.GoodsReceiptRepository,
+	warehouseRepo inventory.WarehouseRepository,
+	staffRepo user.StaffRepository,
+	inventoryUseCase *InventoryUseCase,
+	serialUseCase *SerialUseCase,
+	locationUseCase *LocationUseCase,
+	backorderUseCase *BackorderUseCase,
+	overReceiptTolerance float64,
+	approvalLimit float64,
+) *PurchaseOrderUseCase {
+	return &PurchaseOrderUseCase{
+		poRepo:               poRepo,
+		receiptRepo:          receiptRepo,
+		warehouseRepo:        warehouseRepo,
+		staffRepo:            staffRepo,
+		inventoryUseCase:     inventoryUseCase,
+		serialUseCase:        serialUseCase,
+		locationUseCase:      locationUseCase,
+		backorderUseCase:     backorderUseCase,
+		overReceiptTolerance: overReceiptTolerance,
+		approvalLimit:        approvalLimit,
+	}
+}
+
+// SubmitPurchaseOrder sends a draft purchase order for approval
+func (uc *PurchaseOrderUseCase) SubmitPurchaseOrder(poID uint, staffID uint, comment string) error {
+	_, err := uc.findActiveStaff(staffID)
+	if err != nil {
+		return err
+	}
+
+	po, err := uc.findPurchaseOrder(poID)
+	if err != nil {
+		return err
+	}
+
+	err = po.Submit(staffID, comment)
+	if err != nil {
+		return err
+	}
+
+	return uc.poRepo.Update(po)
+}
+
+// ApprovePurchaseOrder confirms a pending purchase order, checking the approver's
+// permission when the total is above the approval limit
+func (uc *PurchaseOrderUseCase) ApprovePurchaseOrder(poID uint, staffID uint, comment string) error {
+	staff, err := uc.findActiveStaff(staffID)
+	if err != nil {
+		return err
+	}
+
+	po, err := uc.findPurchaseOrder(poID)
+	if err != nil {
+		return err
+	}
+
+	if po.RequiresApproval(uc.approvalLimit) && !staff.HasPermission(inventory.PermissionApprovePurchaseOrder) {
+		return errors.New("staff is not allowed to approve purchase orders above the approval limit")
+	}
+
+	err = po.ConfirmOrder(staffID, comment)
+	if err != nil {
+		return err
+	}
+
+	return uc.poRepo.Update(po)
+}
+
+// RejectPurchaseOrder returns a pending purchase order to draft with a comment
+func (uc *PurchaseOrderUseCase) RejectPurchaseOrder(poID uint, staffID uint, comment string) error {
+	_, err := uc.findActiveStaff(staffID)
+	if err != nil {
+		return err
+	}
+
+	if comment == "" {
+		return errors.New("a comment is required when rejecting a purchase order")
+	}
+
+	po, err := uc.findPurchaseOrder(poID)
+	if err != nil {
+		return err
+	}
+
+	err = po.ReturnToDraft(staffID, comment)
+	if err != nil {
+		return err
+	}
+
+	return uc.poRepo.Update(po)
+}
+
+// CancelPurchaseOrder cancels a purchase order that has not been received
+func (uc *PurchaseOrderUseCase) CancelPurchaseOrder(poID uint, staffID uint, reason string) error {
+	po, err := uc.findPurchaseOrder(poID)
+	if err != nil {
+		return err
+	}
+
+	err = po.CancelOrder(staffID, reason)
+	if err != nil {
+		return err
+	}
+
+	return uc.poRepo.Update(po)
+}
+
+// ReceiveGoods records a delivery against a purchase order and books the stock into a warehouse
+func (uc *PurchaseOrderUseCase) ReceiveGoods(
+	poID uint,
+	warehouseID uint,
+	items []inventory.GoodsReceiptItem,
+	staffID uint,
+	notes string,
+) (*inventory.GoodsReceipt, error) {
+	po, err := uc.findPurchaseOrder(poID)
+	if err != nil {
+		return nil, err
+	}
+
+	warehouse, err := uc.warehouseRepo.FindByID(warehouseID)
+	if err != nil {
+		return nil, err
+	}
+
+	if warehouse == nil || !warehouse.IsActive() {
+		return nil, errors.New("warehouse not found or inactive")
+	}
+
+	err = po.ReceiveItems(items, uc.overReceiptTolerance, staffID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Serialized products must list every unit received
+	err = uc.serialUseCase.CheckReceipt(items)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		if item.LocationID == nil {
+			continue
+		}
+
+		_, err = uc.locationUseCase.CheckBin(*item.LocationID, warehouseID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	receipt := &inventory.GoodsReceipt{
+		POID:         poID,
+		WarehouseID:  warehouseID,
+		ReceivedDate: time.Now(),
+		StaffID:      staffID,
+		Notes:        notes,
+		Items:        items,
+	}
+
+	err = uc.receiptRepo.Create(receipt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Book each line into stock against the purchase order, by lot where one was captured
+	for _, item := range receipt.Items {
+		unitCost := item.UnitCost
+		notes := fmt.Sprintf("Goods receipt #%d", receipt.ReceiptID)
+		if item.LotNumber != "" {
+			lot := inventory.LotQuantity{LotNumber: item.LotNumber, ExpiryDate: item.ExpiryDate, Quantity: item.Quantity}
+			err = uc.inventoryUseCase.AddLotStock(item.ProductID, warehouseID, item.VariantID, lot, &unitCost, inventory.ReferenceTypePurchaseOrder, poID, staffID, notes)
+		} else {
+			err = uc.inventoryUseCase.AddStock(item.ProductID, warehouseID, item.VariantID, item.Quantity, &unitCost, inventory.ReferenceTypePurchaseOrder, poID, staffID, notes)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if item.LocationID != nil {
+			err = uc.locationUseCase.PutAway(item.ProductID, item.VariantID, warehouseID, *item.LocationID, item.Quantity, inventory.ReferenceTypePurchaseOrder, poID, staffID)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	err = uc.serialUseCase.RegisterReceipt(receipt, staffID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = uc.poRepo.Update(po)
+	if err != nil {
+		return nil, err
+	}
+
+	// Hand the new stock to customers waiting on backorder, oldest first
+	for _, item := range receipt.Items {
+		err = uc.backorderUseCase.AllocateBackorders(item.ProductID, item.VariantID, warehouseID, staffID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return receipt, nil
+}
+
+// ClosePurchaseOrder marks a purchase order as fully received, accepting any short-shipped lines
+func (uc *PurchaseOrderUseCase) ClosePurchaseOrder(poID uint, staffID uint, comment string) error {
+	po, err := uc.findPurchaseOrder(poID)
+	if err != nil {
+		return err
+	}
+
+	err = po.ReceiveOrder(staffID, comment)
+	if err != nil {
+		return err
+	}
+
+	return uc.poRepo.Update(po)
+}
+
+// GetReceipts gets the goods receipts recorded against a purchase order
+func (uc *PurchaseOrderUseCase) GetReceipts(poID uint) ([]*inventory.GoodsReceipt, error) {
+	return uc.receiptRepo.FindByPurchaseOrder(poID)
+}
+
+// GetStatusHistory gets the status history of a purchase order
+func (uc *PurchaseOrderUseCase) GetStatusHistory(poID uint) ([]*inventory.PurchaseOrderStatusHistory, error) {
+	return uc.poRepo.FindStatusHistory(poID)
+}
+
+// GetPurchaseOrderByID gets a purchase order by ID
+func (uc *PurchaseOrderUseCase) GetPurchaseOrderByID(poID uint) (*inventory.PurchaseOrder, error) {
+	return uc.poRepo.FindByID(poID)
+}
+
+// findPurchaseOrder loads an existing purchase order
+func (uc *PurchaseOrderUseCase) findPurchaseOrder(poID uint) (*inventory.PurchaseOrder, error) {
+	po, err := uc.poRepo.FindByID(poID)
+	if err != nil {
+		return nil, err
+	}
+
+	if po == nil {
+		return nil, errors.New("purchase order not found")
+	}
+
+	return po, nil
+}
+
+// findActiveStaff loads a staff member who is allowed to act
+func (uc *PurchaseOrderUseCase) findActiveStaff(staffID uint) (*user.Staff, error) {
+	staff, err := uc.staffRepo.FindByID(staffID)
+	if err != nil {
+		return nil, err
+	}
+
+	if staff == nil || !staff.IsActive() {
+		return nil, errors.New("staff not found or inactive")
+	}
+
+	return staff, nil
+}
@@ -0,0 +1,189 @@
+package inventory
+
+import (
+	"time"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/inventory"
+)
+
+// LedgerLevel is an on-hand quantity rebuilt from the stock movement ledger
+type LedgerLevel struct {
+	ProductID   uint  `json:"product_id"`
+	VariantID   *uint `json:"variant_id,omitempty"`
+	WarehouseID uint  `json:"warehouse_id"`
+	Quantity    int   `json:"quantity"`
+}
+
+// StockDiscrepancy is a difference between the ledger and an inventory record
+type StockDiscrepancy struct {
+	ProductID         uint  `json:"product_id"`
+	VariantID         *uint `json:"variant_id,omitempty"`
+	WarehouseID       uint  `json:"warehouse_id"`
+	LedgerQuantity    int   `json:"ledger_quantity"`
+	InventoryQuantity int   `json:"inventory_quantity"`
+	Difference        int   `json:"difference"` // Inventory minus ledger
+	Corrected         bool  `json:"corrected"`
+}
+
+// ReconciliationUseCase contains the business logic for checking the stock ledger against inventory
+type ReconciliationUseCase struct {
+	inventoryRepo    inventory.InventoryRepository
+	movementRepo     inventory.StockMovementRepository
+	warehouseRepo    inventory.WarehouseRepository
+	inventoryUseCase *InventoryUseCase
+}
+
+// NewReconciliationUseCase creates a new ReconciliationUseCase
+func NewReconciliationUseCase(
+	inventoryRepo inventory.InventoryRepository,
+	movementRepo inventory.StockMovementRepository,
+	warehouseRepo inventory.WarehouseRepository,
+	inventoryUseCase *InventoryUseCase,
+) *ReconciliationUseCase {
+	return &ReconciliationUseCase{
+		inventoryRepo:    inventoryRepo,
+		movementRepo:     movementRepo,
+		warehouseRepo:    warehouseRepo,
+		inventoryUseCase: inventoryUseCase,
+	}
+}
+
+// Reconcile replays the ledger for every warehouse and reports where it disagrees with
+// Inventory.Quantity. With postCorrections set, each discrepancy is posted as a stock
+// adjustment so the ledger agrees with the inventory record; the quantity on hand is left
+// as is since it is what cycle counts reconcile against the shelf.
+func (uc *ReconciliationUseCase) Reconcile(postCorrections bool, staffID uint) ([]StockDiscrepancy, error) {
+	warehouses, err := uc.warehouseRepo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+
+	discrepancies := []StockDiscrepancy{}
+	for _, warehouse := range warehouses {
+		found, err := uc.reconcileWarehouse(warehouse.WarehouseID, postCorrections, staffID)
+		if err != nil {
+			return nil, err
+		}
+		discrepancies = append(discrepancies, found...)
+	}
+
+	return discrepancies, nil
+}
+
+// GetStockLevelsAsOf rebuilds a warehouse's on-hand quantities at a past point in time from the ledger
+func (uc *ReconciliationUseCase) GetStockLevelsAsOf(warehouseID uint, asOf time.Time) ([]LedgerLevel, error) {
+	levels, keys, err := uc.replay(warehouseID, &asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []LedgerLevel{}
+	for _, key := range keys {
+		if levels[key].Quantity != 0 {
+			result = append(result, *levels[key])
+		}
+	}
+
+	return result, nil
+}
+
+// reconcileWarehouse compares one warehouse's ledger with its inventory records
+func (uc *ReconciliationUseCase) reconcileWarehouse(warehouseID uint, postCorrections bool, staffID uint) ([]StockDiscrepancy, error) {
+	ledger, keys, err := uc.replay(warehouseID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := uc.inventoryRepo.FindByWarehouse(warehouseID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Records with no ledger entries at all still have to be compared against zero
+	onHand := map[stockKey]int{}
+	for _, inv := range records {
+		key := stockKey{productID: inv.ProductID, variantID: variantValue(inv.VariantID)}
+		onHand[key] = inv.Quantity
+		if _, ok := ledger[key]; !ok {
+			ledger[key] = &LedgerLevel{ProductID: inv.ProductID, VariantID: inv.VariantID, WarehouseID: warehouseID}
+			keys = append(keys, key)
+		}
+	}
+
+	discrepancies := []StockDiscrepancy{}
+	for _, key := range keys {
+		level := ledger[key]
+		difference := onHand[key] - level.Quantity
+		if difference == 0 {
+			continue
+		}
+
+		discrepancy := StockDiscrepancy{
+			ProductID:         level.ProductID,
+			VariantID:         level.VariantID,
+			WarehouseID:       warehouseID,
+			LedgerQuantity:    level.Quantity,
+			InventoryQuantity: onHand[key],
+			Difference:        difference,
+		}
+
+		if postCorrections {
+			err = uc.postCorrection(discrepancy, staffID)
+			if err != nil {
+				return nil, err
+			}
+			discrepancy.Corrected = true
+		}
+
+		discrepancies = append(discrepancies, discrepancy)
+	}
+
+	return discrepancies, nil
+}
+
+// replay sums a warehouse's on-hand movements per product and variant, up to asOf when given.
+// The keys are returned in the order they were first seen so reports are stable.
+func (uc *ReconciliationUseCase) replay(warehouseID uint, asOf *time.Time) (map[stockKey]*LedgerLevel, []stockKey, error) {
+	const pageSize = 100
+
+	levels := map[stockKey]*LedgerLevel{}
+	keys := []stockKey{}
+	for page := 1; ; page++ {
+		movements, err := uc.movementRepo.FindByWarehouse(warehouseID, page, pageSize)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, m := range movements {
+			if !m.AffectsOnHand() || (asOf != nil && m.CreatedAt.After(*asOf)) {
+				continue
+			}
+
+			key := stockKey{productID: m.ProductID, variantID: variantValue(m.VariantID)}
+			level, ok := levels[key]
+			if !ok {
+				level = &LedgerLevel{ProductID: m.ProductID, VariantID: m.VariantID, WarehouseID: warehouseID}
+				levels[key] = level
+				keys = append(keys, key)
+			}
+			level.Quantity += m.OnHandDelta()
+		}
+
+		if len(movements) < pageSize {
+			return levels, keys, nil
+		}
+	}
+}
+
+// postCorrection posts the change missing from the ledger for a discrepancy as a costed
+// movement, leaving the quantity on hand as it is
+func (uc *ReconciliationUseCase) postCorrection(discrepancy StockDiscrepancy, staffID uint) error {
+	return uc.inventoryUseCase.PostUnrecordedChange(
+		discrepancy.ProductID,
+		discrepancy.WarehouseID,
+		discrepancy.VariantID,
+		discrepancy.Difference,
+		staffID,
+		"Ledger reconciliation",
+	)
+}
@@ -0,0 +1,290 @@
+package inventory
+
+import (
+	"errors"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common/vo"
+	"github.com/hydr0g3nz/ecom_mid/domain/inventory"
+	"github.com/hydr0g3nz/ecom_mid/domain/product"
+)
+
+// openPOStatuses are the purchase order statuses whose quantities are still on their way
+var openPOStatuses = []inventory.PurchaseOrderStatus{
+	inventory.POStatusDraft,
+	inventory.POStatusPending,
+	inventory.POStatusConfirmed,
+	inventory.POStatusPartiallyReceived,
+}
+
+// replenishmentLine is a quantity to order from one supplier
+type replenishmentLine struct {
+	supplierID uint
+	productID  uint
+	variantID  *uint
+	quantity   int
+}
+
+// ReplenishmentUseCase contains the business logic for reorder rules and automatic purchasing
+type ReplenishmentUseCase struct {
+	ruleRepo      inventory.ReorderRuleRepository
+	inventoryRepo inventory.InventoryRepository
+	poRepo        inventory.PurchaseOrderRepository
+	supplierRepo  inventory.SupplierRepository
+	productRepo   product.ProductRepository
+}
+
+// NewReplenishmentUseCase creates a new ReplenishmentUseCase
+func NewReplenishmentUseCase(
+	ruleRepo inventory.ReorderRuleRepository,
+	inventoryRepo inventory.InventoryRepository,
+	poRepo inventory.PurchaseOrderRepository,
+	supplierRepo inventory.SupplierRepository,
+	productRepo product.ProductRepository,
+) *ReplenishmentUseCase {
+	return &ReplenishmentUseCase{
+		ruleRepo:      ruleRepo,
+		inventoryRepo: inventoryRepo,
+		poRepo:        poRepo,
+		supplierRepo:  supplierRepo,
+		productRepo:   productRepo,
+	}
+}
+
+// SetReorderRule creates or updates the reorder rule for a product in a warehouse
+func (uc *ReplenishmentUseCase) SetReorderRule(
+	productID uint,
+	variantID *uint,
+	warehouseID uint,
+	reorderPoint int,
+	reorderQuantity int,
+	safetyStock int,
+	preferredSupplierID *uint,
+) (*inventory.ReorderRule, error) {
+	if preferredSupplierID != nil {
+		supplier, err := uc.supplierRepo.FindByID(*preferredSupplierID)
+		if err != nil {
+			return nil, err
+		}
+
+		if supplier == nil || !supplier.IsActive() {
+			return nil, errors.New("supplier not found or inactive")
+		}
+	}
+
+	rule, err := uc.ruleRepo.FindByProductAndWarehouse(productID, warehouseID, variantID)
+	if err != nil {
+		return nil, err
+	}
+
+	if rule == nil {
+		rule, err = inventory.NewReorderRule(productID, variantID, warehouseID, reorderPoint, reorderQuantity, safetyStock, preferredSupplierID)
+		if err != nil {
+			return nil, err
+		}
+
+		err = uc.ruleRepo.Create(rule)
+		if err != nil {
+			return nil, err
+		}
+
+		return rule, nil
+	}
+
+	err = rule.UpdateLevels(reorderPoint, reorderQuantity, safetyStock)
+	if err != nil {
+		return nil, err
+	}
+	rule.PreferredSupplierID = preferredSupplierID
+
+	err = uc.ruleRepo.Update(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+// RunReplenishment finds items below their reorder point and raises one draft
+// purchase order per preferred supplier. Quantities already on open purchase
+// orders are counted as incoming so repeated runs do not double-order.
+func (uc *ReplenishmentUseCase) RunReplenishment(staffID uint) ([]*inventory.PurchaseOrder, error) {
+	rules, err := uc.ruleRepo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+
+	incoming, err := uc.findIncoming()
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []*replenishmentLine{}
+	for _, rule := range rules {
+		// Items without a preferred supplier must be purchased manually
+		if rule.PreferredSupplierID == nil {
+			continue
+		}
+
+		inv, err := uc.inventoryRepo.FindByProductAndWarehouse(rule.ProductID, rule.WarehouseID, rule.VariantID)
+		if err != nil {
+			return nil, err
+		}
+
+		position := 0
+		if inv != nil {
+			position = inv.GetSellableQuantity()
+		}
+
+		quantity := rule.OrderQuantity(position)
+		if quantity == 0 {
+			continue
+		}
+
+		lines = addReplenishmentLine(lines, *rule.PreferredSupplierID, rule.ProductID, rule.VariantID, quantity)
+	}
+
+	// Net off what is already on order, then group what remains by supplier
+	bySupplier := map[uint][]*replenishmentLine{}
+	supplierOrder := []uint{}
+	for _, line := range lines {
+		key := stockKey{productID: line.productID, variantID: variantValue(line.variantID)}
+		covered := incoming[key]
+		if covered >= line.quantity {
+			incoming[key] = covered - line.quantity
+			continue
+		}
+
+		line.quantity -= covered
+		incoming[key] = 0
+
+		if _, ok := bySupplier[line.supplierID]; !ok {
+			supplierOrder = append(supplierOrder, line.supplierID)
+		}
+		bySupplier[line.supplierID] = append(bySupplier[line.supplierID], line)
+	}
+
+	orders := []*inventory.PurchaseOrder{}
+	for _, supplierID := range supplierOrder {
+		po, err := inventory.NewPurchaseOrder(supplierID, staffID, nil, "Generated by replenishment")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, line := range bySupplier[supplierID] {
+			unitCost, err := lastUnitCost(uc.poRepo, uc.productRepo, line.productID, line.variantID)
+			if err != nil {
+				return nil, err
+			}
+
+			totalCost, err := unitCost.Multiply(float64(line.quantity))
+			if err != nil {
+				return nil, err
+			}
+
+			err = po.AddItem(inventory.PurchaseOrderItem{
+				ProductID: line.productID,
+				VariantID: line.variantID,
+				Quantity:  line.quantity,
+				UnitCost:  unitCost,
+				TotalCost: totalCost,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		err = uc.poRepo.Create(po)
+		if err != nil {
+			return nil, err
+		}
+
+		orders = append(orders, po)
+	}
+
+	return orders, nil
+}
+
+// findIncoming sums the quantities on open purchase orders per product and variant
+func (uc *ReplenishmentUseCase) findIncoming() (map[stockKey]int, error) {
+	incoming := map[stockKey]int{}
+	for _, status := range openPOStatuses {
+		orders, err := findStockPurchaseOrders(uc.poRepo, status)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, po := range orders {
+			for _, item := range po.Items {
+				key := stockKey{productID: item.ProductID, variantID: variantValue(item.VariantID)}
+				incoming[key] += item.RemainingQuantity()
+			}
+		}
+	}
+
+	return incoming, nil
+}
+
+// lastUnitCost returns the unit cost from the most recent purchase of an item,
+// falling back to the product's standard cost
+func lastUnitCost(poRepo inventory.PurchaseOrderRepository, productRepo product.ProductRepository, productID uint, variantID *uint) (vo.Money, error) {
+	item, err := poRepo.FindLatestItem(productID, variantID)
+	if err != nil {
+		return vo.Money{}, err
+	}
+
+	if item != nil {
+		return item.UnitCost, nil
+	}
+
+	prod, err := productRepo.FindByID(productID)
+	if err != nil {
+		return vo.Money{}, err
+	}
+
+	if prod != nil && prod.Cost != nil {
+		return *prod.Cost, nil
+	}
+
+	return vo.NewMoney(0, "THB")
+}
+
+// addReplenishmentLine merges a quantity into the line for the same supplier and item
+func addReplenishmentLine(lines []*replenishmentLine, supplierID, productID uint, variantID *uint, quantity int) []*replenishmentLine {
+	for _, line := range lines {
+		if line.supplierID == supplierID && line.productID == productID && inventory.SameVariant(line.variantID, variantID) {
+			line.quantity += quantity
+			return lines
+		}
+	}
+
+	return append(lines, &replenishmentLine{
+		supplierID: supplierID,
+		productID:  productID,
+		variantID:  variantID,
+		quantity:   quantity,
+	})
+}
+
+// findStockPurchaseOrders loads every purchase order in a status that restocks our warehouses, page by page.
+// Dropship orders are left out as their goods go straight to customers.
+func findStockPurchaseOrders(poRepo inventory.PurchaseOrderRepository, status inventory.PurchaseOrderStatus) ([]*inventory.PurchaseOrder, error) {
+	const pageSize = 100
+
+	orders := []*inventory.PurchaseOrder{}
+	for page := 1; ; page++ {
+		batch, err := poRepo.FindByStatus(status, page, pageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, po := range batch {
+			if !po.IsDropship() {
+				orders = append(orders, po)
+			}
+		}
+
+		if len(batch) < pageSize {
+			return orders, nil
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package inventory
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/inventory"
+	"github.com/hydr0g3nz/ecom_mid/domain/product"
+)
+
+// SerialUseCase contains the business logic for tracking serialized units
+type SerialUseCase struct {
+	serialRepo  inventory.SerialNumberRepository
+	productRepo product.ProductRepository
+}
+
+// NewSerialUseCase creates a new SerialUseCase
+func NewSerialUseCase(serialRepo inventory.SerialNumberRepository, productRepo product.ProductRepository) *SerialUseCase {
+	return &SerialUseCase{
+		serialRepo:  serialRepo,
+		productRepo: productRepo,
+	}
+}
+
+// RequiresSerials checks if a product is tracked by serial number
+func (uc *SerialUseCase) RequiresSerials(productID uint) (bool, error) {
+	prod, err := uc.productRepo.FindByID(productID)
+	if err != nil {
+		return false, err
+	}
+
+	if prod == nil {
+		return false, errors.New("product not found")
+	}
+
+	return prod.IsSerialized, nil
+}
+
+// CheckReceipt verifies that every serialized line in a goods receipt lists one new serial number per unit
+func (uc *SerialUseCase) CheckReceipt(items []inventory.GoodsReceiptItem) error {
+	seen := map[string]bool{}
+	for _, item := range items {
+		serialized, err := uc.RequiresSerials(item.ProductID)
+		if err != nil {
+			return err
+		}
+
+		if !serialized {
+			if len(item.SerialNumbers) > 0 {
+				return errors.New("serial numbers given for a product that is not serialized")
+			}
+			continue
+		}
+
+		if len(item.SerialNumbers) != item.Quantity {
+			return fmt.Errorf("expected %d serial numbers for product %d, got %d", item.Quantity, item.ProductID, len(item.SerialNumbers))
+		}
+
+		for _, serialNumber := range item.SerialNumbers {
+			if seen[serialNumber] {
+				return fmt.Errorf("serial number %s is listed more than once", serialNumber)
+			}
+			seen[serialNumber] = true
+
+			existing, err := uc.serialRepo.FindBySerialNumber(serialNumber)
+			if err != nil {
+				return err
+			}
+
+			if existing != nil {
+				return fmt.Errorf("serial number %s has already been received", serialNumber)
+			}
+		}
+	}
+
+	return nil
+}
+
+// RegisterReceipt records the serial numbers received on a goods receipt
+func (uc *SerialUseCase) RegisterReceipt(receipt *inventory.GoodsReceipt, staffID uint) error {
+	for _, item := range receipt.Items {
+		for _, serialNumber := range item.SerialNumbers {
+			serial, err := inventory.NewSerialNumber(serialNumber, item.ProductID, item.VariantID, receipt.WarehouseID, receipt.POID, staffID)
+			if err != nil {
+				return err
+			}
+
+			err = uc.serialRepo.Create(serial)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// CheckShipment verifies the serial numbers given for units leaving a warehouse, on an order
+// line or a transfer, are in stock there and returns the matching units
+func (uc *SerialUseCase) CheckShipment(
+	productID uint,
+	variantID *uint,
+	warehouseID uint,
+	quantity int,
+	serialNumbers []string,
+) ([]*inventory.SerialNumber, error) {
+	if len(serialNumbers) != quantity {
+		return nil, fmt.Errorf("expected %d serial numbers for product %d, got %d", quantity, productID, len(serialNumbers))
+	}
+
+	units := []*inventory.SerialNumber{}
+	seen := map[string]bool{}
+	for _, serialNumber := range serialNumbers {
+		if seen[serialNumber] {
+			return nil, fmt.Errorf("serial number %s is listed more than once", serialNumber)
+		}
+		seen[serialNumber] = true
+
+		serial, err := uc.serialRepo.FindBySerialNumber(serialNumber)
+		if err != nil {
+			return nil, err
+		}
+
+		if serial == nil || serial.ProductID != productID || !inventory.SameVariant(serial.VariantID, variantID) {
+			return nil, fmt.Errorf("serial number %s does not belong to this item", serialNumber)
+		}
+
+		if !serial.IsInStock(warehouseID) {
+			return nil, fmt.Errorf("serial number %s is not in stock in the shipping warehouse", serialNumber)
+		}
+
+		units = append(units, serial)
+	}
+
+	return units, nil
+}
+
+// CheckDispatch verifies the serial numbers given for units sent on a transfer like CheckShipment
+// and returns the units still to be dispatched, leaving out those a retried dispatch already sent
+func (uc *SerialUseCase) CheckDispatch(
+	productID uint,
+	variantID *uint,
+	warehouseID uint,
+	transferID uint,
+	quantity int,
+	serialNumbers []string,
+) ([]*inventory.SerialNumber, error) {
+	if len(serialNumbers) != quantity {
+		return nil, fmt.Errorf("expected %d serial numbers for product %d, got %d", quantity, productID, len(serialNumbers))
+	}
+
+	pending := []string{}
+	for _, serialNumber := range serialNumbers {
+		serial, err := uc.serialRepo.FindBySerialNumber(serialNumber)
+		if err != nil {
+			return nil, err
+		}
+
+		if serial != nil && serial.ProductID == productID && inventory.SameVariant(serial.VariantID, variantID) && serial.IsDispatchedOn(transferID) {
+			continue
+		}
+		pending = append(pending, serialNumber)
+	}
+
+	return uc.CheckShipment(productID, variantID, warehouseID, len(pending), pending)
+}
+
+// ShipUnits records units checked by CheckShipment as shipped on an order
+func (uc *SerialUseCase) ShipUnits(units []*inventory.SerialNumber, orderID, orderItemID, shipmentID, staffID uint) error {
+	for _, serial := range units {
+		err := serial.Ship(orderID, orderItemID, shipmentID, staffID)
+		if err != nil {
+			return err
+		}
+
+		err = uc.serialRepo.Update(serial)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UnshipUnits puts units back in stock in warehouseID after ShipUnits, when the shipment
+// they were on could not be completed
+func (uc *SerialUseCase) UnshipUnits(units []*inventory.SerialNumber, warehouseID uint) error {
+	for _, serial := range units {
+		// Units ShipUnits did not reach are still in stock
+		if serial.Status != inventory.SerialStatusShipped {
+			continue
+		}
+
+		err := serial.Unship(warehouseID)
+		if err != nil {
+			return err
+		}
+
+		err = uc.serialRepo.Update(serial)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DispatchUnits records units checked by CheckDispatch as leaving warehouseID on a transfer
+func (uc *SerialUseCase) DispatchUnits(units []*inventory.SerialNumber, warehouseID, transferID, staffID uint) error {
+	for _, serial := range units {
+		err := serial.Dispatch(warehouseID, transferID, staffID)
+		if err != nil {
+			return err
+		}
+
+		err = uc.serialRepo.Update(serial)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReceiveUnits records units dispatched on a transfer arriving at warehouseID
+func (uc *SerialUseCase) ReceiveUnits(serialNumbers []string, warehouseID, transferID, staffID uint) error {
+	for _, serialNumber := range serialNumbers {
+		serial, err := uc.GetSerialHistory(serialNumber)
+		if err != nil {
+			return err
+		}
+
+		// A retried receipt skips the units it already moved
+		if serial.IsInStock(warehouseID) {
+			continue
+		}
+
+		err = serial.ReceiveTransfer(warehouseID, transferID, staffID)
+		if err != nil {
+			return err
+		}
+
+		err = uc.serialRepo.Update(serial)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CheckReturn verifies the serial numbers given for returned units were shipped on the
+// order item they are returned against, or already came back on this return
+func (uc *SerialUseCase) CheckReturn(orderID, orderItemID, returnID uint, serialNumbers []string) error {
+	seen := map[string]bool{}
+	for _, serialNumber := range serialNumbers {
+		if seen[serialNumber] {
+			return fmt.Errorf("serial number %s is listed more than once", serialNumber)
+		}
+		seen[serialNumber] = true
+
+		serial, err := uc.serialRepo.FindBySerialNumber(serialNumber)
+		if err != nil {
+			return err
+		}
+
+		if serial == nil || !serial.IsShippedOn(orderID, orderItemID) && !serial.IsReturnedOn(returnID) {
+			return fmt.Errorf("serial number %s was not shipped on the returned item", serialNumber)
+		}
+	}
+
+	return nil
+}
+
+// ReturnUnit records a unit shipped on an order item coming back into a warehouse.
+// A unit already recorded as back on this return is left as it is.
+func (uc *SerialUseCase) ReturnUnit(serialNumber string, orderID, orderItemID, warehouseID, returnID, staffID uint) error {
+	serial, err := uc.GetSerialHistory(serialNumber)
+	if err != nil {
+		return err
+	}
+
+	if serial.IsReturnedOn(returnID) {
+		return nil
+	}
+
+	err = serial.Return(orderID, orderItemID, warehouseID, returnID, staffID)
+	if err != nil {
+		return err
+	}
+
+	return uc.serialRepo.Update(serial)
+}
+
+// QuarantineUnit records a unit shipped on an order item coming back into a warehouse unfit for sale.
+// A unit already recorded as back on this return is left as it is.
+func (uc *SerialUseCase) QuarantineUnit(serialNumber string, orderID, orderItemID, warehouseID, returnID, staffID uint) error {
+	serial, err := uc.GetSerialHistory(serialNumber)
+	if err != nil {
+		return err
+	}
+
+	if serial.IsReturnedOn(returnID) {
+		return nil
+	}
+
+	err = serial.Quarantine(orderID, orderItemID, warehouseID, returnID, staffID)
+	if err != nil {
+		return err
+	}
+
+	return uc.serialRepo.Update(serial)
+}
+
+// GetSerialHistory gets a unit with its history from receipt through shipment and return
+func (uc *SerialUseCase) GetSerialHistory(serialNumber string) (*inventory.SerialNumber, error) {
+	serial, err := uc.serialRepo.FindBySerialNumber(serialNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	if serial == nil {
+		return nil, errors.New("serial number not found")
+	}
+
+	return serial, nil
+}
+
+// GetOrderSerials gets the units shipped on an order
+func (uc *SerialUseCase) GetOrderSerials(orderID uint) ([]*inventory.SerialNumber, error) {
+	return uc.serialRepo.FindByOrder(orderID)
+}
@@ -0,0 +1,397 @@
+package inventory
+
+import (
+	"errors"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common/vo"
+	"github.com/hydr0g3nz/ecom_mid/domain/inventory"
+)
+
+// StockLevel summarises the stock of one product in one warehouse
+type StockLevel struct {
+	ProductID   uint  `json:"product_id"`
+	VariantID   *uint `json:"variant_id,omitempty"`
+	WarehouseID uint  `json:"warehouse_id"`
+	OnHand      int   `json:"on_hand"`
+	Reserved    int   `json:"reserved"`
+	Available   int   `json:"available"`
+	InTransit   int   `json:"in_transit"`
+}
+
+// TransferUseCase contains the business logic for warehouse-to-warehouse transfers
+type TransferUseCase struct {
+	transferRepo     inventory.StockTransferRepository
+	warehouseRepo    inventory.WarehouseRepository
+	inventoryRepo    inventory.InventoryRepository
+	inventoryUseCase *InventoryUseCase
+	serialUseCase    *SerialUseCase
+}
+
+// NewTransferUseCase creates a new TransferUseCase
+func NewTransferUseCase(
+	transferRepo inventory.StockTransferRepository,
+	warehouseRepo inventory.WarehouseRepository,
+	inventoryRepo inventory.InventoryRepository,
+	inventoryUseCase *InventoryUseCase,
+	serialUseCase *SerialUseCase,
+) *TransferUseCase {
+	return &TransferUseCase{
+		transferRepo:     transferRepo,
+		warehouseRepo:    warehouseRepo,
+		inventoryRepo:    inventoryRepo,
+		inventoryUseCase: inventoryUseCase,
+		serialUseCase:    serialUseCase,
+	}
+}
+
+// CreateTransfer creates a new draft transfer between two warehouses
+func (uc *TransferUseCase) CreateTransfer(
+	sourceWarehouseID uint,
+	destinationWarehouseID uint,
+	staffID uint,
+	notes string,
+) (*inventory.StockTransfer, error) {
+	// Verify both warehouses exist and are active
+	for _, warehouseID := range []uint{sourceWarehouseID, destinationWarehouseID} {
+		warehouse, err := uc.warehouseRepo.FindByID(warehouseID)
+		if err != nil {
+			return nil, err
+		}
+
+		if warehouse == nil || !warehouse.IsActive() {
+			return nil, errors.New("warehouse not found or inactive")
+		}
+	}
+
+	transfer, err := inventory.NewStockTransfer(sourceWarehouseID, destinationWarehouseID, staffID, notes)
+	if err != nil {
+		return nil, err
+	}
+
+	err = uc.transferRepo.Create(transfer)
+	if err != nil {
+		return nil, err
+	}
+
+	return transfer, nil
+}
+
+// AddItemToTransfer adds a product to a draft transfer
+func (uc *TransferUseCase) AddItemToTransfer(transferID, productID uint, variantID *uint, quantity int) error {
+	transfer, err := uc.findTransfer(transferID)
+	if err != nil {
+		return err
+	}
+
+	err = transfer.AddItem(inventory.StockTransferItem{
+		ProductID: productID,
+		VariantID: variantID,
+		Quantity:  quantity,
+	})
+	if err != nil {
+		return err
+	}
+
+	return uc.transferRepo.Update(transfer)
+}
+
+// DispatchTransfer takes the transfer's stock out of the source warehouse.
+// serialNumbers lists, by transfer item ID, the exact units sent for serialized products.
+// Each item's stock leaves with its movements, so a dispatch that fails partway can be
+// retried: items the movements show as already sent are not taken out again.
+func (uc *TransferUseCase) DispatchTransfer(transferID uint, staffID uint, serialNumbers map[uint][]string) error {
+	transfer, err := uc.findTransfer(transferID)
+	if err != nil {
+		return err
+	}
+
+	err = transfer.Dispatch()
+	if err != nil {
+		return err
+	}
+
+	dispatched := map[uint]bool{}
+	for _, item := range transfer.Items {
+		moved, _, err := uc.inventoryUseCase.movedStock(item.ProductID, transfer.SourceWarehouseID, item.VariantID, inventory.MovementTypeOut, inventory.ReferenceTypeTransfer, transfer.TransferID)
+		if err != nil {
+			return err
+		}
+
+		if moved > 0 && moved != item.Quantity {
+			return errors.New("transfer item was only partly dispatched")
+		}
+		dispatched[item.TransferItemID] = moved > 0
+	}
+
+	// Check every line before touching stock so a short line does not leave a half-dispatched transfer
+	for _, item := range transfer.Items {
+		if dispatched[item.TransferItemID] {
+			continue
+		}
+
+		inv, err := uc.inventoryRepo.FindByProductAndWarehouse(item.ProductID, transfer.SourceWarehouseID, item.VariantID)
+		if err != nil {
+			return err
+		}
+
+		if inv == nil || inv.GetAvailableQuantity() < item.Quantity {
+			return errors.New("insufficient available stock in source warehouse")
+		}
+	}
+
+	// Serialized units travel with their stock, so each one sent must be named
+	units := map[uint][]*inventory.SerialNumber{}
+	for _, item := range transfer.Items {
+		serialized, err := uc.serialUseCase.RequiresSerials(item.ProductID)
+		if err != nil {
+			return err
+		}
+
+		serials := serialNumbers[item.TransferItemID]
+		if !serialized {
+			if len(serials) > 0 {
+				return errors.New("serial numbers given for an item that is not serialized")
+			}
+			continue
+		}
+
+		itemUnits, err := uc.serialUseCase.CheckDispatch(item.ProductID, item.VariantID, transfer.SourceWarehouseID, transfer.TransferID, item.Quantity, serials)
+		if err != nil {
+			return err
+		}
+		units[item.TransferItemID] = itemUnits
+	}
+
+	for i, item := range transfer.Items {
+		if !dispatched[item.TransferItemID] {
+			_, _, err = uc.inventoryUseCase.removeStock(
+				item.ProductID,
+				transfer.SourceWarehouseID,
+				item.VariantID,
+				item.Quantity,
+				inventory.ReferenceTypeTransfer,
+				transfer.TransferID,
+				staffID,
+				"Transfer dispatched",
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		// The stock keeps its cost and lots when it lands in the destination warehouse
+		err = uc.recordDispatch(transfer, i)
+		if err != nil {
+			return err
+		}
+
+		itemUnits, ok := units[item.TransferItemID]
+		if !ok {
+			continue
+		}
+
+		err = uc.serialUseCase.DispatchUnits(itemUnits, transfer.SourceWarehouseID, transfer.TransferID, staffID)
+		if err != nil {
+			return err
+		}
+		transfer.Items[i].SerialNumbers = serialNumbers[item.TransferItemID]
+	}
+
+	return uc.transferRepo.Update(transfer)
+}
+
+// ReceiveTransfer puts the transfer's stock into the destination warehouse. Like a dispatch,
+// a receipt that fails partway can be retried without receiving any lot twice.
+func (uc *TransferUseCase) ReceiveTransfer(transferID uint, staffID uint) error {
+	transfer, err := uc.findTransfer(transferID)
+	if err != nil {
+		return err
+	}
+
+	err = transfer.Receive()
+	if err != nil {
+		return err
+	}
+
+	for _, item := range transfer.Items {
+		// Serialized units are on hand in the destination from now on
+		err = uc.serialUseCase.ReceiveUnits(item.SerialNumbers, transfer.DestinationWarehouseID, transfer.TransferID, staffID)
+		if err != nil {
+			return err
+		}
+
+		received, receivedLots, err := uc.inventoryUseCase.movedStock(item.ProductID, transfer.DestinationWarehouseID, item.VariantID, inventory.MovementTypeIn, inventory.ReferenceTypeTransfer, transfer.TransferID)
+		if err != nil {
+			return err
+		}
+
+		// Lots keep their numbers and expiry dates in the destination warehouse
+		untracked := item.Quantity
+		for _, lot := range item.Lots {
+			untracked -= lot.Quantity
+			received -= lot.Quantity
+			if lotQuantity(receivedLots, lot.LotNumber) >= lot.Quantity {
+				continue
+			}
+
+			err = uc.inventoryUseCase.AddLotStock(
+				item.ProductID,
+				transfer.DestinationWarehouseID,
+				item.VariantID,
+				lot,
+				item.UnitCost,
+				inventory.ReferenceTypeTransfer,
+				transfer.TransferID,
+				staffID,
+				"Transfer received",
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		// What was received beyond the lots is the stock held outside them
+		if untracked == 0 || received >= untracked {
+			continue
+		}
+
+		err = uc.inventoryUseCase.AddStock(
+			item.ProductID,
+			transfer.DestinationWarehouseID,
+			item.VariantID,
+			untracked,
+			item.UnitCost,
+			inventory.ReferenceTypeTransfer,
+			transfer.TransferID,
+			staffID,
+			"Transfer received",
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return uc.transferRepo.Update(transfer)
+}
+
+// CancelTransfer cancels a draft transfer
+func (uc *TransferUseCase) CancelTransfer(transferID uint) error {
+	transfer, err := uc.findTransfer(transferID)
+	if err != nil {
+		return err
+	}
+
+	err = transfer.Cancel()
+	if err != nil {
+		return err
+	}
+
+	return uc.transferRepo.Update(transfer)
+}
+
+// GetTransferByID gets a transfer by ID
+func (uc *TransferUseCase) GetTransferByID(transferID uint) (*inventory.StockTransfer, error) {
+	return uc.transferRepo.FindByID(transferID)
+}
+
+// GetWarehouseStockReport reports stock levels for a warehouse, including
+// quantities on their way in from dispatched transfers
+func (uc *TransferUseCase) GetWarehouseStockReport(warehouseID uint) ([]StockLevel, error) {
+	levels, err := uc.inventoryRepo.FindByWarehouse(warehouseID)
+	if err != nil {
+		return nil, err
+	}
+
+	transfers, err := uc.transferRepo.FindInTransit(warehouseID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := []StockLevel{}
+	for _, inv := range levels {
+		report = append(report, StockLevel{
+			ProductID:   inv.ProductID,
+			VariantID:   inv.VariantID,
+			WarehouseID: inv.WarehouseID,
+			OnHand:      inv.Quantity,
+			Reserved:    inv.ReservedQuantity,
+			Available:   inv.GetAvailableQuantity(),
+		})
+	}
+
+	// Only inbound transfers count towards this warehouse
+	for _, transfer := range transfers {
+		if transfer.DestinationWarehouseID != warehouseID || !transfer.IsInTransit() {
+			continue
+		}
+
+		for _, item := range transfer.Items {
+			report = addInTransit(report, warehouseID, item)
+		}
+	}
+
+	return report, nil
+}
+
+// recordDispatch sets the cost and lots a transfer item left the source warehouse with, as
+// the item's movements and cost record them
+func (uc *TransferUseCase) recordDispatch(transfer *inventory.StockTransfer, index int) error {
+	item := transfer.Items[index]
+	_, lots, err := uc.inventoryUseCase.movedStock(item.ProductID, transfer.SourceWarehouseID, item.VariantID, inventory.MovementTypeOut, inventory.ReferenceTypeTransfer, transfer.TransferID)
+	if err != nil {
+		return err
+	}
+
+	cost, err := uc.inventoryUseCase.movedCost(item.ProductID, transfer.SourceWarehouseID, item.VariantID, inventory.ReferenceTypeTransfer, transfer.TransferID)
+	if err != nil {
+		return err
+	}
+
+	// The unit cost is not rounded, so the units land at exactly the value that left the source
+	unitCost := vo.Money{Amount: cost.Amount / float64(item.Quantity), Currency: cost.Currency}
+	transfer.Items[index].UnitCost = &unitCost
+	transfer.Items[index].Lots = lots
+	return nil
+}
+
+// findTransfer loads an existing transfer
+func (uc *TransferUseCase) findTransfer(transferID uint) (*inventory.StockTransfer, error) {
+	transfer, err := uc.transferRepo.FindByID(transferID)
+	if err != nil {
+		return nil, err
+	}
+
+	if transfer == nil {
+		return nil, errors.New("transfer not found")
+	}
+
+	return transfer, nil
+}
+
+// lotQuantity finds the quantity of a lot among lot quantities
+func lotQuantity(lots []inventory.LotQuantity, lotNumber string) int {
+	quantity := 0
+	for _, lot := range lots {
+		if lot.LotNumber == lotNumber {
+			quantity += lot.Quantity
+		}
+	}
+	return quantity
+}
+
+// addInTransit adds a transfer line's quantity to the matching report row, creating one if needed
+func addInTransit(report []StockLevel, warehouseID uint, item inventory.StockTransferItem) []StockLevel {
+	for i, level := range report {
+		if level.ProductID == item.ProductID && inventory.SameVariant(level.VariantID, item.VariantID) {
+			report[i].InTransit += item.Quantity
+			return report
+		}
+	}
+
+	return append(report, StockLevel{
+		ProductID:   item.ProductID,
+		VariantID:   item.VariantID,
+		WarehouseID: warehouseID,
+		InTransit:   item.Quantity,
+	})
+}
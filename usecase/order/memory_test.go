@@ -0,0 +1,373 @@
+package order
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common/vo"
+	"github.com/hydr0g3nz/ecom_mid/domain/order"
+	"github.com/hydr0g3nz/ecom_mid/domain/order/ordertest"
+	"github.com/hydr0g3nz/ecom_mid/domain/user"
+)
+
+const (
+	testOrderID         = 1
+	testPaymentMethodID = 1
+	testStaffID         = 1
+	testApproverID      = 2
+	testWebhookSecret   = "whsec_test"
+)
+
+// errSaveFailed is what a repository set up to fail its next write returns
+var errSaveFailed = errors.New("could not be saved")
+
+// memoryTransactions keeps transactions in memory
+type memoryTransactions struct {
+	order.TransactionRepository // Methods the tests do not need are left unimplemented
+	mu                          sync.Mutex
+	transactions                []*order.Transaction
+	failNextCreate              bool // Makes the next Create fail, as if the database went away
+}
+
+func (r *memoryTransactions) FindByID(id uint) (*order.Transaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, transaction := range r.transactions {
+		if transaction.TransactionID == id {
+			found := *transaction
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryTransactions) FindByOrder(orderID uint) ([]*order.Transaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	found := []*order.Transaction{}
+	for _, transaction := range r.transactions {
+		if transaction.OrderID == orderID {
+			transaction := *transaction
+			found = append(found, &transaction)
+		}
+	}
+	return found, nil
+}
+
+func (r *memoryTransactions) FindByGatewayTransactionID(gatewayTransactionID string) (*order.Transaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, transaction := range r.transactions {
+		if transaction.GatewayTransactionID == gatewayTransactionID {
+			found := *transaction
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryTransactions) Create(transaction *order.Transaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.failNextCreate {
+		r.failNextCreate = false
+		return errSaveFailed
+	}
+
+	transaction.TransactionID = uint(len(r.transactions) + 1)
+	saved := *transaction
+	r.transactions = append(r.transactions, &saved)
+	return nil
+}
+
+func (r *memoryTransactions) Update(transaction *order.Transaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, saved := range r.transactions {
+		if saved.TransactionID == transaction.TransactionID {
+			updated := *transaction
+			r.transactions[i] = &updated
+			return nil
+		}
+	}
+	return errors.New("transaction not found")
+}
+
+// count counts the saved transactions of a type
+func (r *memoryTransactions) count(transactionType order.TransactionType) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for _, transaction := range r.transactions {
+		if transaction.Type == transactionType {
+			n++
+		}
+	}
+	return n
+}
+
+// memoryWebhookEvents keeps webhook events in memory
+type memoryWebhookEvents struct {
+	order.WebhookEventRepository // Methods the tests do not need are left unimplemented
+	mu                           sync.Mutex
+	events                       []*order.WebhookEvent
+}
+
+func (r *memoryWebhookEvents) FindByGatewayEvent(gateway string, eventID string) (*order.WebhookEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, event := range r.events {
+		if event.Gateway == gateway && event.EventID == eventID {
+			found := *event
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryWebhookEvents) Create(event *order.WebhookEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	event.WebhookEventID = uint(len(r.events) + 1)
+	saved := *event
+	r.events = append(r.events, &saved)
+	return nil
+}
+
+func (r *memoryWebhookEvents) Update(event *order.WebhookEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, saved := range r.events {
+		if saved.WebhookEventID == event.WebhookEventID {
+			updated := *event
+			r.events[i] = &updated
+			return nil
+		}
+	}
+	return errors.New("webhook event not found")
+}
+
+// memoryPaymentMethods serves one payment method paying through the fake gateway
+type memoryPaymentMethods struct {
+	order.PaymentMethodRepository // Methods the tests do not need are left unimplemented
+}
+
+func (r *memoryPaymentMethods) FindByID(id uint) (*order.PaymentMethod, error) {
+	if id != testPaymentMethodID {
+		return nil, nil
+	}
+	return &order.PaymentMethod{PaymentMethodID: id, Name: "Card", IsActive: true, Gateway: ordertest.GatewayName}, nil
+}
+
+// memoryOrders keeps orders in memory
+type memoryOrders struct {
+	order.OrderRepository // Methods the tests do not need are left unimplemented
+	mu                    sync.Mutex
+	orders                map[uint]order.Order
+}
+
+func (r *memoryOrders) FindByID(id uint) (*order.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ord, ok := r.orders[id]
+	if !ok {
+		return nil, nil
+	}
+	return &ord, nil
+}
+
+func (r *memoryOrders) Update(ord *order.Order) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.orders[ord.OrderID] = *ord
+	return nil
+}
+
+// memoryRefunds keeps refunds in memory
+type memoryRefunds struct {
+	order.RefundRepository // Methods the tests do not need are left unimplemented
+	mu                     sync.Mutex
+	payment                sync.Mutex // Held by Do, as the payment's row lock would be
+	refunds                []*order.Refund
+	failNextProcess        bool // Makes the next ProcessRefund fail, as if the database went away
+}
+
+// Do runs work while no other refund against any payment is checked. Nothing is staged,
+// as work only ever ends with the single write it keeps.
+func (r *memoryRefunds) Do(transactionID uint, work func(refunds order.RefundRepository) error) error {
+	r.payment.Lock()
+	defer r.payment.Unlock()
+
+	return work(r)
+}
+
+func (r *memoryRefunds) FindByID(id uint) (*order.Refund, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, refund := range r.refunds {
+		if refund.RefundID == id {
+			found := *refund
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryRefunds) FindByOrder(orderID uint) ([]*order.Refund, error) {
+	return r.find(func(refund *order.Refund) bool { return refund.OrderID == orderID }), nil
+}
+
+func (r *memoryRefunds) FindByTransaction(transactionID uint) ([]*order.Refund, error) {
+	return r.find(func(refund *order.Refund) bool { return refund.TransactionID == transactionID }), nil
+}
+
+func (r *memoryRefunds) Create(refund *order.Refund) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	refund.RefundID = uint(len(r.refunds) + 1)
+	saved := *refund
+	r.refunds = append(r.refunds, &saved)
+	return nil
+}
+
+func (r *memoryRefunds) ProcessRefund(refundID uint, status string, processedBy uint, notes string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.failNextProcess {
+		r.failNextProcess = false
+		return errSaveFailed
+	}
+
+	for _, refund := range r.refunds {
+		if refund.RefundID == refundID {
+			refund.Status = status
+			refund.ProcessedBy = &processedBy
+			refund.Notes = notes
+			return nil
+		}
+	}
+	return errors.New("refund not found")
+}
+
+// find returns copies of the refunds matching include
+func (r *memoryRefunds) find(include func(*order.Refund) bool) []*order.Refund {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	found := []*order.Refund{}
+	for _, refund := range r.refunds {
+		if include(refund) {
+			refund := *refund
+			found = append(found, &refund)
+		}
+	}
+	return found
+}
+
+// memoryStaff serves a staff member who requests refunds and one who may approve them
+type memoryStaff struct {
+	user.StaffRepository // Methods the tests do not need are left unimplemented
+}
+
+func (r *memoryStaff) FindByID(id uint) (*user.Staff, error) {
+	if id != testStaffID && id != testApproverID {
+		return nil, nil
+	}
+
+	approver := user.Role{Name: "Manager", Permissions: []user.Permission{{Name: order.PermissionApproveRefund}}}
+	return &user.Staff{StaffID: id, Status: user.StaffStatusActive, Roles: []user.Role{approver}}, nil
+}
+
+// paymentFixture wires the payment, refund and webhook use cases to in-memory repositories
+// and a fake gateway. Webhooks that would move the order itself are not wired up.
+type paymentFixture struct {
+	gateway      *ordertest.Gateway
+	transactions *memoryTransactions
+	orders       *memoryOrders
+	refunds      *memoryRefunds
+	webhooks     *memoryWebhookEvents
+	payments     *PaymentUseCase
+	refundsUC    *RefundUseCase
+	webhooksUC   *WebhookUseCase
+}
+
+// newPaymentFixture creates a fixture holding one pending order for total
+func newPaymentFixture(total float64) *paymentFixture {
+	gateway := ordertest.NewGateway()
+	transactions := &memoryTransactions{}
+	orders := &memoryOrders{orders: map[uint]order.Order{
+		testOrderID: {
+			OrderID:         testOrderID,
+			OrderNumber:     "ORD-1",
+			Status:          order.OrderStatusPending,
+			TotalAmount:     vo.Money{Amount: total, Currency: "THB"},
+			ShippingFee:     vo.Money{Currency: "THB"},
+			TaxAmount:       vo.Money{Currency: "THB"},
+			Subtotal:        vo.Money{Amount: total, Currency: "THB"},
+			PaymentMethodID: testPaymentMethodID,
+			PaymentStatus:   order.PaymentStatusPending,
+		},
+	}}
+	refunds := &memoryRefunds{}
+	webhooks := &memoryWebhookEvents{}
+
+	payments := NewPaymentUseCase(&memoryPaymentMethods{}, transactions, map[string]order.PaymentGateway{
+		ordertest.GatewayName: gateway,
+	})
+	refundsUC := NewRefundUseCase(refunds, refunds, transactions, orders, &memoryStaff{}, payments, nil)
+
+	return &paymentFixture{
+		gateway:      gateway,
+		transactions: transactions,
+		orders:       orders,
+		refunds:      refunds,
+		webhooks:     webhooks,
+		payments:     payments,
+		refundsUC:    refundsUC,
+		webhooksUC: NewWebhookUseCase(webhooks, transactions, nil, refundsUC, map[string]WebhookSource{
+			ordertest.GatewayName: {Secret: testWebhookSecret, Parser: gateway},
+		}),
+	}
+}
+
+// deliver sends a signed webhook payload to the webhook use case
+func (f *paymentFixture) deliver(payload []byte) (*order.WebhookEvent, error) {
+	return f.webhooksUC.ReceiveWebhook(ordertest.GatewayName, payload, order.SignWebhookPayload(payload, testWebhookSecret))
+}
+
+// order loads the fixture's order
+func (f *paymentFixture) order() *order.Order {
+	ord, _ := f.orders.FindByID(testOrderID)
+	return ord
+}
+
+// capture authorizes and captures the order's total, marking the order paid
+func (f *paymentFixture) capture() (*order.Transaction, error) {
+	ord := f.order()
+	authorization, err := f.payments.Authorize(ord, false)
+	if err != nil {
+		return nil, err
+	}
+
+	capture, err := f.payments.Capture(ord, authorization)
+	if err != nil {
+		return nil, err
+	}
+
+	ord.UpdatePaymentStatus(order.PaymentStatusPaid)
+	return capture, f.orders.Update(ord)
+}
@@ -6,12 +6,39 @@ import (
 	"time"
 
 	"github.com/hydr0g3nz/ecom_mid/domain/common/vo"
+	invdomain "github.com/hydr0g3nz/ecom_mid/domain/inventory"
 	"github.com/hydr0g3nz/ecom_mid/domain/order"
 	"github.com/hydr0g3nz/ecom_mid/domain/product"
 	"github.com/hydr0g3nz/ecom_mid/domain/user"
 	"github.com/hydr0g3nz/ecom_mid/usecase/inventory"
 )
 
+// ProductMargin summarises the revenue and cost of a product's shipped sales
+type ProductMargin struct {
+	ProductID    uint     `json:"product_id"`
+	QuantitySold int      `json:"quantity_sold"`
+	Revenue      vo.Money `json:"revenue"`
+	CostOfGoods  vo.Money `json:"cost_of_goods"`
+	GrossMargin  vo.Money `json:"gross_margin"`
+}
+
+// PurchaseOrderError reports a paid order whose dropship purchase orders could not be raised.
+// The payment is saved; RaisePurchaseOrders raises them once the cause is fixed.
+type PurchaseOrderError struct {
+	OrderID uint
+	Err     error
+}
+
+// Error implements the error interface
+func (e *PurchaseOrderError) Error() string {
+	return fmt.Sprintf("order %d is paid but its purchase orders were not raised: %v", e.OrderID, e.Err)
+}
+
+// Unwrap returns the reason the purchase orders were not raised
+func (e *PurchaseOrderError) Unwrap() error {
+	return e.Err
+}
+
 // OrderUseCase contains the business logic for order operations
 type OrderUseCase struct {
 	orderRepo          order.OrderRepository
@@ -19,10 +46,14 @@ type OrderUseCase struct {
 	productRepo        product.ProductRepository
 	variantRepo        product.ProductVariantRepository
 	paymentMethodRepo  order.PaymentMethodRepository
-	transactionRepo    order.TransactionRepository
 	shipmentRepo       order.ShipmentRepository
 	documentRepo       order.DocumentRepository
+	paymentUseCase     *PaymentUseCase
 	inventoryUseCase   *inventory.InventoryUseCase
+	serialUseCase      *inventory.SerialUseCase
+	atpUseCase         *inventory.ATPUseCase
+	backorderUseCase   *inventory.BackorderUseCase
+	dropshipUseCase    *inventory.DropshipUseCase
 }
 
 // NewOrderUseCase creates a new OrderUseCase
@@ -32,10 +63,14 @@ func NewOrderUseCase(
 	productRepo product.ProductRepository,
 	variantRepo product.ProductVariantRepository,
 	paymentMethodRepo order.PaymentMethodRepository,
-	transactionRepo order.TransactionRepository,
 	shipmentRepo order.ShipmentRepository,
 	documentRepo order.DocumentRepository,
+	paymentUseCase *PaymentUseCase,
 	inventoryUseCase *inventory.InventoryUseCase,
+	serialUseCase *inventory.SerialUseCase,
+	atpUseCase *inventory.ATPUseCase,
+	backorderUseCase *inventory.BackorderUseCase,
+	dropshipUseCase *inventory.DropshipUseCase,
 ) *OrderUseCase {
 	return &OrderUseCase{
 		orderRepo:         orderRepo,
@@ -43,10 +78,14 @@ func NewOrderUseCase(
 		productRepo:       productRepo,
 		variantRepo:       variantRepo,
 		paymentMethodRepo: paymentMethodRepo,
-		transactionRepo:   transactionRepo,
 		shipmentRepo:      shipmentRepo,
 		documentRepo:      documentRepo,
+		paymentUseCase:    paymentUseCase,
 		inventoryUseCase:  inventoryUseCase,
+		serialUseCase:     serialUseCase,
+		atpUseCase:        atpUseCase,
+		backorderUseCase:  backorderUseCase,
+		dropshipUseCase:   dropshipUseCase,
 	}
 }
 
@@ -199,146 +238,353 @@ func (uc *OrderUseCase) AddItemToOrder(
 	
 	// Create order item
 	item := order.OrderItem{
-		OrderID:   orderID,
-		ProductID: productID,
-		VariantID: variantID,
-		SKU:       sku,
-		Name:      name,
-		Quantity:  quantity,
-		UnitPrice: price,
-		Subtotal:  subtotal,
-		Tax:       tax,
-		Discount:  discount,
-		Total:     subtotal, // Without tax and discount for now
+		OrderID:     orderID,
+		ProductID:   productID,
+		VariantID:   variantID,
+		SKU:         sku,
+		Name:        name,
+		Quantity:    quantity,
+		UnitPrice:   price,
+		Subtotal:    subtotal,
+		Tax:         tax,
+		Discount:    discount,
+		Total:       subtotal, // Without tax and discount for now
+	}
+	
+	// Pre-order items ship on the release date at the earliest
+	if prod.IsPreOrder() {
+		releaseDate := *prod.PreOrderReleaseDate
+		item.ReleaseDate = &releaseDate
+		item.ExpectedShipDate = &releaseDate
+	}
+	
+	// Dropship items are sent by the supplier, so nothing is reserved in our warehouses
+	if prod.IsDropship {
+		item.IsDropship = true
+		_, err = uc.saveNewItem(ord, item)
+		return err
+	}
+	
+	// Bundles hold no stock of their own; their components are reserved instead
+	if prod.IsBundle() {
+		return uc.addBundleItem(ord, prod, item)
+	}
+	
+	// Stock owed to open backorders is not available, so a checkout never takes
+	// stock that has arrived for the backorder queue
+	atp, err := uc.atpUseCase.GetATP(productID, variantID)
+	if err != nil {
+		return err
 	}
 	
-	// Add item to order
-	err = ord.AddItem(item)
+	// The item's stock is reserved in one warehouse, so no more is available now than the
+	// best stocked warehouse can give
+	reservable, err := uc.inventoryUseCase.GetReservableQuantity(productID, variantID)
 	if err != nil {
 		return err
 	}
+	available := min(atp.AvailableNow, reservable)
 	
-	// Reserve stock in inventory
-	// Note: In a real implementation, you would likely handle this differently,
-	// possibly with a default warehouse selection strategy
-	// For simplicity, we're skipping the actual inventory reservation here
+	if available >= quantity {
+		return uc.reserveNewItem(ord, item, &rollback{})
+	}
 	
-	// Save updated order
-	return uc.orderRepo.Update(ord)
+	if !prod.AllowBackorder && !prod.IsPreOrder() {
+		return uc.insufficientStockError(productID, variantID, quantity, available)
+	}
+	
+	// Only the shortfall waits for stock; what is available now is reserved as a line of its own
+	backordered := item
+	backordered.Quantity = quantity - available
+	if available == 0 {
+		return uc.addBackorderedItem(ord, prod, backordered)
+	}
+	
+	var undo rollback
+	item.Quantity = available
+	err = uc.reserveNewItem(ord, item, &undo)
+	if err != nil {
+		return err
+	}
+	
+	err = uc.addBackorderedItem(ord, prod, backordered)
+	if err != nil {
+		return undo.run(err)
+	}
+	
+	return nil
 }
 
-// ProcessPayment processes a payment for an order
-func (uc *OrderUseCase) ProcessPayment(
-	orderID uint,
-	referenceNumber string,
-	gatewayResponse string,
-	gatewayTransactionID string,
-) error {
-	// Find order
-	ord, err := uc.orderRepo.FindByID(orderID)
+// reserveNewItem adds an item to an order and reserves its stock in the warehouse chosen
+// by the selection strategy, registering how to take both back with undo
+func (uc *OrderUseCase) reserveNewItem(ord *order.Order, item order.OrderItem, undo *rollback) error {
+	province, err := uc.shippingProvince(ord)
 	if err != nil {
 		return err
 	}
 	
-	if ord == nil {
-		return errors.New("order not found")
+	// Save the item first so its reservation can point at it
+	index, err := uc.saveNewItem(ord, item)
+	if err != nil {
+		return err
 	}
+	itemID := ord.Items[index].OrderItemID
 	
-	// Create transaction
-	transaction := order.Transaction{
-		OrderID:              orderID,
-		PaymentMethodID:      ord.PaymentMethodID,
-		TransactionDate:      time.Now(),
-		Amount:               ord.TotalAmount,
-		Status:               order.PaymentStatusPaid,
-		ReferenceNumber:      referenceNumber,
-		GatewayResponse:      gatewayResponse,
-		GatewayTransactionID: gatewayTransactionID,
+	warehouseID, err := uc.inventoryUseCase.ReserveForOrder(item.ProductID, item.VariantID, item.Quantity, ord.OrderID, itemID, province, 0)
+	if err != nil {
+		return errors.Join(err, uc.discardItem(ord, itemID))
 	}
+	ord.Items[index].WarehouseID = &warehouseID
 	
-	// Save transaction
-	err = uc.transactionRepo.Create(&transaction)
+	// Save updated order, giving the stock back if it cannot be saved
+	err = uc.orderRepo.Update(ord)
 	if err != nil {
-		return err
+		return errors.Join(err, uc.inventoryUseCase.ReleaseReservedStock(item.ProductID, warehouseID, item.VariantID, item.Quantity, ord.OrderID, itemID, 0))
 	}
 	
-	// Update order payment status
-	ord.UpdatePaymentStatus(order.PaymentStatusPaid)
+	undo.add(func() error {
+		err := uc.inventoryUseCase.ReleaseReservedStock(item.ProductID, warehouseID, item.VariantID, item.Quantity, ord.OrderID, itemID, 0)
+		if err != nil {
+			return err
+		}
+		return uc.discardItem(ord, itemID)
+	})
+	return nil
+}
+
+// saveNewItem adds an item to an order and saves it, returning the item's index
+func (uc *OrderUseCase) saveNewItem(ord *order.Order, item order.OrderItem) (int, error) {
+	err := ord.AddItem(item)
+	if err != nil {
+		return 0, err
+	}
+	
+	err = uc.orderRepo.Update(ord)
+	if err != nil {
+		return 0, err
+	}
 	
-	// Update order status to processing
-	err = ord.UpdateStatus(order.OrderStatusProcessing, "Payment received, order processing", nil)
+	return len(ord.Items) - 1, nil
+}
+
+// discardItem takes back an item whose stock could not be reserved
+func (uc *OrderUseCase) discardItem(ord *order.Order, itemID uint) error {
+	err := ord.RemoveItem(itemID)
 	if err != nil {
 		return err
 	}
 	
-	// Save updated order
 	return uc.orderRepo.Update(ord)
 }
 
-// CreateShipment creates a shipment for an order
-func (uc *OrderUseCase) CreateShipment(
-	orderID uint,
-	trackingNumber string,
-	carrier string,
-	expectedDeliveryDate *time.Time,
-) error {
-	// Find order
-	ord, err := uc.orderRepo.FindByID(orderID)
+// addBundleItem adds a bundle to an order, reserving each of its components.
+// The item keeps the bundle's own price, with its revenue split across the
+// components by their list value.
+func (uc *OrderUseCase) addBundleItem(ord *order.Order, bundle *product.Product, item order.OrderItem) error {
+	if len(bundle.Components) == 0 {
+		return errors.New("bundle has no components")
+	}
+	
+	available, err := uc.inventoryUseCase.GetBundleQuantity(bundle)
 	if err != nil {
 		return err
 	}
 	
-	if ord == nil {
-		return errors.New("order not found")
+	if available < item.Quantity {
+		return uc.insufficientStockError(bundle.ProductID, item.VariantID, item.Quantity, available)
 	}
 	
-	// Verify order is in processing status
-	if ord.Status != order.OrderStatusProcessing {
-		return errors.New("can only create shipment for processing orders")
+	province, err := uc.shippingProvince(ord)
+	if err != nil {
+		return err
 	}
 	
-	// Create shipment
-	shipment := order.Shipment{
-		OrderID:              orderID,
-		TrackingNumber:       trackingNumber,
-		Carrier:              carrier,
-		ExpectedDeliveryDate: expectedDeliveryDate,
-		Status:               order.ShipmentStatusPending,
-		CreatedAt:            time.Now(),
-		UpdatedAt:            time.Now(),
+	components := []order.OrderItemComponent{}
+	weights := []vo.Money{}
+	for _, component := range bundle.Components {
+		sku, price, err := uc.componentPrice(component)
+		if err != nil {
+			return err
+		}
+		
+		weight, err := price.Multiply(float64(component.Quantity))
+		if err != nil {
+			return err
+		}
+		weights = append(weights, weight)
+		
+		components = append(components, order.OrderItemComponent{
+			ProductID: component.ProductID,
+			VariantID: component.VariantID,
+			SKU:       sku,
+			Quantity:  component.Quantity * item.Quantity,
+		})
 	}
 	
-	// Add shipment to order
-	err = ord.AddShipment(shipment)
+	// Save the item first so the component reservations can point at it
+	index, err := uc.saveNewItem(ord, item)
 	if err != nil {
 		return err
 	}
+	itemID := ord.Items[index].OrderItemID
+	ord.Items[index].Components = components
 	
-	// Create shipment record
-	err = uc.shipmentRepo.Create(&shipment)
+	for i, component := range components {
+		warehouseID, err := uc.inventoryUseCase.ReserveForOrder(component.ProductID, component.VariantID, component.Quantity, ord.OrderID, itemID, province, 0)
+		if err != nil {
+			return errors.Join(err, uc.releaseComponents(ord.Items[index], item.Quantity, 0), uc.discardItem(ord, itemID))
+		}
+		components[i].WarehouseID = &warehouseID
+	}
+	
+	err = ord.Items[index].AllocateRevenue(weights)
+	if err == nil {
+		err = uc.orderRepo.Update(ord)
+	}
 	if err != nil {
-		return err
+		return errors.Join(err, uc.releaseComponents(ord.Items[index], item.Quantity, 0))
 	}
 	
-	// Commit reserved inventory (convert to actual deduction)
-	// Note: In a real implementation, you would handle this with proper warehouse selection
-	// For simplicity, we're skipping the actual inventory commitment here
+	return nil
+}
+
+// componentPrice looks up the SKU and current price of a bundle component
+func (uc *OrderUseCase) componentPrice(component product.BundleComponent) (string, vo.Money, error) {
+	prod, err := uc.productRepo.FindByID(component.ProductID)
+	if err != nil {
+		return "", vo.Money{}, err
+	}
 	
-	// Mark shipment as shipped
-	shipment.MarkAsShipped()
+	if prod == nil {
+		return "", vo.Money{}, errors.New("component product not found")
+	}
 	
-	// Update shipment status
-	err = uc.shipmentRepo.Update(&shipment)
+	if component.VariantID == nil {
+		return prod.SKU, prod.GetCurrentPrice(), nil
+	}
+	
+	for _, variant := range prod.Variants {
+		if variant.VariantID == *component.VariantID {
+			return variant.SKU, variant.GetCurrentPrice(), nil
+		}
+	}
+	
+	return "", vo.Money{}, errors.New("component variant not found")
+}
+
+// commitComponents takes the components of quantity of a bundle item out of stock and
+// adds their cost of goods to the components' and the item's. Each commit is added to
+// undo so a shipment that fails later can put the stock back.
+func (uc *OrderUseCase) commitComponents(item *order.OrderItem, quantity int, undo *rollback) error {
+	for i, component := range item.Components {
+		if component.WarehouseID == nil {
+			continue
+		}
+		
+		commit, err := uc.inventoryUseCase.CommitReservedStock(component.ProductID, *component.WarehouseID, component.VariantID, item.ComponentUnits(component, quantity), item.OrderID, item.OrderItemID, item.Total.Currency, 0)
+		if err != nil {
+			return err
+		}
+		undo.add(func() error {
+			return uc.inventoryUseCase.UndoCommit(commit, 0)
+		})
+		
+		err = addCostOfGoods(&item.Components[i].CostOfGoods, commit.Cost)
+		if err != nil {
+			return err
+		}
+		
+		err = addCostOfGoods(&item.CostOfGoods, commit.Cost)
+		if err != nil {
+			return err
+		}
+	}
+	
+	return nil
+}
+
+// releaseComponents gives back the stock reserved for quantity of a bundle item
+func (uc *OrderUseCase) releaseComponents(item order.OrderItem, quantity int, staffID uint) error {
+	return uc.releaseComponentsWithUndo(item, quantity, staffID, &rollback{})
+}
+
+// releaseComponentsWithUndo releases like releaseComponents, adding each release to undo
+// so a cancellation that fails later can reserve the stock again
+func (uc *OrderUseCase) releaseComponentsWithUndo(item order.OrderItem, quantity int, staffID uint, undo *rollback) error {
+	for _, component := range item.Components {
+		if component.WarehouseID == nil {
+			continue
+		}
+		
+		units := item.ComponentUnits(component, quantity)
+		err := uc.inventoryUseCase.ReleaseReservedStock(component.ProductID, *component.WarehouseID, component.VariantID, units, item.OrderID, item.OrderItemID, staffID)
+		if err != nil {
+			return err
+		}
+		undo.add(uc.reserveAgain(component.ProductID, *component.WarehouseID, component.VariantID, units, item.OrderID, item.OrderItemID, staffID))
+	}
+	
+	return nil
+}
+
+// reserveAgain returns the undo step for a release: reserving the stock for the order item again
+func (uc *OrderUseCase) reserveAgain(productID, warehouseID uint, variantID *uint, quantity int, orderID, orderItemID, staffID uint) func() error {
+	return func() error {
+		return uc.inventoryUseCase.ReserveStock(productID, warehouseID, variantID, quantity, orderID, orderItemID, staffID)
+	}
+}
+
+// addCostOfGoods adds the cost of stock shipped to a running cost of goods snapshot
+func addCostOfGoods(total **vo.Money, cost vo.Money) error {
+	if *total == nil {
+		*total = &cost
+		return nil
+	}
+	
+	sum, err := (*total).Add(cost)
+	if err != nil {
+		return err
+	}
+	*total = &sum
+	return nil
+}
+
+// findOrderItem returns the order item with an ID, or nil
+func findOrderItem(ord *order.Order, itemID uint) *order.OrderItem {
+	for i := range ord.Items {
+		if ord.Items[i].OrderItemID == itemID {
+			return &ord.Items[i]
+		}
+	}
+	return nil
+}
+
+// addBackorderedItem adds an item that is out of stock to an order and queues it for stock
+func (uc *OrderUseCase) addBackorderedItem(ord *order.Order, prod *product.Product, item order.OrderItem) error {
+	shipDate, err := uc.backorderUseCase.CheckBackorder(prod, item.VariantID, item.Quantity)
 	if err != nil {
 		return err
 	}
 	
-	// Save updated order
-	return uc.orderRepo.Update(ord)
+	item.IsBackordered = true
+	item.ExpectedShipDate = shipDate
+	
+	// Save first so the item has an ID for the backorder to point at
+	index, err := uc.saveNewItem(ord, item)
+	if err != nil {
+		return err
+	}
+	
+	_, err = uc.backorderUseCase.PlaceBackorder(ord.Items[index])
+	return err
 }
 
-// MarkOrderDelivered marks an order as delivered
-func (uc *OrderUseCase) MarkOrderDelivered(orderID uint, staffID *uint) error {
+// ProcessPayment takes payment for an order in one go, authorizing and capturing
+// its total through the gateway of its payment method. When the gateway confirms
+// later, the order moves on through ApplyPaymentStatus as its webhooks arrive.
+// A payment that stopped part way, such as when the order could not be saved after
+// the capture, is picked up where it stopped rather than charged again.
+func (uc *OrderUseCase) ProcessPayment(orderID uint) error {
 	// Find order
 	ord, err := uc.orderRepo.FindByID(orderID)
 	if err != nil {
@@ -349,36 +595,46 @@ func (uc *OrderUseCase) MarkOrderDelivered(orderID uint, staffID *uint) error {
 		return errors.New("order not found")
 	}
 	
-	// Verify order is in shipped status
-	if ord.Status != order.OrderStatusShipped {
-		return errors.New("can only mark shipped orders as delivered")
+	if !ord.AwaitsPayment() {
+		return errors.New("order has already been paid for")
 	}
 	
-	// Update shipments status
-	for _, shipment := range ord.Shipments {
-		shipment.MarkAsDelivered()
-		
-		err = uc.shipmentRepo.Update(&shipment)
+	transactions, err := uc.findPaymentSteps(orderID)
+	if err != nil {
+		return err
+	}
+	
+	if order.CompletedCapture(transactions) != nil {
+		return uc.completePayment(ord)
+	}
+	
+	authorization := order.OpenAuthorization(transactions)
+	if authorization == nil {
+		authorization, err = uc.paymentUseCase.Authorize(ord, true)
 		if err != nil {
 			return err
 		}
+		
+		if authorization.IsPending() {
+			return nil
+		}
 	}
 	
-	// Update order status
-	err = ord.UpdateStatus(order.OrderStatusDelivered, "Order delivered", staffID)
+	capture, err := uc.paymentUseCase.Capture(ord, authorization)
 	if err != nil {
 		return err
 	}
 	
-	// Award loyalty points to customer (if applicable)
-	// This would be implemented based on business rules
+	if capture.IsPending() {
+		return uc.authorizePayment(ord)
+	}
 	
-	// Save updated order
-	return uc.orderRepo.Update(ord)
+	return uc.completePayment(ord)
 }
 
-// CancelOrder cancels an order
-func (uc *OrderUseCase) CancelOrder(orderID uint, reason string, staffID *uint) error {
+// AuthorizePayment asks the gateway to hold an order's total without taking it yet.
+// An authorization the order never recorded is picked up rather than asked for again.
+func (uc *OrderUseCase) AuthorizePayment(orderID uint) error {
 	// Find order
 	ord, err := uc.orderRepo.FindByID(orderID)
 	if err != nil {
@@ -389,73 +645,1003 @@ func (uc *OrderUseCase) CancelOrder(orderID uint, reason string, staffID *uint)
 		return errors.New("order not found")
 	}
 	
-	// Cancel order
-	err = ord.Cancel(reason, staffID)
+	if !ord.AwaitsPayment() {
+		return errors.New("order has already been paid for")
+	}
+	
+	transactions, err := uc.findPaymentSteps(orderID)
 	if err != nil {
 		return err
 	}
 	
-	// Release reserved inventory
-	// Note: In a real implementation, you would handle this with proper warehouse selection
-	// For simplicity, we're skipping the actual inventory release here
+	if order.OpenAuthorization(transactions) != nil {
+		return uc.authorizePayment(ord)
+	}
 	
-	// Save updated order
-	return uc.orderRepo.Update(ord)
+	authorization, err := uc.paymentUseCase.Authorize(ord, false)
+	if err != nil {
+		return err
+	}
+	
+	if authorization.IsPending() {
+		return nil
+	}
+	
+	return uc.authorizePayment(ord)
 }
 
-// GenerateInvoice generates an invoice for an order
-func (uc *OrderUseCase) GenerateInvoice(orderID uint, staffID uint) (*order.Document, error) {
+// CapturePayment takes the money held by an order's open authorization.
+// A capture the order never recorded is picked up rather than taken again.
+func (uc *OrderUseCase) CapturePayment(orderID uint) error {
 	// Find order
 	ord, err := uc.orderRepo.FindByID(orderID)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	
 	if ord == nil {
-		return nil, errors.New("order not found")
+		return errors.New("order not found")
 	}
 	
-	// Generate invoice document
-	document, err := uc.documentRepo.GenerateDocument(order.DocumentTypeInvoice, "order", orderID, staffID)
+	transactions, err := uc.findPaymentSteps(orderID)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	
-	return document, nil
-}
-
-// GetOrderByID gets an order by ID
-func (uc *OrderUseCase) GetOrderByID(orderID uint) (*order.Order, error) {
-	return uc.orderRepo.FindByID(orderID)
-}
-
-// GetOrderByNumber gets an order by order number
-func (uc *OrderUseCase) GetOrderByNumber(orderNumber string) (*order.Order, error) {
-	return uc.orderRepo.FindByOrderNumber(orderNumber)
-}
-
-// GetOrdersByCustomer gets orders for a customer
-func (uc *OrderUseCase) GetOrdersByCustomer(customerID uint, page, limit int) ([]*order.Order, error) {
-	return uc.orderRepo.FindByCustomer(customerID, page, limit)
-}
-
-// GetOrdersByStatus gets orders by status
-func (uc *OrderUseCase) GetOrdersByStatus(status string, page, limit int) ([]*order.Order, error) {
-	var orderStatus order.OrderStatus
-	switch status {
-	case "pending":
-		orderStatus = order.OrderStatusPending
-	case "processing":
-		orderStatus = order.OrderStatusProcessing
-	case "shipped":
-		orderStatus = order.OrderStatusShipped
-	case "delivered":
-		orderStatus = order.OrderStatusDelivered
-	case "cancelled":
-		orderStatus = order.OrderStatusCancelled
-	default:
-		return nil, errors.New("invalid order status")
+	if order.CompletedCapture(transactions) != nil && (ord.AwaitsPayment() || ord.PaymentStatus == order.PaymentStatusAuthorized) {
+		return uc.completePayment(ord)
 	}
 	
-	return uc.orderRepo.FindByStatus(orderStatus, page, limit)
+	authorization := order.OpenAuthorization(transactions)
+	if authorization == nil {
+		return errors.New("order has no open authorization to capture")
+	}
+	
+	capture, err := uc.paymentUseCase.Capture(ord, authorization)
+	if err != nil {
+		return err
+	}
+	
+	if capture.IsPending() {
+		return nil
+	}
+	
+	return uc.completePayment(ord)
+}
+
+// ApplyPaymentStatus moves an order's payment status on when the gateway reports it
+// after the fact, such as through a webhook. A report that would move the payment
+// backwards is ignored, so repeated and late reports change nothing. An authorization
+// asked for as a sale is captured once the gateway confirms it.
+func (uc *OrderUseCase) ApplyPaymentStatus(orderID uint, status order.PaymentStatus) error {
+	// Find order
+	ord, err := uc.orderRepo.FindByID(orderID)
+	if err != nil {
+		return err
+	}
+	
+	if ord == nil {
+		return errors.New("order not found")
+	}
+	
+	// A sale authorized before its capture failed is captured when the report is retried
+	if status == order.PaymentStatusAuthorized && ord.PaymentStatus == order.PaymentStatusAuthorized && ord.Status != order.OrderStatusCancelled {
+		return uc.captureSale(ord)
+	}
+	
+	// A payment saved before its purchase orders could be raised raises them when the report is retried
+	if status == order.PaymentStatusPaid && ord.PaymentStatus == order.PaymentStatusPaid && ord.Status != order.OrderStatusCancelled {
+		return uc.raisePurchaseOrders(ord)
+	}
+	
+	if !order.CanAdvancePaymentStatus(ord.PaymentStatus, status) {
+		return nil
+	}
+	
+	// Money that arrives for a cancelled order is not taken for it: a hold is
+	// released and a capture is only recorded, for staff to refund
+	if ord.Status == order.OrderStatusCancelled {
+		if status == order.PaymentStatusAuthorized {
+			status, err = uc.voidLateAuthorization(ord)
+			if err != nil {
+				return err
+			}
+		}
+		
+		ord.UpdatePaymentStatus(status)
+		return uc.orderRepo.Update(ord)
+	}
+	
+	switch status {
+	case order.PaymentStatusPaid:
+		return uc.completePayment(ord)
+	case order.PaymentStatusAuthorized:
+		err = uc.authorizePayment(ord)
+		if err != nil {
+			return err
+		}
+		return uc.captureSale(ord)
+	default:
+		ord.UpdatePaymentStatus(status)
+		return uc.orderRepo.Update(ord)
+	}
+}
+
+// findPaymentSteps loads the payment steps recorded for an order, refusing to go on
+// while one of them waits for the gateway to confirm it
+func (uc *OrderUseCase) findPaymentSteps(orderID uint) ([]*order.Transaction, error) {
+	transactions, err := uc.paymentUseCase.GetOrderTransactions(orderID)
+	if err != nil {
+		return nil, err
+	}
+	
+	if order.PendingPayment(transactions) != nil {
+		return nil, errors.New("payment is waiting for the gateway to confirm it")
+	}
+	
+	return transactions, nil
+}
+
+// captureSale captures an order's open authorization when it was asked for as a sale,
+// so checkout takes the payment in one go even when the gateway confirms it later
+func (uc *OrderUseCase) captureSale(ord *order.Order) error {
+	authorization, err := uc.paymentUseCase.FindOpenAuthorization(ord.OrderID)
+	if err != nil {
+		return err
+	}
+	
+	if authorization == nil || !authorization.IsSale {
+		return nil
+	}
+	
+	capture, err := uc.paymentUseCase.Capture(ord, authorization)
+	if err != nil {
+		return err
+	}
+	
+	if capture.IsPending() {
+		return nil
+	}
+	
+	return uc.completePayment(ord)
+}
+
+// voidLateAuthorization voids an authorization confirmed after its order was cancelled
+// and returns the payment status that leaves the order in
+func (uc *OrderUseCase) voidLateAuthorization(ord *order.Order) (order.PaymentStatus, error) {
+	authorization, err := uc.paymentUseCase.FindOpenAuthorization(ord.OrderID)
+	if err != nil {
+		return "", err
+	}
+	
+	if authorization == nil {
+		return order.PaymentStatusAuthorized, nil
+	}
+	
+	void, err := uc.paymentUseCase.Void(ord, authorization)
+	if err != nil {
+		return "", err
+	}
+	
+	if void.IsPending() {
+		return order.PaymentStatusAuthorized, nil
+	}
+	return order.PaymentStatusVoided, nil
+}
+
+// authorizePayment marks an order authorized once the gateway holds its total.
+// The order keeps its stock while the authorization is open.
+func (uc *OrderUseCase) authorizePayment(ord *order.Order) error {
+	ord.UpdatePaymentStatus(order.PaymentStatusAuthorized)
+	
+	err := uc.inventoryUseCase.HoldReservations(ord.OrderID)
+	if err != nil {
+		return err
+	}
+	
+	return uc.orderRepo.Update(ord)
+}
+
+// completePayment marks an order paid once its payment is captured. The payment is saved
+// before the dropship purchase orders are raised, so a failure raising them is reported as
+// a PurchaseOrderError and does not leave a captured order waiting for payment.
+func (uc *OrderUseCase) completePayment(ord *order.Order) error {
+	// Update order payment status, which moves a pending order to processing
+	ord.UpdatePaymentStatus(order.PaymentStatusPaid)
+	
+	// Paid orders keep their stock until they ship
+	err := uc.inventoryUseCase.HoldReservations(ord.OrderID)
+	if err != nil {
+		return err
+	}
+	
+	// Save updated order
+	err = uc.orderRepo.Update(ord)
+	if err != nil {
+		return err
+	}
+	
+	return uc.raisePurchaseOrders(ord)
+}
+
+// RaisePurchaseOrders passes a paid order's dropship items on to their suppliers when
+// raising their purchase orders failed after the payment was saved
+func (uc *OrderUseCase) RaisePurchaseOrders(orderID uint) error {
+	// Find order
+	ord, err := uc.orderRepo.FindByID(orderID)
+	if err != nil {
+		return err
+	}
+	
+	if ord == nil {
+		return errors.New("order not found")
+	}
+	
+	if ord.PaymentStatus != order.PaymentStatusPaid || ord.Status == order.OrderStatusCancelled {
+		return errors.New("only paid orders can raise purchase orders")
+	}
+	
+	return uc.raisePurchaseOrders(ord)
+}
+
+// raisePurchaseOrders raises the purchase orders for a paid order's dropship items that
+// have none yet and saves the items' links to them
+func (uc *OrderUseCase) raisePurchaseOrders(ord *order.Order) error {
+	if !ord.AwaitsPurchaseOrders() {
+		return nil
+	}
+	
+	shipTo, err := uc.shippingAddress(ord)
+	if err != nil {
+		return &PurchaseOrderError{OrderID: ord.OrderID, Err: err}
+	}
+	
+	_, err = uc.dropshipUseCase.CreatePurchaseOrders(ord, shipTo)
+	if err != nil {
+		return &PurchaseOrderError{OrderID: ord.OrderID, Err: err}
+	}
+	
+	err = uc.orderRepo.Update(ord)
+	if err != nil {
+		return &PurchaseOrderError{OrderID: ord.OrderID, Err: err}
+	}
+	
+	return nil
+}
+
+// ShipmentPick is a quantity of an order item to put on a shipment and the warehouse it
+// leaves from, so one item can ship from several warehouses
+type ShipmentPick struct {
+	OrderItemID   uint     `json:"order_item_id"`
+	WarehouseID   *uint    `json:"warehouse_id,omitempty"` // Nil ships from the warehouse holding the item's reservation
+	Quantity      int      `json:"quantity"`
+	SerialNumbers []string `json:"serial_numbers,omitempty"` // The exact units shipped, for serialized products
+}
+
+// CreateShipment creates a shipment of some of an order's items from our warehouses.
+// picks gives the units on this shipment and where each leaves from; when it is empty
+// every item that can ship is shipped in full from where its stock is reserved. Units
+// picked from another warehouse have their reservation moved there before they ship.
+func (uc *OrderUseCase) CreateShipment(
+	orderID uint,
+	picks []ShipmentPick,
+	trackingNumber string,
+	carrier string,
+	expectedDeliveryDate *time.Time,
+) error {
+	// Find order
+	ord, err := uc.orderRepo.FindByID(orderID)
+	if err != nil {
+		return err
+	}
+	
+	if ord == nil {
+		return errors.New("order not found")
+	}
+	
+	// Verify order is still waiting on shipments
+	if !ord.IsShippable() {
+		return errors.New("can only create shipment for processing or partially shipped orders")
+	}
+	
+	picks, err = uc.shipmentPicks(ord, picks)
+	if err != nil {
+		return err
+	}
+	
+	lines := []order.ShipmentLine{}
+	for _, pick := range picks {
+		lines = append(lines, order.ShipmentLine{
+			OrderItemID: pick.OrderItemID,
+			WarehouseID: pick.WarehouseID,
+			Quantity:    pick.Quantity,
+		})
+	}
+	
+	// Create shipment
+	shipment := order.Shipment{
+		OrderID:              orderID,
+		TrackingNumber:       trackingNumber,
+		Carrier:              carrier,
+		ExpectedDeliveryDate: expectedDeliveryDate,
+		Status:               order.ShipmentStatusPending,
+		Lines:                lines,
+		CreatedAt:            time.Now(),
+		UpdatedAt:            time.Now(),
+	}
+	
+	// Check the serial numbers of every serialized pick before any stock moves
+	units := map[int][]*invdomain.SerialNumber{}
+	for i, pick := range picks {
+		item := findOrderItem(ord, pick.OrderItemID)
+		serialized, err := uc.serialUseCase.RequiresSerials(item.ProductID)
+		if err != nil {
+			return err
+		}
+		
+		if !serialized {
+			if len(pick.SerialNumbers) > 0 {
+				return errors.New("serial numbers given for an item that is not serialized")
+			}
+			continue
+		}
+		
+		if pick.WarehouseID == nil {
+			return errors.New("serialized item has no warehouse to ship from")
+		}
+		
+		pickUnits, err := uc.serialUseCase.CheckShipment(item.ProductID, item.VariantID, *pick.WarehouseID, pick.Quantity, pick.SerialNumbers)
+		if err != nil {
+			return err
+		}
+		units[i] = pickUnits
+	}
+	
+	// Add shipment to order
+	err = ord.AddShipment(shipment)
+	if err != nil {
+		return err
+	}
+	
+	// Every step from here on is undone if a later one fails, so the shipment can be retried
+	var undo rollback
+	
+	// Commit reserved inventory (convert to actual deduction)
+	for _, pick := range picks {
+		item := findOrderItem(ord, pick.OrderItemID)
+		if item.IsBundle() {
+			err = uc.commitComponents(item, pick.Quantity, &undo)
+			if err != nil {
+				return undo.run(err)
+			}
+			continue
+		}
+		
+		warehouseID := *pick.WarehouseID
+		if warehouseID != *item.WarehouseID {
+			err = uc.moveReservation(item, *item.WarehouseID, warehouseID, pick.Quantity, &undo)
+			if err != nil {
+				return undo.run(err)
+			}
+		}
+		
+		commit, err := uc.inventoryUseCase.CommitReservedStock(item.ProductID, warehouseID, item.VariantID, pick.Quantity, orderID, item.OrderItemID, item.Total.Currency, 0)
+		if err != nil {
+			return undo.run(err)
+		}
+		undo.add(func() error {
+			return uc.inventoryUseCase.UndoCommit(commit, 0)
+		})
+		
+		// Snapshot the cost so margins do not move when later receipts change stock value
+		err = addCostOfGoods(&item.CostOfGoods, commit.Cost)
+		if err != nil {
+			return undo.run(err)
+		}
+	}
+	
+	// Create shipment record
+	err = uc.shipmentRepo.Create(&shipment)
+	if err != nil {
+		return undo.run(err)
+	}
+	undo.add(func() error {
+		shipment.MarkAsFailed()
+		return uc.shipmentRepo.Update(&shipment)
+	})
+	
+	// Record which units left on this shipment
+	for i, pickUnits := range units {
+		pick := picks[i]
+		shipped, warehouseID := pickUnits, *pick.WarehouseID
+		undo.add(func() error {
+			return uc.serialUseCase.UnshipUnits(shipped, warehouseID)
+		})
+		
+		err = uc.serialUseCase.ShipUnits(pickUnits, orderID, pick.OrderItemID, shipment.ShipmentID, 0)
+		if err != nil {
+			return undo.run(err)
+		}
+		
+		item := findOrderItem(ord, pick.OrderItemID)
+		item.SerialNumbers = append(item.SerialNumbers, pick.SerialNumbers...)
+	}
+	
+	// Mark shipment as shipped
+	shipment.MarkAsShipped()
+	
+	// Update shipment status
+	err = uc.shipmentRepo.Update(&shipment)
+	if err != nil {
+		return undo.run(err)
+	}
+	
+	// The order holds a copy of the shipment taken before it had an ID
+	ord.Shipments[len(ord.Shipments)-1] = shipment
+	
+	// Save updated order
+	err = uc.orderRepo.Update(ord)
+	if err != nil {
+		return undo.run(err)
+	}
+	
+	return nil
+}
+
+// moveReservation moves quantity of an item's reservation between warehouses, so the units
+// can ship from the warehouse they are picked in. Both steps are added to undo.
+func (uc *OrderUseCase) moveReservation(item *order.OrderItem, fromWarehouseID, toWarehouseID uint, quantity int, undo *rollback) error {
+	err := uc.inventoryUseCase.ReleaseReservedStock(item.ProductID, fromWarehouseID, item.VariantID, quantity, item.OrderID, item.OrderItemID, 0)
+	if err != nil {
+		return err
+	}
+	undo.add(uc.reserveAgain(item.ProductID, fromWarehouseID, item.VariantID, quantity, item.OrderID, item.OrderItemID, 0))
+	
+	err = uc.inventoryUseCase.ReserveStock(item.ProductID, toWarehouseID, item.VariantID, quantity, item.OrderID, item.OrderItemID, 0)
+	if err != nil {
+		return err
+	}
+	undo.add(func() error {
+		return uc.inventoryUseCase.ReleaseReservedStock(item.ProductID, toWarehouseID, item.VariantID, quantity, item.OrderID, item.OrderItemID, 0)
+	})
+	
+	return nil
+}
+
+// shipmentPicks checks that each pick of a warehouse shipment can leave now and fills in
+// the warehouse of picks that leave from where the item is reserved. Without picks every
+// item that can ship goes in full.
+func (uc *OrderUseCase) shipmentPicks(ord *order.Order, picks []ShipmentPick) ([]ShipmentPick, error) {
+	shipAll := len(picks) == 0
+	if shipAll {
+		for _, item := range ord.Items {
+			remaining := ord.RemainingQuantity(item.OrderItemID)
+			if remaining > 0 {
+				picks = append(picks, ShipmentPick{OrderItemID: item.OrderItemID, Quantity: remaining})
+			}
+		}
+	}
+	
+	checked := []ShipmentPick{}
+	picked := map[uint]int{}
+	for _, pick := range picks {
+		item := findOrderItem(ord, pick.OrderItemID)
+		if item == nil {
+			return nil, errors.New("shipment names items that are not on this order")
+		}
+		
+		// Items that cannot leave are skipped when shipping everything, and refused when named
+		reason := ""
+		switch {
+		case item.IsDropship:
+			reason = "dropship items are shipped by their supplier"
+		case item.IsBackordered:
+			reason = "item is still waiting on backorder"
+		case !item.IsReleased():
+			reason = "pre-order items cannot ship before their release date"
+		case !item.IsBundle() && item.WarehouseID == nil:
+			reason = "item has no stock reserved to ship"
+		case item.IsBundle() && pick.WarehouseID != nil:
+			reason = "bundles ship from where each component is reserved"
+		}
+		
+		if reason != "" {
+			if !shipAll {
+				return nil, errors.New(reason)
+			}
+			continue
+		}
+		
+		remaining := ord.RemainingQuantity(item.OrderItemID) - picked[item.OrderItemID]
+		if pick.Quantity <= 0 || pick.Quantity > remaining {
+			return nil, fmt.Errorf("can ship between 1 and %d of %s", remaining, item.SKU)
+		}
+		picked[item.OrderItemID] += pick.Quantity
+		
+		if pick.WarehouseID == nil {
+			pick.WarehouseID = item.WarehouseID
+		}
+		checked = append(checked, pick)
+	}
+	
+	// Dropship items arrive through RecordSupplierShipment instead
+	if len(checked) == 0 {
+		return nil, errors.New("order has no items to ship from our warehouses")
+	}
+	
+	return checked, nil
+}
+
+// MarkOrderDelivered marks an order as delivered
+func (uc *OrderUseCase) MarkOrderDelivered(orderID uint, staffID *uint) error {
+	// Find order
+	ord, err := uc.orderRepo.FindByID(orderID)
+	if err != nil {
+		return err
+	}
+	
+	if ord == nil {
+		return errors.New("order not found")
+	}
+	
+	// Verify order is in shipped status
+	if ord.Status != order.OrderStatusShipped {
+		return errors.New("can only mark shipped orders as delivered")
+	}
+	
+	// Update shipments status
+	for i := range ord.Shipments {
+		ord.Shipments[i].MarkAsDelivered()
+		
+		err = uc.shipmentRepo.Update(&ord.Shipments[i])
+		if err != nil {
+			return err
+		}
+	}
+	
+	// Update order status
+	err = ord.UpdateStatus(order.OrderStatusDelivered, "Order delivered", staffID)
+	if err != nil {
+		return err
+	}
+	
+	// Award loyalty points to customer (if applicable)
+	// This would be implemented based on business rules
+	
+	// Save updated order
+	return uc.orderRepo.Update(ord)
+}
+
+// MarkShipmentDelivered marks one shipment of an order as delivered. The order becomes
+// delivered with the last of its shipments once it has shipped in full.
+func (uc *OrderUseCase) MarkShipmentDelivered(shipmentID uint, staffID *uint) error {
+	shipment, err := uc.shipmentRepo.FindByID(shipmentID)
+	if err != nil {
+		return err
+	}
+	
+	if shipment == nil {
+		return errors.New("shipment not found")
+	}
+	
+	ord, err := uc.orderRepo.FindByID(shipment.OrderID)
+	if err != nil {
+		return err
+	}
+	
+	if ord == nil {
+		return errors.New("order not found")
+	}
+	
+	delivered, err := ord.DeliverShipment(shipmentID, staffID)
+	if err != nil {
+		return err
+	}
+	
+	err = uc.shipmentRepo.Update(delivered)
+	if err != nil {
+		return err
+	}
+	
+	return uc.orderRepo.Update(ord)
+}
+
+// CancelOrder cancels an order
+func (uc *OrderUseCase) CancelOrder(orderID uint, reason string, staffID *uint) error {
+	// Find order
+	ord, err := uc.orderRepo.FindByID(orderID)
+	if err != nil {
+		return err
+	}
+	
+	if ord == nil {
+		return errors.New("order not found")
+	}
+	
+	// Stock is only still reserved for what has not shipped yet
+	holdsReservations := ord.Status == order.OrderStatusPending || ord.IsShippable()
+	
+	// Cancel order
+	err = ord.Cancel(reason, staffID)
+	if err != nil {
+		return err
+	}
+	
+	// Released stock is reserved again if the cancellation fails, so that a retry finds
+	// the order as it was. Backorders, purchase orders and voids already cancelled are
+	// skipped by the retry, so those need no undoing.
+	var undo rollback
+	
+	// Release reserved inventory
+	if holdsReservations {
+		for _, item := range ord.Items {
+			unshipped := ord.RemainingQuantity(item.OrderItemID)
+			if unshipped == 0 {
+				continue
+			}
+			
+			err = uc.releaseComponentsWithUndo(item, unshipped, staffIDOrZero(staffID), &undo)
+			if err != nil {
+				return undo.run(err)
+			}
+			
+			if item.WarehouseID == nil {
+				continue
+			}
+			
+			err = uc.inventoryUseCase.ReleaseReservedStock(item.ProductID, *item.WarehouseID, item.VariantID, unshipped, orderID, item.OrderItemID, staffIDOrZero(staffID))
+			if err != nil {
+				return undo.run(err)
+			}
+			undo.add(uc.reserveAgain(item.ProductID, *item.WarehouseID, item.VariantID, unshipped, orderID, item.OrderItemID, staffIDOrZero(staffID)))
+		}
+		
+		// Items still on backorder give up their place in the queue
+		err = uc.backorderUseCase.CancelOrderBackorders(orderID)
+		if err != nil {
+			return undo.run(err)
+		}
+	}
+	
+	// Suppliers that have not shipped yet are told not to
+	err = uc.dropshipUseCase.CancelPurchaseOrders(ord, staffIDOrZero(staffID))
+	if err != nil {
+		return undo.run(err)
+	}
+	
+	// Money held but never taken goes back to the customer
+	authorization, err := uc.paymentUseCase.FindOpenAuthorization(orderID)
+	if err != nil {
+		return undo.run(err)
+	}
+	
+	if authorization != nil {
+		void, err := uc.paymentUseCase.Void(ord, authorization)
+		if err != nil {
+			return undo.run(err)
+		}
+		
+		if !void.IsPending() {
+			ord.UpdatePaymentStatus(order.PaymentStatusVoided)
+		}
+	}
+	
+	// Save updated order
+	err = uc.orderRepo.Update(ord)
+	if err != nil {
+		return undo.run(err)
+	}
+	
+	return nil
+}
+
+// CancelExpiredOrders cancels unpaid orders whose stock reservations have outlived their
+// time to live, giving the stock back for other customers. Every expired reservation is
+// dealt with, so the next run does not find it again: reservations of orders that are
+// paid for or being fulfilled are held, and those left behind by orders that are gone or
+// already cancelled are released. An order that cannot be dealt with does not stop the
+// sweep; its error is joined with the others' and returned with how many orders were
+// cancelled. It is meant to be run periodically.
+func (uc *OrderUseCase) CancelExpiredOrders(asOf time.Time) (int, error) {
+	expired, err := uc.inventoryUseCase.GetExpiredReservations(asOf)
+	if err != nil {
+		return 0, err
+	}
+	
+	orderIDs := []uint{}
+	byOrder := map[uint][]*invdomain.Reservation{}
+	for _, reservation := range expired {
+		if _, ok := byOrder[reservation.OrderID]; !ok {
+			orderIDs = append(orderIDs, reservation.OrderID)
+		}
+		byOrder[reservation.OrderID] = append(byOrder[reservation.OrderID], reservation)
+	}
+	
+	cancelled := 0
+	var errs []error
+	for _, orderID := range orderIDs {
+		ord, err := uc.orderRepo.FindByID(orderID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("order %d: %w", orderID, err))
+			continue
+		}
+		
+		switch {
+		case ord == nil || ord.Status == order.OrderStatusCancelled:
+			err = uc.releaseExpired(byOrder[orderID])
+		
+		// A payment that landed after the reservation lapsed still keeps the stock
+		case ord.PaymentStatus == order.PaymentStatusPaid || ord.PaymentStatus == order.PaymentStatusAuthorized:
+			err = uc.inventoryUseCase.HoldReservations(orderID)
+		
+		case ord.Status == order.OrderStatusPending:
+			err = uc.CancelOrder(orderID, "Reservation expired before payment", nil)
+			if err == nil {
+				cancelled++
+			}
+		
+		// Orders past pending without payment, such as cash on delivery, are being fulfilled
+		default:
+			err = uc.inventoryUseCase.HoldReservations(orderID)
+		}
+		
+		if err != nil {
+			errs = append(errs, fmt.Errorf("order %d: %w", orderID, err))
+		}
+	}
+	
+	return cancelled, errors.Join(errs...)
+}
+
+// releaseExpired gives back the stock of expired reservations whose order no longer needs it
+func (uc *OrderUseCase) releaseExpired(reservations []*invdomain.Reservation) error {
+	for _, reservation := range reservations {
+		err := uc.inventoryUseCase.ReleaseReservedStock(reservation.ProductID, reservation.WarehouseID, reservation.VariantID, reservation.Quantity, reservation.OrderID, reservation.OrderItemID, 0)
+		if err != nil {
+			return err
+		}
+	}
+	
+	return nil
+}
+
+// GenerateInvoice generates an invoice for an order
+func (uc *OrderUseCase) GenerateInvoice(orderID uint, staffID uint) (*order.Document, error) {
+	// Find order
+	ord, err := uc.orderRepo.FindByID(orderID)
+	if err != nil {
+		return nil, err
+	}
+	
+	if ord == nil {
+		return nil, errors.New("order not found")
+	}
+	
+	// Generate invoice document
+	document, err := uc.documentRepo.GenerateDocument(order.DocumentTypeInvoice, "order", orderID, staffID)
+	if err != nil {
+		return nil, err
+	}
+	
+	return document, nil
+}
+
+// GetOrderByID gets an order by ID
+func (uc *OrderUseCase) GetOrderByID(orderID uint) (*order.Order, error) {
+	return uc.orderRepo.FindByID(orderID)
+}
+
+// GetOrderByNumber gets an order by order number
+func (uc *OrderUseCase) GetOrderByNumber(orderNumber string) (*order.Order, error) {
+	return uc.orderRepo.FindByOrderNumber(orderNumber)
+}
+
+// GetOrdersByCustomer gets orders for a customer
+func (uc *OrderUseCase) GetOrdersByCustomer(customerID uint, page, limit int) ([]*order.Order, error) {
+	return uc.orderRepo.FindByCustomer(customerID, page, limit)
+}
+
+// GetOrdersByStatus gets orders by status
+func (uc *OrderUseCase) GetOrdersByStatus(status string, page, limit int) ([]*order.Order, error) {
+	var orderStatus order.OrderStatus
+	switch status {
+	case "pending":
+		orderStatus = order.OrderStatusPending
+	case "processing":
+		orderStatus = order.OrderStatusProcessing
+	case "partially_shipped":
+		orderStatus = order.OrderStatusPartiallyShipped
+	case "shipped":
+		orderStatus = order.OrderStatusShipped
+	case "delivered":
+		orderStatus = order.OrderStatusDelivered
+	case "cancelled":
+		orderStatus = order.OrderStatusCancelled
+	default:
+		return nil, errors.New("invalid order status")
+	}
+	
+	return uc.orderRepo.FindByStatus(orderStatus, page, limit)
+}
+
+// GetOrderMargin gets the gross margin of a shipped order
+func (uc *OrderUseCase) GetOrderMargin(orderID uint) (vo.Money, error) {
+	ord, err := uc.orderRepo.FindByID(orderID)
+	if err != nil {
+		return vo.Money{}, err
+	}
+	
+	if ord == nil {
+		return vo.Money{}, errors.New("order not found")
+	}
+	
+	return ord.GrossMargin()
+}
+
+// GetProductMargin gets the gross margin of a product across orders placed in a date range.
+// Only units that have shipped, and so carry a cost of goods, are included, each at its
+// share of the item's revenue.
+func (uc *OrderUseCase) GetProductMargin(productID uint, startDate, endDate time.Time) (*ProductMargin, error) {
+	const pageSize = 100
+	
+	revenue, _ := vo.NewMoney(0, "THB")
+	costOfGoods, _ := vo.NewMoney(0, "THB")
+	margin := &ProductMargin{ProductID: productID}
+	
+	for page := 1; ; page++ {
+		orders, err := uc.orderRepo.FindByDateRange(startDate, endDate, page, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		
+		for _, ord := range orders {
+			if ord.Status == order.OrderStatusCancelled {
+				continue
+			}
+			
+			for _, item := range ord.Items {
+				shipped := ord.ShippedQuantity(item.OrderItemID)
+				
+				// Units sold inside a bundle count at their share of the bundle's revenue
+				for _, component := range item.Components {
+					if component.ProductID != productID || component.CostOfGoods == nil {
+						continue
+					}
+					
+					share, err := item.ComponentRevenueFor(component, shipped)
+					if err != nil {
+						return nil, err
+					}
+					
+					revenue, err = revenue.Add(share)
+					if err != nil {
+						return nil, err
+					}
+					
+					costOfGoods, err = costOfGoods.Add(*component.CostOfGoods)
+					if err != nil {
+						return nil, err
+					}
+					
+					margin.QuantitySold += item.ComponentUnits(component, shipped)
+				}
+				
+				if item.ProductID != productID || item.CostOfGoods == nil {
+					continue
+				}
+				
+				share, err := item.RevenueFor(shipped)
+				if err != nil {
+					return nil, err
+				}
+				
+				revenue, err = revenue.Add(share)
+				if err != nil {
+					return nil, err
+				}
+				
+				costOfGoods, err = costOfGoods.Add(*item.CostOfGoods)
+				if err != nil {
+					return nil, err
+				}
+				
+				margin.QuantitySold += shipped
+			}
+		}
+		
+		if len(orders) < pageSize {
+			break
+		}
+	}
+	
+	grossMargin, err := revenue.Subtract(costOfGoods)
+	if err != nil {
+		return nil, err
+	}
+	
+	margin.Revenue = revenue
+	margin.CostOfGoods = costOfGoods
+	margin.GrossMargin = grossMargin
+	
+	return margin, nil
+}
+
+// GetBackInStockDate gets the date a quantity of an item can be promised at checkout,
+// or nil if neither stock nor confirmed purchase orders cover it
+func (uc *OrderUseCase) GetBackInStockDate(productID uint, variantID *uint, quantity int) (*time.Time, error) {
+	return uc.atpUseCase.GetAvailableDate(productID, variantID, quantity)
+}
+
+// insufficientStockError reports a shortfall as an *invdomain.InsufficientStockError, with
+// the back-in-stock date when one is known
+func (uc *OrderUseCase) insufficientStockError(productID uint, variantID *uint, quantity int, available int) error {
+	shortage := &invdomain.InsufficientStockError{
+		ProductID: productID,
+		VariantID: variantID,
+		Requested: quantity,
+		Available: max(available, 0),
+	}
+	
+	date, err := uc.atpUseCase.GetAvailableDate(productID, variantID, quantity)
+	if err != nil || date == nil {
+		return shortage
+	}
+	
+	return fmt.Errorf("%w, expected back in stock on %s", shortage, date.Format("2006-01-02"))
+}
+
+// shippingProvince resolves the province of the order's shipping address
+func (uc *OrderUseCase) shippingProvince(ord *order.Order) (string, error) {
+	address, err := uc.shippingAddress(ord)
+	if err != nil {
+		return "", err
+	}
+	
+	return address.Province, nil
+}
+
+// shippingAddress resolves the order's shipping address
+func (uc *OrderUseCase) shippingAddress(ord *order.Order) (vo.Address, error) {
+	if ord.ShippingAddress != nil {
+		return ord.ShippingAddress.Address, nil
+	}
+	
+	addresses, err := uc.customerRepo.FindAddressesByCustomerID(ord.CustomerID)
+	if err != nil {
+		return vo.Address{}, err
+	}
+	
+	for _, addr := range addresses {
+		if addr.AddressID == ord.ShippingAddressID {
+			return addr.Address, nil
+		}
+	}
+	
+	return vo.Address{}, errors.New("shipping address not found for this order")
+}
+
+// rollback collects the steps that undo a change made partway, to be run newest first
+// when a later step fails
+type rollback []func() error
+
+// add records how to undo a step that has been made
+func (r *rollback) add(undo func() error) {
+	*r = append(*r, undo)
+}
+
+// run undoes the steps made so far, newest first, and returns err together with
+// any undo that failed
+func (r rollback) run(err error) error {
+	for i := len(r) - 1; i >= 0; i-- {
+		err = errors.Join(err, r[i]())
+	}
+	return err
+}
+
+// staffIDOrZero returns the staff ID, or zero for system-initiated actions
+func staffIDOrZero(staffID *uint) uint {
+	if staffID == nil {
+		return 0
+	}
+	return *staffID
 }
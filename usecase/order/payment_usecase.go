@@ -0,0 +1,253 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common/vo"
+	"github.com/hydr0g3nz/ecom_mid/domain/order"
+)
+
+// PaymentUseCase moves money for orders through the gateway of their payment method,
+// recording every authorization, capture, void and refund as a transaction
+type PaymentUseCase struct {
+	paymentMethodRepo order.PaymentMethodRepository
+	transactionRepo   order.TransactionRepository
+	gateways          map[string]order.PaymentGateway
+}
+
+// NewPaymentUseCase creates a new PaymentUseCase.
+// gateways maps the gateway names payment methods use to their implementations.
+func NewPaymentUseCase(
+	paymentMethodRepo order.PaymentMethodRepository,
+	transactionRepo order.TransactionRepository,
+	gateways map[string]order.PaymentGateway,
+) *PaymentUseCase {
+	return &PaymentUseCase{
+		paymentMethodRepo: paymentMethodRepo,
+		transactionRepo:   transactionRepo,
+		gateways:          gateways,
+	}
+}
+
+// Authorize asks the gateway to hold the order's total. The transaction is recorded
+// whether or not the gateway approves it; a declined authorization is returned with an error.
+// Gateways that confirm later leave the transaction pending until their webhook arrives.
+// A sale is captured as soon as the gateway confirms the authorization.
+func (uc *PaymentUseCase) Authorize(ord *order.Order, sale bool) (*order.Transaction, error) {
+	gateway, err := uc.gatewayFor(ord.PaymentMethodID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := uc.idempotencyKey(ord.OrderID, order.TransactionTypeAuthorization, fmt.Sprintf("order-%d", ord.OrderID), func(*order.Transaction) bool {
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := gateway.Authorize(ord, ord.TotalAmount, key)
+	if err != nil {
+		return nil, err
+	}
+
+	transaction := order.NewGatewayTransaction(ord, ord.PaymentMethodID, order.TransactionTypeAuthorization, ord.TotalAmount, result, nil, nil)
+	transaction.IsSale = sale
+	return uc.save(transaction, result)
+}
+
+// Capture takes the money held by an authorization
+func (uc *PaymentUseCase) Capture(ord *order.Order, authorization *order.Transaction) (*order.Transaction, error) {
+	if authorization.Type != order.TransactionTypeAuthorization || authorization.Status != order.PaymentStatusAuthorized {
+		return nil, errors.New("can only capture approved authorizations")
+	}
+
+	gateway, err := uc.gatewayFor(authorization.PaymentMethodID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := uc.idempotencyKey(ord.OrderID, order.TransactionTypeCapture, authorizationSubject(authorization), settles(authorization))
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := gateway.Capture(authorization.GatewayTransactionID, authorization.Amount, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return uc.record(ord, order.TransactionTypeCapture, authorization.Amount, result, authorization, nil)
+}
+
+// Void releases the money held by an authorization that has not been captured
+func (uc *PaymentUseCase) Void(ord *order.Order, authorization *order.Transaction) (*order.Transaction, error) {
+	if authorization.Type != order.TransactionTypeAuthorization || authorization.Status != order.PaymentStatusAuthorized {
+		return nil, errors.New("can only void approved authorizations")
+	}
+
+	gateway, err := uc.gatewayFor(authorization.PaymentMethodID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := uc.idempotencyKey(ord.OrderID, order.TransactionTypeVoid, authorizationSubject(authorization), settles(authorization))
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := gateway.Void(authorization.GatewayTransactionID, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return uc.record(ord, order.TransactionTypeVoid, authorization.Amount, result, authorization, nil)
+}
+
+// Refund pays back a refund's amount of a captured payment
+func (uc *PaymentUseCase) Refund(ord *order.Order, capture *order.Transaction, refund *order.Refund) (*order.Transaction, error) {
+	gateway, err := uc.gatewayFor(capture.PaymentMethodID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := uc.idempotencyKey(ord.OrderID, order.TransactionTypeRefund, fmt.Sprintf("refund-%d", refund.RefundID), func(transaction *order.Transaction) bool {
+		return paysBack(transaction, refund)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := gateway.Refund(capture.GatewayTransactionID, refund.Amount, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return uc.record(ord, order.TransactionTypeRefund, refund.Amount, result, capture, &refund.RefundID)
+}
+
+// FindRefundPayment gets the gateway refund recorded for a refund that the gateway did
+// not decline, or nil when it has yet to be sent
+func (uc *PaymentUseCase) FindRefundPayment(refund *order.Refund) (*order.Transaction, error) {
+	transactions, err := uc.transactionRepo.FindByOrder(refund.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, transaction := range transactions {
+		if transaction.Type == order.TransactionTypeRefund && paysBack(transaction, refund) && !transaction.IsDeclined() {
+			return transaction, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// FindOpenAuthorization gets the order's authorization that has been neither
+// captured nor voided, or nil
+func (uc *PaymentUseCase) FindOpenAuthorization(orderID uint) (*order.Transaction, error) {
+	transactions, err := uc.transactionRepo.FindByOrder(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	return order.OpenAuthorization(transactions), nil
+}
+
+// GetOrderTransactions gets every payment step recorded for an order
+func (uc *PaymentUseCase) GetOrderTransactions(orderID uint) ([]*order.Transaction, error) {
+	return uc.transactionRepo.FindByOrder(orderID)
+}
+
+// record saves a payment step and reports a declined step as an error
+func (uc *PaymentUseCase) record(
+	ord *order.Order,
+	transactionType order.TransactionType,
+	amount vo.Money,
+	result order.GatewayResult,
+	parent *order.Transaction,
+	refundID *uint,
+) (*order.Transaction, error) {
+	paymentMethodID := ord.PaymentMethodID
+	if parent != nil {
+		paymentMethodID = parent.PaymentMethodID
+	}
+
+	transaction := order.NewGatewayTransaction(ord, paymentMethodID, transactionType, amount, result, parent, refundID)
+	return uc.save(transaction, result)
+}
+
+// save saves a payment step built from the gateway's answer and reports a declined step as an error
+func (uc *PaymentUseCase) save(transaction *order.Transaction, result order.GatewayResult) (*order.Transaction, error) {
+	err := uc.transactionRepo.Create(transaction)
+	if err != nil {
+		return nil, err
+	}
+
+	if transaction.IsDeclined() {
+		return transaction, fmt.Errorf("payment gateway declined the %s: %s", transaction.Type, result.Response)
+	}
+
+	return transaction, nil
+}
+
+// idempotencyKey names a step of an order's payment on subject for the gateway. A step
+// sent again after a failure gets the same key, so the gateway does not act on it twice,
+// while each try after the gateway declined the step, as matched by tried, gets a new one.
+func (uc *PaymentUseCase) idempotencyKey(
+	orderID uint,
+	transactionType order.TransactionType,
+	subject string,
+	tried func(*order.Transaction) bool,
+) (string, error) {
+	transactions, err := uc.transactionRepo.FindByOrder(orderID)
+	if err != nil {
+		return "", err
+	}
+
+	attempt := 1
+	for _, transaction := range transactions {
+		if transaction.Type == transactionType && transaction.IsDeclined() && tried(transaction) {
+			attempt++
+		}
+	}
+
+	return fmt.Sprintf("%s-%s-%d", subject, transactionType, attempt), nil
+}
+
+// authorizationSubject names an authorization in the idempotency keys of the steps settling it
+func authorizationSubject(authorization *order.Transaction) string {
+	return fmt.Sprintf("authorization-%d", authorization.TransactionID)
+}
+
+// settles matches the transactions that act on an authorization
+func settles(authorization *order.Transaction) func(*order.Transaction) bool {
+	return func(transaction *order.Transaction) bool {
+		return transaction.ParentTransactionID != nil && *transaction.ParentTransactionID == authorization.TransactionID
+	}
+}
+
+// paysBack checks if a transaction is the gateway's refund of a refund
+func paysBack(transaction *order.Transaction, refund *order.Refund) bool {
+	return transaction.RefundID != nil && *transaction.RefundID == refund.RefundID
+}
+
+// gatewayFor finds the gateway that takes payments for a payment method
+func (uc *PaymentUseCase) gatewayFor(paymentMethodID uint) (order.PaymentGateway, error) {
+	paymentMethod, err := uc.paymentMethodRepo.FindByID(paymentMethodID)
+	if err != nil {
+		return nil, err
+	}
+
+	if paymentMethod == nil {
+		return nil, errors.New("payment method not found")
+	}
+
+	gateway, ok := uc.gateways[paymentMethod.Gateway]
+	if !ok {
+		return nil, fmt.Errorf("no payment gateway configured for %s", paymentMethod.Name)
+	}
+
+	return gateway, nil
+}
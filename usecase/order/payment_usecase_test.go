@@ -0,0 +1,163 @@
+package order
+
+import (
+	"testing"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common/vo"
+	"github.com/hydr0g3nz/ecom_mid/domain/order"
+)
+
+func TestAuthorizeAndCaptureTakeTheOrderTotal(t *testing.T) {
+	f := newPaymentFixture(250)
+	ord := f.order()
+
+	authorization, err := f.payments.Authorize(ord, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if authorization.Status != order.PaymentStatusAuthorized {
+		t.Fatalf("authorization is %s, want authorized", authorization.Status)
+	}
+
+	capture, err := f.payments.Capture(ord, authorization)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if capture.Status != order.PaymentStatusPaid || capture.Amount.Amount != 250 {
+		t.Fatalf("capture is %s for %.2f, want paid for 250.00", capture.Status, capture.Amount.Amount)
+	}
+
+	if capture.ParentTransactionID == nil || *capture.ParentTransactionID != authorization.TransactionID {
+		t.Fatal("capture is not linked to the authorization it settles")
+	}
+
+	if captured := f.gateway.Captured(authorization.GatewayTransactionID); captured.Amount != 250 {
+		t.Fatalf("gateway captured %.2f, want 250.00", captured.Amount)
+	}
+}
+
+func TestVoidReleasesAnAuthorizationSoItCannotBeCaptured(t *testing.T) {
+	f := newPaymentFixture(100)
+	ord := f.order()
+
+	authorization, err := f.payments.Authorize(ord, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	void, err := f.payments.Void(ord, authorization)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if void.Status != order.PaymentStatusVoided {
+		t.Fatalf("void is %s, want voided", void.Status)
+	}
+
+	open, err := f.payments.FindOpenAuthorization(testOrderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if open != nil {
+		t.Fatal("voided authorization is still open")
+	}
+
+	capture, err := f.payments.Capture(ord, authorization)
+	if err == nil {
+		t.Fatal("captured a voided authorization")
+	}
+
+	if capture == nil || !capture.IsDeclined() {
+		t.Fatal("declined capture was not recorded")
+	}
+}
+
+func TestAuthorizationAboveTheLimitIsDeclined(t *testing.T) {
+	f := newPaymentFixture(1000)
+	f.gateway.DeclineAbove = &vo.Money{Amount: 500, Currency: "THB"}
+
+	authorization, err := f.payments.Authorize(f.order(), false)
+	if err == nil {
+		t.Fatal("authorization above the limit was approved")
+	}
+
+	if authorization == nil || !authorization.IsDeclined() {
+		t.Fatal("declined authorization was not recorded")
+	}
+}
+
+func TestRefundsStayWithinTheCapturedAmount(t *testing.T) {
+	f := newPaymentFixture(300)
+
+	capture, err := f.capture()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := &order.Refund{RefundID: 1, OrderID: testOrderID, Amount: vo.Money{Amount: 200, Currency: "THB"}}
+	refund, err := f.payments.Refund(f.order(), capture, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if refund.Status != order.PaymentStatusRefunded || refund.RefundID == nil || *refund.RefundID != first.RefundID {
+		t.Fatal("refund was not recorded against the refund it pays back")
+	}
+
+	second := &order.Refund{RefundID: 2, OrderID: testOrderID, Amount: vo.Money{Amount: 150, Currency: "THB"}}
+	_, err = f.payments.Refund(f.order(), capture, second)
+	if err == nil {
+		t.Fatal("refunded more than was captured")
+	}
+
+	if refunded := f.gateway.Refunded(capture.GatewayTransactionID); refunded.Amount != 200 {
+		t.Fatalf("gateway refunded %.2f, want 200.00", refunded.Amount)
+	}
+}
+
+func TestAuthorizationSentAgainAfterASaveFailureHoldsTheMoneyOnce(t *testing.T) {
+	f := newPaymentFixture(120)
+	ord := f.order()
+
+	f.transactions.failNextCreate = true
+	_, err := f.payments.Authorize(ord, false)
+	if err == nil {
+		t.Fatal("authorization succeeded without being recorded")
+	}
+
+	authorization, err := f.payments.Authorize(ord, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.gateway.Requests() != 1 {
+		t.Fatalf("gateway handled %d authorizations, want 1", f.gateway.Requests())
+	}
+
+	if authorization.Status != order.PaymentStatusAuthorized {
+		t.Fatalf("authorization is %s, want authorized", authorization.Status)
+	}
+}
+
+func TestDeclinedAuthorizationCanBeTriedAgain(t *testing.T) {
+	f := newPaymentFixture(800)
+	f.gateway.DeclineAbove = &vo.Money{Amount: 500, Currency: "THB"}
+
+	_, err := f.payments.Authorize(f.order(), false)
+	if err == nil {
+		t.Fatal("authorization above the limit was approved")
+	}
+
+	f.gateway.DeclineAbove = nil
+	authorization, err := f.payments.Authorize(f.order(), false)
+	if err != nil {
+		t.Fatalf("second try was answered with the first decline: %v", err)
+	}
+
+	if authorization.Status != order.PaymentStatusAuthorized {
+		t.Fatalf("authorization is %s, want authorized", authorization.Status)
+	}
+}
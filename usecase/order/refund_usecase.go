@@ -0,0 +1,568 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common/vo"
+	"github.com/hydr0g3nz/ecom_mid/domain/order"
+	"github.com/hydr0g3nz/ecom_mid/domain/user"
+)
+
+// RefundUseCase contains the business logic for refunds
+type RefundUseCase struct {
+	refundRepo      order.RefundRepository
+	unitOfWork      order.RefundUnitOfWork
+	transactionRepo order.TransactionRepository
+	orderRepo       order.OrderRepository
+	staffRepo       user.StaffRepository
+	paymentUseCase  *PaymentUseCase
+	approvalLimit   *vo.Money
+}
+
+// NewRefundUseCase creates a new RefundUseCase.
+// Refunds against a payment are checked against what is left to refund and saved in one
+// unitOfWork, so refunds issued together cannot overrun it.
+// Refunds above approvalLimit wait for a staff member holding
+// order.PermissionApproveRefund, other than the one who issued them, to approve them;
+// pass nil to process every refund straight away. Refunds in another currency than
+// approvalLimit are turned away.
+func NewRefundUseCase(
+	refundRepo order.RefundRepository,
+	unitOfWork order.RefundUnitOfWork,
+	transactionRepo order.TransactionRepository,
+	orderRepo order.OrderRepository,
+	staffRepo user.StaffRepository,
+	paymentUseCase *PaymentUseCase,
+	approvalLimit *vo.Money,
+) *RefundUseCase {
+	return &RefundUseCase{
+		refundRepo:      refundRepo,
+		unitOfWork:      unitOfWork,
+		transactionRepo: transactionRepo,
+		orderRepo:       orderRepo,
+		staffRepo:       staffRepo,
+		paymentUseCase:  paymentUseCase,
+		approvalLimit:   approvalLimit,
+	}
+}
+
+// IssueRefund refunds an amount of goods against a transaction. With includeShipping the
+// order's shipping fee not yet refunded is added; with includeTax the tax charged on the
+// goods is added. The total may not exceed what was captured less earlier refunds.
+// Refunds within the approval limit are processed at once, larger ones stay pending,
+// as do refunds the gateway confirms later. A refund the gateway declines is marked
+// failed and no longer counts against what is left to refund.
+func (uc *RefundUseCase) IssueRefund(
+	transactionID uint,
+	amount vo.Money,
+	includeShipping bool,
+	includeTax bool,
+	reason string,
+	returnID *uint,
+	staffID uint,
+) (*order.Refund, error) {
+	transaction, err := uc.findTransaction(transactionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isRefundable(transaction.Status) {
+		return nil, errors.New("only paid transactions can be refunded")
+	}
+
+	ord, err := uc.findOrder(transaction.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Refunds against the transaction are checked and saved one at a time, so two refunds
+	// issued together cannot both take what is left to refund
+	var refund *order.Refund
+	var held bool
+	err = uc.unitOfWork.Do(transaction.TransactionID, func(refunds order.RefundRepository) error {
+		var err error
+		refund, err = uc.newRefund(refunds, transaction, ord, amount, includeShipping, includeTax, reason, returnID, staffID)
+		if err != nil {
+			return err
+		}
+
+		held, err = uc.requiresApproval(refund)
+		if err != nil {
+			return err
+		}
+
+		return refunds.Create(refund)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Large refunds wait for approval
+	if held {
+		return refund, nil
+	}
+
+	err = uc.process(refund, transaction, ord, staffID, "Refund issued")
+	if err != nil {
+		return nil, err
+	}
+
+	return refund, nil
+}
+
+// newRefund builds a refund against a transaction, reading the refunds already issued
+// through refunds, and checks it fits in what is left to refund
+func (uc *RefundUseCase) newRefund(
+	refunds order.RefundRepository,
+	transaction *order.Transaction,
+	ord *order.Order,
+	amount vo.Money,
+	includeShipping bool,
+	includeTax bool,
+	reason string,
+	returnID *uint,
+	staffID uint,
+) (*order.Refund, error) {
+	orderRefunds, err := refunds.FindByOrder(ord.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	shipping, err := vo.NewMoney(0, amount.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	if includeShipping {
+		shipping, err = uc.refundableShipping(ord, orderRefunds)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tax, err := vo.NewMoney(0, amount.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	if includeTax {
+		tax, err = uc.taxOn(ord, orderRefunds, amount)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	refund, err := order.NewRefund(transaction, amount, shipping, tax, reason, returnID, staffID)
+	if err != nil {
+		return nil, err
+	}
+
+	refundable, err := uc.refundableAmount(refunds, transaction)
+	if err != nil {
+		return nil, err
+	}
+
+	if refund.Amount.Amount > refundable.Amount {
+		return nil, fmt.Errorf("refund of %.2f exceeds the %.2f left to refund on this transaction", refund.Amount.Amount, refundable.Amount)
+	}
+
+	return refund, nil
+}
+
+// RetryRefund pays back a pending refund within the approval limit again, such as one that
+// could not be saved once the gateway paid it. The staff member who issued it may retry it;
+// refunds held for approval are paid back through ApproveRefund instead.
+func (uc *RefundUseCase) RetryRefund(refundID uint, staffID uint) error {
+	refund, err := uc.findRefund(refundID)
+	if err != nil {
+		return err
+	}
+
+	held, err := uc.requiresApproval(refund)
+	if err != nil {
+		return err
+	}
+
+	if held {
+		return errors.New("refund is waiting for approval")
+	}
+
+	transaction, err := uc.findTransaction(refund.TransactionID)
+	if err != nil {
+		return err
+	}
+
+	ord, err := uc.findOrder(refund.OrderID)
+	if err != nil {
+		return err
+	}
+
+	return uc.process(refund, transaction, ord, staffID, "Refund issued")
+}
+
+// ApproveRefund approves a pending refund and pays it back
+func (uc *RefundUseCase) ApproveRefund(refundID uint, staffID uint, notes string) error {
+	refund, err := uc.findRefund(refundID)
+	if err != nil {
+		return err
+	}
+
+	err = uc.checkApprover(refund, staffID)
+	if err != nil {
+		return err
+	}
+
+	transaction, err := uc.findTransaction(refund.TransactionID)
+	if err != nil {
+		return err
+	}
+
+	ord, err := uc.findOrder(refund.OrderID)
+	if err != nil {
+		return err
+	}
+
+	return uc.process(refund, transaction, ord, staffID, notes)
+}
+
+// RejectRefund turns down a pending refund
+func (uc *RefundUseCase) RejectRefund(refundID uint, staffID uint, notes string) error {
+	refund, err := uc.findRefund(refundID)
+	if err != nil {
+		return err
+	}
+
+	err = uc.checkApprover(refund, staffID)
+	if err != nil {
+		return err
+	}
+
+	err = refund.Reject(staffID, notes)
+	if err != nil {
+		return err
+	}
+
+	return uc.refundRepo.ProcessRefund(refund.RefundID, refund.Status, staffID, notes)
+}
+
+// FindRefundableTransaction gets the transaction that paid for an order and can still be refunded
+func (uc *RefundUseCase) FindRefundableTransaction(orderID uint) (*order.Transaction, error) {
+	transactions, err := uc.transactionRepo.FindByOrder(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, transaction := range transactions {
+		if isRefundable(transaction.Status) {
+			return transaction, nil
+		}
+	}
+
+	return nil, errors.New("order has no paid transaction to refund")
+}
+
+// FindReturnRefund gets the refund issued for a return of an order that was not rejected or declined, if any
+func (uc *RefundUseCase) FindReturnRefund(orderID, returnID uint) (*order.Refund, error) {
+	refunds, err := uc.refundRepo.FindByOrder(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, refund := range refunds {
+		if refund.ReturnID != nil && *refund.ReturnID == returnID && !refund.IsTurnedDown() {
+			return refund, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// GetRefundableAmount gets what is left to refund on a transaction
+func (uc *RefundUseCase) GetRefundableAmount(transactionID uint) (vo.Money, error) {
+	transaction, err := uc.findTransaction(transactionID)
+	if err != nil {
+		return vo.Money{}, err
+	}
+
+	return uc.refundableAmount(uc.refundRepo, transaction)
+}
+
+// GetOrderRefunds gets the refunds issued for an order
+func (uc *RefundUseCase) GetOrderRefunds(orderID uint) ([]*order.Refund, error) {
+	return uc.refundRepo.FindByOrder(orderID)
+}
+
+// GetPendingRefunds gets the refunds waiting for approval
+func (uc *RefundUseCase) GetPendingRefunds() ([]*order.Refund, error) {
+	return uc.refundRepo.FindByStatus(order.RefundStatusPending)
+}
+
+// ApplyRefundStatus settles a refund once the gateway reports the outcome of paying it
+// back, such as through a webhook. A confirmed refund is processed; a declined one is
+// marked failed.
+func (uc *RefundUseCase) ApplyRefundStatus(payment *order.Transaction) error {
+	if payment.Type != order.TransactionTypeRefund || payment.RefundID == nil {
+		return errors.New("transaction is not a gateway refund")
+	}
+
+	refund, err := uc.findRefund(*payment.RefundID)
+	if err != nil {
+		return err
+	}
+
+	// Repeated reports find the refund already settled
+	if !refund.IsPending() {
+		return nil
+	}
+
+	if payment.IsDeclined() {
+		return uc.fail(refund, 0, "Refund declined by the payment gateway")
+	}
+
+	if payment.Status != order.PaymentStatusRefunded {
+		return nil
+	}
+
+	transaction, err := uc.findTransaction(refund.TransactionID)
+	if err != nil {
+		return err
+	}
+
+	ord, err := uc.findOrder(refund.OrderID)
+	if err != nil {
+		return err
+	}
+
+	return uc.complete(refund, transaction, ord, 0, "Refund confirmed by the payment gateway")
+}
+
+// process pays back a pending refund through the payment gateway. A refund the gateway
+// declines is marked failed; one the gateway confirms later stays pending until
+// ApplyRefundStatus hears back. The gateway's refund is recorded before the refund is marked processed,
+// so processing it again after a failure does not pay it back twice.
+func (uc *RefundUseCase) process(refund *order.Refund, transaction *order.Transaction, ord *order.Order, staffID uint, notes string) error {
+	if !refund.IsPending() {
+		return errors.New("can only process pending refunds")
+	}
+
+	payment, err := uc.paymentUseCase.FindRefundPayment(refund)
+	if err != nil {
+		return err
+	}
+
+	if payment == nil {
+		payment, err = uc.paymentUseCase.Refund(ord, transaction, refund)
+		if payment != nil && payment.IsDeclined() {
+			return errors.Join(err, uc.fail(refund, staffID, payment.GatewayResponse))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if payment.IsPending() {
+		return nil
+	}
+
+	return uc.complete(refund, transaction, ord, staffID, notes)
+}
+
+// complete marks a refund the gateway paid back processed and moves the transaction
+// and order to refunded or partially refunded
+func (uc *RefundUseCase) complete(refund *order.Refund, transaction *order.Transaction, ord *order.Order, staffID uint, notes string) error {
+	err := refund.Process(staffID, notes)
+	if err != nil {
+		return err
+	}
+
+	err = uc.refundRepo.ProcessRefund(refund.RefundID, refund.Status, staffID, notes)
+	if err != nil {
+		return err
+	}
+
+	transactionRefunds, err := uc.refundRepo.FindByTransaction(transaction.TransactionID)
+	if err != nil {
+		return err
+	}
+
+	refunded, err := order.ProcessedRefundAmount(transactionRefunds, transaction.Amount.Currency)
+	if err != nil {
+		return err
+	}
+
+	transaction.Status = order.PaymentStatusAfterRefunds(transaction.Amount, refunded)
+	err = uc.transactionRepo.Update(transaction)
+	if err != nil {
+		return err
+	}
+
+	orderRefunds, err := uc.refundRepo.FindByOrder(ord.OrderID)
+	if err != nil {
+		return err
+	}
+
+	refunded, err = order.ProcessedRefundAmount(orderRefunds, ord.TotalAmount.Currency)
+	if err != nil {
+		return err
+	}
+
+	ord.UpdatePaymentStatus(order.PaymentStatusAfterRefunds(ord.TotalAmount, refunded))
+	return uc.orderRepo.Update(ord)
+}
+
+// fail marks a refund the gateway declined failed
+func (uc *RefundUseCase) fail(refund *order.Refund, staffID uint, notes string) error {
+	err := refund.Fail(staffID, notes)
+	if err != nil {
+		return err
+	}
+
+	return uc.refundRepo.ProcessRefund(refund.RefundID, refund.Status, staffID, notes)
+}
+
+// requiresApproval checks if a refund is above the approval limit and must wait for approval
+func (uc *RefundUseCase) requiresApproval(refund *order.Refund) (bool, error) {
+	if uc.approvalLimit == nil {
+		return false, nil
+	}
+
+	if refund.Amount.Currency != uc.approvalLimit.Currency {
+		return false, fmt.Errorf("refund is in %s but the approval limit is in %s", refund.Amount.Currency, uc.approvalLimit.Currency)
+	}
+
+	return refund.Amount.Amount > uc.approvalLimit.Amount, nil
+}
+
+// checkApprover verifies a staff member is active, allowed to decide refunds held for
+// approval and not the one who requested this refund
+func (uc *RefundUseCase) checkApprover(refund *order.Refund, staffID uint) error {
+	staff, err := uc.staffRepo.FindByID(staffID)
+	if err != nil {
+		return err
+	}
+
+	if staff == nil || !staff.IsActive() {
+		return errors.New("staff not found or inactive")
+	}
+
+	if !staff.HasPermission(order.PermissionApproveRefund) {
+		return errors.New("staff is not allowed to approve refunds")
+	}
+
+	return refund.CheckApprover(staffID)
+}
+
+// refundableAmount works out what was captured on a transaction less the refunds
+// processed or waiting for approval against it, read through refundRepo
+func (uc *RefundUseCase) refundableAmount(refundRepo order.RefundRepository, transaction *order.Transaction) (vo.Money, error) {
+	refunds, err := refundRepo.FindByTransaction(transaction.TransactionID)
+	if err != nil {
+		return vo.Money{}, err
+	}
+
+	refunded, err := order.RefundedAmount(refunds, transaction.Amount.Currency)
+	if err != nil {
+		return vo.Money{}, err
+	}
+
+	return transaction.Amount.Subtract(refunded)
+}
+
+// refundableShipping works out the order's shipping fee not already refunded
+func (uc *RefundUseCase) refundableShipping(ord *order.Order, refunds []*order.Refund) (vo.Money, error) {
+	remaining := ord.ShippingFee
+	for _, refund := range refunds {
+		if refund.IsTurnedDown() {
+			continue
+		}
+
+		var err error
+		remaining, err = remaining.Subtract(refund.ShippingAmount)
+		if err != nil {
+			return vo.Money{}, err
+		}
+	}
+
+	if remaining.IsNegative() {
+		return vo.NewMoney(0, remaining.Currency)
+	}
+	return remaining, nil
+}
+
+// taxOn works out the tax charged on an amount of the order's goods, at the order's
+// overall rate and never more than the tax not already refunded
+func (uc *RefundUseCase) taxOn(ord *order.Order, refunds []*order.Refund, amount vo.Money) (vo.Money, error) {
+	if !ord.Subtotal.IsPositive() || !ord.TaxAmount.IsPositive() {
+		return vo.NewMoney(0, amount.Currency)
+	}
+
+	tax, err := ord.TaxAmount.Multiply(amount.Amount / ord.Subtotal.Amount)
+	if err != nil {
+		return vo.Money{}, err
+	}
+
+	remaining := ord.TaxAmount
+	for _, refund := range refunds {
+		if refund.IsTurnedDown() {
+			continue
+		}
+
+		remaining, err = remaining.Subtract(refund.TaxAmount)
+		if err != nil {
+			return vo.Money{}, err
+		}
+	}
+
+	if tax.Amount > remaining.Amount {
+		return vo.NewMoney(max(remaining.Amount, 0), remaining.Currency)
+	}
+	return tax, nil
+}
+
+// findTransaction loads an existing transaction
+func (uc *RefundUseCase) findTransaction(transactionID uint) (*order.Transaction, error) {
+	transaction, err := uc.transactionRepo.FindByID(transactionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if transaction == nil {
+		return nil, errors.New("transaction not found")
+	}
+
+	return transaction, nil
+}
+
+// findRefund loads an existing refund
+func (uc *RefundUseCase) findRefund(refundID uint) (*order.Refund, error) {
+	refund, err := uc.refundRepo.FindByID(refundID)
+	if err != nil {
+		return nil, err
+	}
+
+	if refund == nil {
+		return nil, errors.New("refund not found")
+	}
+
+	return refund, nil
+}
+
+// findOrder loads an existing order
+func (uc *RefundUseCase) findOrder(orderID uint) (*order.Order, error) {
+	ord, err := uc.orderRepo.FindByID(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if ord == nil {
+		return nil, errors.New("order not found")
+	}
+
+	return ord, nil
+}
+
+// isRefundable checks if a transaction in a payment status still holds money to refund
+func isRefundable(status order.PaymentStatus) bool {
+	return status == order.PaymentStatusPaid || status == order.PaymentStatusPartiallyRefunded
+}
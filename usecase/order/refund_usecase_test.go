@@ -0,0 +1,152 @@
+package order
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common/vo"
+	"github.com/hydr0g3nz/ecom_mid/domain/order"
+)
+
+func TestRefundProcessedAgainAfterASaveFailurePaysBackOnce(t *testing.T) {
+	f := newPaymentFixture(400)
+
+	capture, err := f.capture()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.refunds.failNextProcess = true
+	_, err = f.refundsUC.IssueRefund(capture.TransactionID, vo.Money{Amount: 100, Currency: "THB"}, false, false, "Damaged", nil, testStaffID)
+	if err == nil {
+		t.Fatal("refund succeeded without being saved")
+	}
+
+	err = f.refundsUC.RetryRefund(1, testStaffID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.transactions.count(order.TransactionTypeRefund) != 1 {
+		t.Fatalf("recorded %d gateway refunds, want 1", f.transactions.count(order.TransactionTypeRefund))
+	}
+
+	if refunded := f.gateway.Refunded(capture.GatewayTransactionID); refunded.Amount != 100 {
+		t.Fatalf("gateway refunded %.2f, want 100.00", refunded.Amount)
+	}
+
+	refund, err := f.refunds.FindByID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if refund.Status != order.RefundStatusProcessed {
+		t.Fatalf("refund is %s, want processed", refund.Status)
+	}
+
+	if f.order().PaymentStatus != order.PaymentStatusPartiallyRefunded {
+		t.Fatalf("order is %s, want partially refunded", f.order().PaymentStatus)
+	}
+}
+
+func TestRefundCannotBeApprovedByItsRequester(t *testing.T) {
+	f := newPaymentFixture(400)
+	f.refundsUC.approvalLimit = &vo.Money{Amount: 50, Currency: "THB"}
+
+	capture, err := f.capture()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refund, err := f.refundsUC.IssueRefund(capture.TransactionID, vo.Money{Amount: 100, Currency: "THB"}, false, false, "Damaged", nil, testStaffID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !refund.IsPending() {
+		t.Fatal("refund above the approval limit was not held for approval")
+	}
+
+	err = f.refundsUC.ApproveRefund(refund.RefundID, testStaffID, "Approved")
+	if err == nil {
+		t.Fatal("requester approved their own refund")
+	}
+
+	err = f.refundsUC.ApproveRefund(refund.RefundID, testApproverID, "Approved")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRefundDeclinedByTheGatewayNoLongerCountsAgainstTheCapture(t *testing.T) {
+	f := newPaymentFixture(400)
+
+	capture, err := f.capture()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Money paid back outside the shop leaves the gateway nothing to refund
+	_, err = f.gateway.Refund(capture.GatewayTransactionID, vo.Money{Amount: 400, Currency: "THB"}, "outside")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = f.refundsUC.IssueRefund(capture.TransactionID, vo.Money{Amount: 100, Currency: "THB"}, false, false, "Damaged", nil, testStaffID)
+	if err == nil {
+		t.Fatal("refund succeeded although the gateway declined it")
+	}
+
+	refund, err := f.refunds.FindByID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if refund.Status != order.RefundStatusFailed {
+		t.Fatalf("refund is %s, want failed", refund.Status)
+	}
+
+	refundable, err := f.refundsUC.GetRefundableAmount(capture.TransactionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if refundable.Amount != 400 {
+		t.Fatalf("%.2f left to refund, want the full 400.00", refundable.Amount)
+	}
+}
+
+func TestRefundsIssuedTogetherNeverExceedTheCapture(t *testing.T) {
+	const attempts = 20
+
+	f := newPaymentFixture(400)
+
+	capture, err := f.capture()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var issued atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := f.refundsUC.IssueRefund(capture.TransactionID, vo.Money{Amount: 100, Currency: "THB"}, false, false, "Damaged", nil, testStaffID)
+			if err == nil {
+				issued.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if issued.Load() != 4 {
+		t.Fatalf("issued %d refunds of 100.00, want the 4 the 400.00 capture covers", issued.Load())
+	}
+
+	if refunded := f.gateway.Refunded(capture.GatewayTransactionID); refunded.Amount != 400 {
+		t.Fatalf("gateway refunded %.2f, want 400.00", refunded.Amount)
+	}
+}
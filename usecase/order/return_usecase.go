@@ -0,0 +1,519 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common/vo"
+	invdomain "github.com/hydr0g3nz/ecom_mid/domain/inventory"
+	"github.com/hydr0g3nz/ecom_mid/domain/order"
+	"github.com/hydr0g3nz/ecom_mid/domain/user"
+	"github.com/hydr0g3nz/ecom_mid/usecase/inventory"
+)
+
+// ReturnLine is a quantity of one order item a customer asks to return
+type ReturnLine struct {
+	OrderItemID uint               `json:"order_item_id"`
+	Quantity    int                `json:"quantity"`
+	Reason      order.ReturnReason `json:"reason"`
+	Notes       string             `json:"notes"`
+}
+
+// ReturnUseCase contains the business logic for returns (RMAs)
+type ReturnUseCase struct {
+	returnRepo       order.ReturnRequestRepository
+	orderRepo        order.OrderRepository
+	storeCreditRepo  user.StoreCreditRepository
+	refundUseCase    *RefundUseCase
+	inventoryUseCase *inventory.InventoryUseCase
+	locationUseCase  *inventory.LocationUseCase
+	serialUseCase    *inventory.SerialUseCase
+}
+
+// NewReturnUseCase creates a new ReturnUseCase
+func NewReturnUseCase(
+	returnRepo order.ReturnRequestRepository,
+	orderRepo order.OrderRepository,
+	storeCreditRepo user.StoreCreditRepository,
+	refundUseCase *RefundUseCase,
+	inventoryUseCase *inventory.InventoryUseCase,
+	locationUseCase *inventory.LocationUseCase,
+	serialUseCase *inventory.SerialUseCase,
+) *ReturnUseCase {
+	return &ReturnUseCase{
+		returnRepo:       returnRepo,
+		orderRepo:        orderRepo,
+		storeCreditRepo:  storeCreditRepo,
+		refundUseCase:    refundUseCase,
+		inventoryUseCase: inventoryUseCase,
+		locationUseCase:  locationUseCase,
+		serialUseCase:    serialUseCase,
+	}
+}
+
+// RequestReturn opens a return for items of a delivered order. Each item can be returned
+// up to the quantity shipped, less what is already on other returns that were not rejected.
+func (uc *ReturnUseCase) RequestReturn(
+	orderID uint,
+	refundMethod order.RefundMethod,
+	lines []ReturnLine,
+	notes string,
+) (*order.ReturnRequest, error) {
+	ord, err := uc.findOrder(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := uc.returnRepo.FindByOrder(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	returnRequest, err := order.NewReturnRequest(ord, len(existing)+1, refundMethod, notes)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range lines {
+		item := findOrderItem(ord, line.OrderItemID)
+		if item == nil {
+			return nil, errors.New("item not found on this order")
+		}
+
+		returnable := ord.ShippedQuantity(item.OrderItemID) - order.ReturnedQuantity(existing, item.OrderItemID)
+		err = returnRequest.AddItem(*item, line.Quantity, returnable, line.Reason, line.Notes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(returnRequest.Items) == 0 {
+		return nil, errors.New("return must include at least one item")
+	}
+
+	err = uc.returnRepo.Create(returnRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	return returnRequest, nil
+}
+
+// ApproveReturn accepts a return so the customer can send the items back
+func (uc *ReturnUseCase) ApproveReturn(returnID uint, staffID uint) error {
+	returnRequest, err := uc.findReturn(returnID)
+	if err != nil {
+		return err
+	}
+
+	err = returnRequest.Approve(staffID)
+	if err != nil {
+		return err
+	}
+
+	return uc.returnRepo.Update(returnRequest)
+}
+
+// RejectReturn turns a return down before the items come back
+func (uc *ReturnUseCase) RejectReturn(returnID uint, reason string) error {
+	returnRequest, err := uc.findReturn(returnID)
+	if err != nil {
+		return err
+	}
+
+	err = returnRequest.Reject(reason)
+	if err != nil {
+		return err
+	}
+
+	return uc.returnRepo.Update(returnRequest)
+}
+
+// ReceiveReturn records the items of an approved return arriving in a warehouse.
+// serialNumbers lists, by return item ID, the units received for serialized products.
+func (uc *ReturnUseCase) ReceiveReturn(returnID uint, warehouseID uint, serialNumbers map[uint][]string) error {
+	returnRequest, err := uc.findReturn(returnID)
+	if err != nil {
+		return err
+	}
+
+	for i, item := range returnRequest.Items {
+		serialized, err := uc.serialUseCase.RequiresSerials(item.ProductID)
+		if err != nil {
+			return err
+		}
+
+		serials := serialNumbers[item.ReturnItemID]
+		if !serialized {
+			if len(serials) > 0 {
+				return errors.New("serial numbers given for an item that is not serialized")
+			}
+			continue
+		}
+
+		if len(serials) != item.Quantity {
+			return fmt.Errorf("expected %d serial numbers for product %d, got %d", item.Quantity, item.ProductID, len(serials))
+		}
+
+		err = uc.serialUseCase.CheckReturn(returnRequest.OrderID, item.OrderItemID, returnID, serials)
+		if err != nil {
+			return err
+		}
+		returnRequest.Items[i].SerialNumbers = serials
+	}
+
+	err = returnRequest.Receive(warehouseID)
+	if err != nil {
+		return err
+	}
+
+	return uc.returnRepo.Update(returnRequest)
+}
+
+// InspectItem records the inspection of a returned item and moves its stock: restocked
+// items go back into sellable inventory at the cost they shipped at, quarantined items
+// into a quarantine bin outside it. Bundles are restocked as their components.
+// The inspection is saved once the stock has moved. Should that fail partway, the item
+// can be inspected again: stock and units an earlier try already moved are not moved twice.
+func (uc *ReturnUseCase) InspectItem(
+	returnID uint,
+	returnItemID uint,
+	outcome order.InspectionOutcome,
+	quarantineLocationID *uint,
+	staffID uint,
+) error {
+	returnRequest, err := uc.findReturn(returnID)
+	if err != nil {
+		return err
+	}
+
+	ord, err := uc.findOrder(returnRequest.OrderID)
+	if err != nil {
+		return err
+	}
+
+	item, err := returnRequest.Inspect(returnItemID, outcome, quarantineLocationID)
+	if err != nil {
+		return err
+	}
+
+	orderItem := findOrderItem(ord, item.OrderItemID)
+	if orderItem == nil {
+		return errors.New("returned item is no longer on the order")
+	}
+
+	// The units may have been returned on another return since this one was received
+	err = uc.serialUseCase.CheckReturn(ord.OrderID, item.OrderItemID, returnID, item.SerialNumbers)
+	if err != nil {
+		return err
+	}
+
+	warehouseID := *returnRequest.WarehouseID
+	for _, units := range returnedStock(ord, orderItem, *item) {
+		moved, err := uc.stockAlreadyReturned(returnRequest, ord, *item, units)
+		if err != nil {
+			return err
+		}
+
+		if moved >= units.quantity {
+			continue
+		}
+
+		err = uc.returnStock(units.productID, units.variantID, warehouseID, units.quantity-moved, units.unitCost, *item, returnID, staffID)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, serialNumber := range item.SerialNumbers {
+		if outcome == order.InspectionOutcomeRestock {
+			err = uc.serialUseCase.ReturnUnit(serialNumber, ord.OrderID, item.OrderItemID, warehouseID, returnID, staffID)
+		} else {
+			err = uc.serialUseCase.QuarantineUnit(serialNumber, ord.OrderID, item.OrderItemID, warehouseID, returnID, staffID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return uc.returnRepo.Update(returnRequest)
+}
+
+// CloseReturn pays back an inspected return for its items' share of the order, as a
+// refund of the goods and their tax against the order's payment or as store credit.
+// Store credit is capped at what is left of the order's total after the refunds and
+// store credit already issued against it.
+func (uc *ReturnUseCase) CloseReturn(returnID uint, staffID uint) error {
+	returnRequest, err := uc.findReturn(returnID)
+	if err != nil {
+		return err
+	}
+
+	if returnRequest.Status != order.ReturnStatusInspected {
+		return errors.New("can only close inspected returns")
+	}
+
+	ord, err := uc.findOrder(returnRequest.OrderID)
+	if err != nil {
+		return err
+	}
+
+	amount, err := returnRequest.RefundableAmount(ord)
+	if err != nil {
+		return err
+	}
+
+	reason := fmt.Sprintf("Return %s", returnRequest.ReturnNumber)
+	if returnRequest.RefundMethod == order.RefundMethodStoreCredit {
+		return uc.closeWithStoreCredit(returnRequest, ord, amount, reason, staffID)
+	}
+
+	// A retry after the return failed to save keeps the refund already issued
+	refund, err := uc.refundUseCase.FindReturnRefund(ord.OrderID, returnID)
+	if err != nil {
+		return err
+	}
+
+	if refund == nil {
+		transaction, err := uc.refundUseCase.FindRefundableTransaction(ord.OrderID)
+		if err != nil {
+			return err
+		}
+
+		refund, err = uc.refundUseCase.IssueRefund(transaction.TransactionID, amount, false, true, reason, &returnID, staffID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = returnRequest.CloseWithRefund(refund.Amount, refund.RefundID)
+	if err != nil {
+		return err
+	}
+
+	return uc.returnRepo.Update(returnRequest)
+}
+
+// GetReturn gets a return by ID
+func (uc *ReturnUseCase) GetReturn(returnID uint) (*order.ReturnRequest, error) {
+	return uc.returnRepo.FindByID(returnID)
+}
+
+// GetOrderReturns gets the returns opened against an order
+func (uc *ReturnUseCase) GetOrderReturns(orderID uint) ([]*order.ReturnRequest, error) {
+	return uc.returnRepo.FindByOrder(orderID)
+}
+
+// closeWithStoreCredit closes a return with store credit for amount, or for what is left
+// of the order's total when that is less
+func (uc *ReturnUseCase) closeWithStoreCredit(
+	returnRequest *order.ReturnRequest,
+	ord *order.Order,
+	amount vo.Money,
+	reason string,
+	staffID uint,
+) error {
+	// A retry after the return failed to save keeps the credit already issued
+	credit, err := uc.storeCreditRepo.FindByReturn(returnRequest.ReturnID)
+	if err != nil {
+		return err
+	}
+
+	if credit == nil {
+		remaining, err := uc.unpaidAmount(ord, returnRequest.ReturnID)
+		if err != nil {
+			return err
+		}
+
+		if !remaining.IsPositive() {
+			return errors.New("order has already been paid back in full")
+		}
+
+		if amount.Amount > remaining.Amount {
+			amount = remaining
+		}
+
+		credit, err = user.NewStoreCredit(ord.CustomerID, amount, &returnRequest.ReturnID, reason, staffID)
+		if err != nil {
+			return err
+		}
+
+		err = uc.storeCreditRepo.Create(credit)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = returnRequest.CloseWithStoreCredit(credit.Amount, credit.StoreCreditID)
+	if err != nil {
+		return err
+	}
+
+	return uc.returnRepo.Update(returnRequest)
+}
+
+// unpaidAmount works out what is left of an order's total after the refunds issued
+// against it and the store credit paid on its other returns
+func (uc *ReturnUseCase) unpaidAmount(ord *order.Order, returnID uint) (vo.Money, error) {
+	refunds, err := uc.refundUseCase.GetOrderRefunds(ord.OrderID)
+	if err != nil {
+		return vo.Money{}, err
+	}
+
+	refunded, err := order.RefundedAmount(refunds, ord.TotalAmount.Currency)
+	if err != nil {
+		return vo.Money{}, err
+	}
+
+	remaining, err := ord.TotalAmount.Subtract(refunded)
+	if err != nil {
+		return vo.Money{}, err
+	}
+
+	returns, err := uc.returnRepo.FindByOrder(ord.OrderID)
+	if err != nil {
+		return vo.Money{}, err
+	}
+
+	for _, other := range returns {
+		if other.ReturnID == returnID || other.StoreCreditID == nil || other.RefundAmount == nil {
+			continue
+		}
+
+		remaining, err = remaining.Subtract(*other.RefundAmount)
+		if err != nil {
+			return vo.Money{}, err
+		}
+	}
+
+	return remaining, nil
+}
+
+// stockUnits is a quantity of one product a returned item puts back, with the cost it shipped at
+type stockUnits struct {
+	productID uint
+	variantID *uint
+	quantity  int
+	unitCost  *vo.Money
+}
+
+// returnedStock lists the stock a returned item puts back: its components for a bundle,
+// otherwise the item itself
+func returnedStock(ord *order.Order, orderItem *order.OrderItem, item order.ReturnItem) []stockUnits {
+	if !orderItem.IsBundle() {
+		unitCost := shippedUnitCost(orderItem.CostOfGoods, ord.ShippedQuantity(orderItem.OrderItemID))
+		return []stockUnits{{item.ProductID, item.VariantID, item.Quantity, unitCost}}
+	}
+
+	stock := []stockUnits{}
+	for _, component := range orderItem.Components {
+		units := orderItem.ComponentUnits(component, item.Quantity)
+		unitCost := shippedUnitCost(component.CostOfGoods, component.Quantity)
+		stock = append(stock, stockUnits{component.ProductID, component.VariantID, units, unitCost})
+	}
+	return stock
+}
+
+// stockAlreadyReturned works out how many units of a product an earlier try at inspecting
+// an item already moved: what the return's stock movements put back, less the units its
+// other inspected items account for
+func (uc *ReturnUseCase) stockAlreadyReturned(
+	returnRequest *order.ReturnRequest,
+	ord *order.Order,
+	item order.ReturnItem,
+	units stockUnits,
+) (int, error) {
+	movements, err := uc.inventoryUseCase.GetMovements(invdomain.ReferenceTypeReturn, returnRequest.ReturnID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Restocking books stock in; quarantining moves it into a bin from outside the warehouse's stock
+	moved := 0
+	for _, movement := range movements {
+		restocked := movement.Type == invdomain.MovementTypeIn
+		quarantined := movement.Type == invdomain.MovementTypeTransfer && movement.FromLocationID == nil
+		if (restocked || quarantined) && movement.ProductID == units.productID && invdomain.SameVariant(movement.VariantID, units.variantID) {
+			moved += movement.Quantity
+		}
+	}
+
+	for _, other := range returnRequest.Items {
+		if other.ReturnItemID == item.ReturnItemID || other.Outcome == nil {
+			continue
+		}
+
+		orderItem := findOrderItem(ord, other.OrderItemID)
+		if orderItem == nil {
+			continue
+		}
+
+		for _, stock := range returnedStock(ord, orderItem, other) {
+			if stock.productID == units.productID && invdomain.SameVariant(stock.variantID, units.variantID) {
+				moved -= stock.quantity
+			}
+		}
+	}
+
+	return max(moved, 0), nil
+}
+
+// returnStock puts returned units of a product back into stock or into quarantine
+func (uc *ReturnUseCase) returnStock(
+	productID uint,
+	variantID *uint,
+	warehouseID uint,
+	quantity int,
+	unitCost *vo.Money,
+	item order.ReturnItem,
+	returnID uint,
+	staffID uint,
+) error {
+	if *item.Outcome == order.InspectionOutcomeQuarantine {
+		return uc.locationUseCase.Quarantine(productID, variantID, warehouseID, *item.LocationID, quantity, invdomain.ReferenceTypeReturn, returnID, staffID)
+	}
+
+	return uc.inventoryUseCase.AddStock(productID, warehouseID, variantID, quantity, unitCost, invdomain.ReferenceTypeReturn, returnID, staffID, "Returned to stock")
+}
+
+// findOrder loads an existing order
+func (uc *ReturnUseCase) findOrder(orderID uint) (*order.Order, error) {
+	ord, err := uc.orderRepo.FindByID(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if ord == nil {
+		return nil, errors.New("order not found")
+	}
+
+	return ord, nil
+}
+
+// findReturn loads an existing return
+func (uc *ReturnUseCase) findReturn(returnID uint) (*order.ReturnRequest, error) {
+	returnRequest, err := uc.returnRepo.FindByID(returnID)
+	if err != nil {
+		return nil, err
+	}
+
+	if returnRequest == nil {
+		return nil, errors.New("return not found")
+	}
+
+	return returnRequest, nil
+}
+
+// shippedUnitCost works out the cost of one unit from the cost of goods snapshot taken
+// when units shipped. Without a snapshot stock comes back at the current average cost.
+func shippedUnitCost(costOfGoods *vo.Money, units int) *vo.Money {
+	if costOfGoods == nil || units <= 0 {
+		return nil
+	}
+
+	unitCost, err := costOfGoods.Multiply(1 / float64(units))
+	if err != nil {
+		return nil
+	}
+	return &unitCost
+}
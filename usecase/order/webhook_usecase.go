@@ -0,0 +1,217 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/order"
+)
+
+// WebhookSource is how one gateway's webhooks are checked and read
+type WebhookSource struct {
+	Secret string // Shared secret the gateway signs its webhooks with
+	Parser order.WebhookParser
+}
+
+// WebhookUseCase contains the business logic for payment gateway webhooks
+type WebhookUseCase struct {
+	webhookRepo     order.WebhookEventRepository
+	transactionRepo order.TransactionRepository
+	orderUseCase    *OrderUseCase
+	refundUseCase   *RefundUseCase
+	sources         map[string]WebhookSource
+}
+
+// NewWebhookUseCase creates a new WebhookUseCase.
+// sources maps gateway names, as payment methods use them, to how their webhooks are read.
+func NewWebhookUseCase(
+	webhookRepo order.WebhookEventRepository,
+	transactionRepo order.TransactionRepository,
+	orderUseCase *OrderUseCase,
+	refundUseCase *RefundUseCase,
+	sources map[string]WebhookSource,
+) *WebhookUseCase {
+	return &WebhookUseCase{
+		webhookRepo:     webhookRepo,
+		transactionRepo: transactionRepo,
+		orderUseCase:    orderUseCase,
+		refundUseCase:   refundUseCase,
+		sources:         sources,
+	}
+}
+
+// ReceiveWebhook handles a webhook delivery from a gateway. Every delivery is kept with
+// its raw payload. Gateways retry until they get a success, so a nil error means the event
+// is dealt with, including when it repeats or is older than what is already recorded;
+// ErrInvalidWebhookSignature means it is not from the gateway, ErrUnknownWebhookGateway
+// that the gateway is not set up and a rejected event that it cannot be read; any other
+// error means it should be delivered again.
+func (uc *WebhookUseCase) ReceiveWebhook(gateway string, payload []byte, signature string) (*order.WebhookEvent, error) {
+	source, ok := uc.sources[gateway]
+	if !ok {
+		return nil, order.ErrUnknownWebhookGateway
+	}
+
+	event := order.NewWebhookEvent(gateway, payload, signature)
+
+	// Nothing in an unsigned payload is trusted, not even its event ID
+	if !order.VerifyWebhookSignature(payload, signature, source.Secret) {
+		event.Reject(order.ErrInvalidWebhookSignature.Error())
+		err := uc.webhookRepo.Create(event)
+		if err != nil {
+			return nil, err
+		}
+		return event, order.ErrInvalidWebhookSignature
+	}
+
+	notification, err := source.Parser.ParseWebhook(payload)
+	if err != nil {
+		event.Reject(err.Error())
+		createErr := uc.webhookRepo.Create(event)
+		if createErr != nil {
+			return nil, createErr
+		}
+		return event, err
+	}
+
+	existing, err := uc.webhookRepo.FindByGatewayEvent(gateway, notification.EventID)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing != nil {
+		return uc.redeliver(existing, notification)
+	}
+
+	event.Accept(notification)
+	err = uc.webhookRepo.Create(event)
+	if err != nil {
+		return nil, err
+	}
+
+	return event, uc.apply(event, notification)
+}
+
+// GetWebhookEvent gets a webhook event by ID
+func (uc *WebhookUseCase) GetWebhookEvent(eventID uint) (*order.WebhookEvent, error) {
+	return uc.webhookRepo.FindByID(eventID)
+}
+
+// GetTransactionWebhookEvents gets the webhook events a gateway sent about a transaction
+func (uc *WebhookUseCase) GetTransactionWebhookEvents(transactionID uint) ([]*order.WebhookEvent, error) {
+	return uc.webhookRepo.FindByTransaction(transactionID)
+}
+
+// GetFailedWebhookEvents gets the webhook events that failed to apply and wait for the
+// gateway to deliver them again. Events abandoned while being applied are not failures;
+// the next delivery picks them up.
+func (uc *WebhookUseCase) GetFailedWebhookEvents(page, limit int) ([]*order.WebhookEvent, error) {
+	return uc.webhookRepo.FindByStatus(order.WebhookEventStatusFailed, page, limit)
+}
+
+// redeliver handles another delivery of an event already recorded. Handled events are
+// not applied again; failed ones, and ones abandoned while being applied, are tried again.
+func (uc *WebhookUseCase) redeliver(event *order.WebhookEvent, notification order.WebhookNotification) (*order.WebhookEvent, error) {
+	if event.Status == order.WebhookEventStatusReceived && !event.IsAbandoned(time.Now()) {
+		return event, errors.New("webhook event is still being processed")
+	}
+
+	event.Redeliver()
+	err := uc.webhookRepo.Update(event)
+	if err != nil {
+		return nil, err
+	}
+
+	if event.IsHandled() {
+		return event, nil
+	}
+
+	return event, uc.apply(event, notification)
+}
+
+// apply moves the reported transaction, and its order, on to the status the gateway
+// reports and records the outcome on the event
+func (uc *WebhookUseCase) apply(event *order.WebhookEvent, notification order.WebhookNotification) error {
+	// Only events that failed or were abandoned are delivered here again
+	retrying := event.Deliveries > 1
+
+	transaction, err := uc.findTransaction(notification)
+	if err != nil {
+		return uc.fail(event, err)
+	}
+
+	// The gateway can report a transaction before we have recorded it; its retry will find it
+	if transaction == nil {
+		return uc.fail(event, errors.New("transaction not found"))
+	}
+
+	changed := transaction.ApplyGatewayStatus(notification.Status)
+	if changed {
+		err = uc.transactionRepo.Update(transaction)
+		if err != nil {
+			return uc.fail(event, err)
+		}
+	}
+
+	// What the transaction pays for is moved on whenever the transaction is at the reported
+	// status, so a retry after a failure here finishes the job; the order and refund ignore
+	// a status they are already past
+	if transaction.Status == notification.Status {
+		err = uc.moveOn(transaction)
+		if err != nil {
+			return uc.fail(event, err)
+		}
+	}
+
+	// A retried event may have moved the transaction on before it failed
+	if changed || (retrying && transaction.Status == notification.Status) {
+		event.Apply(transaction.TransactionID)
+	} else {
+		event.Ignore(&transaction.TransactionID, fmt.Sprintf("transaction is already %s", transaction.Status))
+	}
+
+	return uc.webhookRepo.Update(event)
+}
+
+// moveOn passes a transaction's new status on to what it pays for: a gateway refund
+// settles its refund, other steps move their order's payment status
+func (uc *WebhookUseCase) moveOn(transaction *order.Transaction) error {
+	if transaction.Type == order.TransactionTypeRefund {
+		return uc.refundUseCase.ApplyRefundStatus(transaction)
+	}
+
+	status, ok := transaction.OrderPaymentStatus()
+	if !ok {
+		return nil
+	}
+
+	return uc.orderUseCase.ApplyPaymentStatus(transaction.OrderID, status)
+}
+
+// findTransaction finds the transaction a webhook reports on, by the gateway's ID
+// for it or else by its reference number
+func (uc *WebhookUseCase) findTransaction(notification order.WebhookNotification) (*order.Transaction, error) {
+	if notification.GatewayTransactionID != "" {
+		transaction, err := uc.transactionRepo.FindByGatewayTransactionID(notification.GatewayTransactionID)
+		if err != nil || transaction != nil {
+			return transaction, err
+		}
+	}
+
+	if notification.ReferenceNumber != "" {
+		return uc.transactionRepo.FindByReferenceNumber(notification.ReferenceNumber)
+	}
+
+	return nil, nil
+}
+
+// fail records that an event could not be applied and returns why, so the gateway retries it
+func (uc *WebhookUseCase) fail(event *order.WebhookEvent, cause error) error {
+	event.Fail(cause.Error())
+	err := uc.webhookRepo.Update(event)
+	if err != nil {
+		return err
+	}
+	return cause
+}
@@ -0,0 +1,158 @@
+package order
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/common/vo"
+	"github.com/hydr0g3nz/ecom_mid/domain/order"
+	"github.com/hydr0g3nz/ecom_mid/domain/order/ordertest"
+)
+
+// pendingRefund captures the fixture's order, then issues a refund of amount the
+// gateway only confirms later and returns it with the gateway's refund transaction
+func pendingRefund(t *testing.T, f *paymentFixture, amount float64) (*order.Refund, *order.Transaction) {
+	t.Helper()
+
+	capture, err := f.capture()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.gateway.Asynchronous = true
+	refund, err := f.refundsUC.IssueRefund(capture.TransactionID, vo.Money{Amount: amount, Currency: "THB"}, false, false, "Damaged", nil, testStaffID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payment, err := f.payments.FindRefundPayment(refund)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if payment == nil || !payment.IsPending() {
+		t.Fatal("gateway refund was not recorded as pending")
+	}
+
+	return refund, payment
+}
+
+// checkRefund fails the test unless the refund and the order's payment are at the given statuses
+func checkRefund(t *testing.T, f *paymentFixture, refundID uint, refundStatus string, paymentStatus order.PaymentStatus) {
+	t.Helper()
+
+	refund, err := f.refunds.FindByID(refundID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if refund.Status != refundStatus {
+		t.Fatalf("refund is %s, want %s", refund.Status, refundStatus)
+	}
+
+	if f.order().PaymentStatus != paymentStatus {
+		t.Fatalf("order payment is %s, want %s", f.order().PaymentStatus, paymentStatus)
+	}
+}
+
+func TestPendingGatewayRefundIsProcessedOnceTheGatewayConfirmsIt(t *testing.T) {
+	f := newPaymentFixture(500)
+	refund, payment := pendingRefund(t, f, 200)
+
+	checkRefund(t, f, refund.RefundID, order.RefundStatusPending, order.PaymentStatusPaid)
+
+	event, err := f.deliver(f.gateway.Webhook(payment.GatewayTransactionID, order.PaymentStatusRefunded))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if event.Status != order.WebhookEventStatusApplied {
+		t.Fatalf("webhook event is %s, want applied", event.Status)
+	}
+
+	checkRefund(t, f, refund.RefundID, order.RefundStatusProcessed, order.PaymentStatusPartiallyRefunded)
+}
+
+func TestFailedGatewayRefundMarksTheRefundFailed(t *testing.T) {
+	f := newPaymentFixture(500)
+	refund, payment := pendingRefund(t, f, 200)
+
+	_, err := f.deliver(f.gateway.Webhook(payment.GatewayTransactionID, order.PaymentStatusFailed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkRefund(t, f, refund.RefundID, order.RefundStatusFailed, order.PaymentStatusPaid)
+
+	// A confirmation arriving after the failure changes nothing
+	_, err = f.deliver(f.gateway.Webhook(payment.GatewayTransactionID, order.PaymentStatusRefunded))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkRefund(t, f, refund.RefundID, order.RefundStatusFailed, order.PaymentStatusPaid)
+}
+
+func TestRefundedReportForAnUncapturedPaymentIsIgnored(t *testing.T) {
+	f := newPaymentFixture(500)
+	f.gateway.Asynchronous = true
+
+	authorization, err := f.payments.Authorize(f.order(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event, err := f.deliver(f.gateway.Webhook(authorization.GatewayTransactionID, order.PaymentStatusRefunded))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if event.Status != order.WebhookEventStatusIgnored {
+		t.Fatalf("webhook event is %s, want ignored", event.Status)
+	}
+
+	saved, err := f.transactions.FindByID(authorization.TransactionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if saved.Status != order.PaymentStatusPending {
+		t.Fatalf("authorization is %s, want still pending", saved.Status)
+	}
+}
+
+func TestAbandonedWebhookEventIsAppliedOnItsNextDelivery(t *testing.T) {
+	f := newPaymentFixture(500)
+	refund, payment := pendingRefund(t, f, 200)
+	payload := f.gateway.Webhook(payment.GatewayTransactionID, order.PaymentStatusRefunded)
+
+	// Recorded, then left behind by a crash before it was applied
+	notification, err := f.gateway.ParseWebhook(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	abandoned := order.NewWebhookEvent(ordertest.GatewayName, payload, order.SignWebhookPayload(payload, testWebhookSecret))
+	abandoned.Accept(notification)
+	err = f.webhooks.Create(abandoned)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = f.deliver(payload)
+	if err == nil {
+		t.Fatal("event still being applied was applied again")
+	}
+
+	f.webhooks.events[0].ReceivedAt = time.Now().Add(-2 * order.WebhookProcessingTimeout)
+	event, err := f.deliver(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if event.Status != order.WebhookEventStatusApplied {
+		t.Fatalf("webhook event is %s, want applied", event.Status)
+	}
+
+	checkRefund(t, f, refund.RefundID, order.RefundStatusProcessed, order.PaymentStatusPartiallyRefunded)
+}
@@ -0,0 +1,187 @@
+package product
+
+import (
+	"errors"
+
+	"github.com/hydr0g3nz/ecom_mid/domain/product"
+	"github.com/hydr0g3nz/ecom_mid/usecase/inventory"
+)
+
+// ProductUseCase contains the business logic for reading the product catalogue
+type ProductUseCase struct {
+	productRepo  product.ProductRepository
+	availability *inventory.AvailabilityUseCase
+}
+
+// NewProductUseCase creates a new ProductUseCase
+func NewProductUseCase(productRepo product.ProductRepository, availability *inventory.AvailabilityUseCase) *ProductUseCase {
+	return &ProductUseCase{
+		productRepo:  productRepo,
+		availability: availability,
+	}
+}
+
+// GetProductByID gets a product with its current stock
+func (uc *ProductUseCase) GetProductByID(productID uint) (*product.Product, error) {
+	prod, err := uc.productRepo.FindByID(productID)
+	if err != nil {
+		return nil, err
+	}
+
+	if prod == nil {
+		return nil, errors.New("product not found")
+	}
+
+	err = uc.availability.ApplyToProduct(prod)
+	if err != nil {
+		return nil, err
+	}
+
+	return prod, nil
+}
+
+// GetProductBySKU gets a product by SKU with its current stock
+func (uc *ProductUseCase) GetProductBySKU(sku string) (*product.Product, error) {
+	prod, err := uc.productRepo.FindBySKU(sku)
+	if err != nil {
+		return nil, err
+	}
+
+	if prod == nil {
+		return nil, errors.New("product not found")
+	}
+
+	err = uc.availability.ApplyToProduct(prod)
+	if err != nil {
+		return nil, err
+	}
+
+	return prod, nil
+}
+
+// GetProducts gets a page of products with their current stock
+func (uc *ProductUseCase) GetProducts(page, limit int) ([]*product.Product, error) {
+	products, err := uc.productRepo.FindAll(page, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	err = uc.availability.ApplyToProducts(products)
+	if err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
+
+// GetProductsByCategory gets a page of a category's products with their current stock
+func (uc *ProductUseCase) GetProductsByCategory(categoryID uint, page, limit int) ([]*product.Product, error) {
+	products, err := uc.productRepo.FindByCategory(categoryID, page, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	err = uc.availability.ApplyToProducts(products)
+	if err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
+
+// AddBundleComponent adds quantity of a product or variant to a bundle.
+// Components must be stocked products of their own; bundles cannot be nested and
+// serialized products cannot be sold inside one.
+func (uc *ProductUseCase) AddBundleComponent(bundleID, productID uint, variantID *uint, quantity int) (*product.Product, error) {
+	bundle, err := uc.productRepo.FindByID(bundleID)
+	if err != nil {
+		return nil, err
+	}
+
+	if bundle == nil {
+		return nil, errors.New("bundle not found")
+	}
+
+	component, err := uc.productRepo.FindByID(productID)
+	if err != nil {
+		return nil, err
+	}
+
+	if component == nil {
+		return nil, errors.New("component product not found")
+	}
+
+	if component.IsBundle() {
+		return nil, errors.New("bundles cannot contain other bundles")
+	}
+
+	if component.IsSerialized {
+		return nil, errors.New("serialized products cannot be bundled")
+	}
+
+	if variantID != nil && !hasVariant(component, *variantID) {
+		return nil, errors.New("variant not found for this product")
+	}
+
+	if variantID == nil && len(component.Variants) > 0 {
+		return nil, errors.New("a variant must be chosen for this product")
+	}
+
+	err = bundle.AddComponent(product.BundleComponent{ProductID: productID, VariantID: variantID, Quantity: quantity})
+	if err != nil {
+		return nil, err
+	}
+
+	// AddComponent either grew an existing line or appended a new one
+	for i := range bundle.Components {
+		c := &bundle.Components[i]
+		if c.ProductID != productID || !product.SameVariant(c.VariantID, variantID) {
+			continue
+		}
+
+		if c.ComponentID != 0 {
+			err = uc.productRepo.UpdateComponent(c)
+		} else {
+			err = uc.productRepo.AddComponent(c)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return bundle, nil
+}
+
+// RemoveBundleComponent removes a component from a bundle
+func (uc *ProductUseCase) RemoveBundleComponent(bundleID, componentID uint) (*product.Product, error) {
+	bundle, err := uc.productRepo.FindByID(bundleID)
+	if err != nil {
+		return nil, err
+	}
+
+	if bundle == nil {
+		return nil, errors.New("bundle not found")
+	}
+
+	err = bundle.RemoveComponent(componentID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = uc.productRepo.RemoveComponent(componentID)
+	if err != nil {
+		return nil, err
+	}
+
+	return bundle, nil
+}
+
+// hasVariant checks if a product has a variant
+func hasVariant(prod *product.Product, variantID uint) bool {
+	for _, variant := range prod.Variants {
+		if variant.VariantID == variantID {
+			return true
+		}
+	}
+	return false
+}